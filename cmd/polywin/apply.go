@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ApplyStrategy 新版本就绪后替换目标程序的时机
+type ApplyStrategy string
+
+const (
+	ApplyImmediate  ApplyStrategy = "immediate"    // 立即优雅重启目标程序
+	ApplyOnNextExit ApplyStrategy = "on-next-exit" // 不主动重启，目标程序自行退出后重启时替换
+	ApplyWindow     ApplyStrategy = "window"       // 只在维护窗口内重启目标程序
+)
+
+// MaintenanceWindow 维护窗口：按 cron 表达式开始，持续 Duration
+type MaintenanceWindow struct {
+	Schedule *CronSchedule
+	Duration time.Duration
+}
+
+// Contains now 是否在维护窗口内
+func (w *MaintenanceWindow) Contains(now time.Time) bool {
+	start := w.Schedule.Next(now.Add(-w.Duration))
+	return !start.IsZero() && !start.After(now)
+}
+
+// Next 返回最近的可以应用更新的时间：now 在窗口内时为 now，否则为下一个窗口的开始时间
+func (w *MaintenanceWindow) Next(now time.Time) time.Time {
+	if w.Contains(now) {
+		return now
+	}
+	return w.Schedule.Next(now)
+}
+
+// String 返回维护窗口描述
+func (w *MaintenanceWindow) String() string {
+	return fmt.Sprintf("%s 开始，持续 %v", w.Schedule, w.Duration)
+}
+
+// cronMacros 常用 cron 表达式的简写
+var cronMacros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+// CronSchedule 5 段 cron 表达式（分 时 日 月 周），按本地时间计算：
+//
+//	0 2 * * *       每天 02:00
+//	30 1 * * 1-5    周一到周五 01:30
+//	0 */6 * * *     每 6 小时
+//	0 3 1,15 * *    每月 1 日和 15 日 03:00
+//
+// 周日可以写作 0 或 7；日和周都不是 * 时满足其一即可（与 cron 一致）
+type CronSchedule struct {
+	raw    string
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	domAny bool
+	dowAny bool
+}
+
+// ParseCron 解析 cron 表达式
+func ParseCron(expr string) (*CronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	fields := strings.Fields(expr)
+	if macro, ok := cronMacros[strings.ToLower(expr)]; ok {
+		fields = strings.Fields(macro)
+	}
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("无效的 cron 表达式 %q: 需要 5 段（分 时 日 月 周）", expr)
+	}
+
+	c := &CronSchedule{raw: expr}
+	ranges := []struct {
+		name     string
+		min, max int
+		bits     *uint64
+	}{
+		{"分", 0, 59, &c.minute},
+		{"时", 0, 23, &c.hour},
+		{"日", 1, 31, &c.dom},
+		{"月", 1, 12, &c.month},
+		{"周", 0, 7, &c.dow},
+	}
+	for i, r := range ranges {
+		bits, err := parseCronField(fields[i], r.min, r.max)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 cron 表达式 %q: %s字段: %v", expr, r.name, err)
+		}
+		*r.bits = bits
+	}
+	// 7 也表示周日
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domAny = fields[2] == "*" || fields[2] == "?"
+	c.dowAny = fields[4] == "*" || fields[4] == "?"
+	return c, nil
+}
+
+// parseCronField 解析单个字段：*、数字、范围（a-b）、步长（*/n、a-b/n）和逗号分隔的列表
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("无效的步长: %s", part)
+			}
+			step = n
+		}
+
+		low, high := min, max
+		switch {
+		case rangePart == "*" || rangePart == "?":
+		case strings.Contains(rangePart, "-"):
+			a, b, _ := strings.Cut(rangePart, "-")
+			var err1, err2 error
+			low, err1 = strconv.Atoi(a)
+			high, err2 = strconv.Atoi(b)
+			if err1 != nil || err2 != nil || low > high {
+				return 0, fmt.Errorf("无效的范围: %s", part)
+			}
+		default:
+			n, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return 0, fmt.Errorf("无效的值: %s", part)
+			}
+			low = n
+			if !hasStep {
+				high = n
+			}
+		}
+		if low < min || high > max {
+			return 0, fmt.Errorf("%s 超出范围 %d-%d", part, min, max)
+		}
+		for v := low; v <= high; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// Next 返回 t 之后（不含 t）第一个满足表达式的时间，5 年内没有时返回零值
+func (c *CronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = forward(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location()))
+		case !c.dayMatches(t):
+			t = forward(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location()))
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = forward(t, time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location()))
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// forward 保证时间只向后推进：夏令时开始时被跳过的本地时间会被 time.Date
+// 规范化到跳变之前，此时按实际时间顺延到跳变之后
+func forward(t, next time.Time) time.Time {
+	for !next.After(t) {
+		next = next.Add(time.Hour)
+	}
+	return next
+}
+
+// dayMatches 日期是否满足日和周字段
+func (c *CronSchedule) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// String 返回原始表达式
+func (c *CronSchedule) String() string {
+	return c.raw
+}
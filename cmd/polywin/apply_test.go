@@ -0,0 +1,170 @@
+package main
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+// mustCron 解析 cron 表达式
+func mustCron(t *testing.T, expr string) *CronSchedule {
+	t.Helper()
+	c, err := ParseCron(expr)
+	if err != nil {
+		t.Fatalf("ParseCron(%q): %v", expr, err)
+	}
+	return c
+}
+
+// mustLocation 加载时区
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("LoadLocation(%q): %v", name, err)
+	}
+	return loc
+}
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr string
+		ok   bool
+	}{
+		{"0 2 * * *", true},
+		{"30 1 * * 1-5", true},
+		{"0 */6 * * *", true},
+		{"0 3 1,15 * *", true},
+		{"0-30/10 9-17 * * 1-5", true},
+		{"0 0 * * 7", true},
+		{"0 0 ? * ?", true},
+		{"@daily", true},
+		{"@HOURLY", true},
+		{"", false},
+		{"* * * *", false},
+		{"* * * * * *", false},
+		{"60 * * * *", false},
+		{"* 24 * * *", false},
+		{"* * 0 * *", false},
+		{"* * 32 * *", false},
+		{"* * * 0 *", false},
+		{"* * * 13 *", false},
+		{"* * * * 8", false},
+		{"*/0 * * * *", false},
+		{"5-1 * * * *", false},
+		{"a * * * *", false},
+		{"1,,2 * * * *", false},
+		{"@yearly", false},
+	}
+	for _, tt := range tests {
+		_, err := ParseCron(tt.expr)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseCron(%q) = %v，期望成功: %v", tt.expr, err, tt.ok)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	utc := time.UTC
+	ny := mustLocation(t, "America/New_York")
+	santiago := mustLocation(t, "America/Santiago")
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time // 零值表示 5 年内没有
+	}{
+		{"下一分钟开始", "* * * * *", time.Date(2024, 5, 1, 10, 0, 30, 0, utc), time.Date(2024, 5, 1, 10, 1, 0, 0, utc)},
+		{"不含起始时间", "0 2 * * *", time.Date(2024, 5, 1, 2, 0, 0, 0, utc), time.Date(2024, 5, 2, 2, 0, 0, 0, utc)},
+		{"跨月", "0 2 1 * *", time.Date(2024, 1, 31, 23, 0, 0, 0, utc), time.Date(2024, 2, 1, 2, 0, 0, 0, utc)},
+		{"跨年", "59 23 31 12 *", time.Date(2024, 12, 31, 23, 59, 0, 0, utc), time.Date(2025, 12, 31, 23, 59, 0, 0, utc)},
+		{"跳过没有 31 日的月份", "0 3 31 * *", time.Date(2024, 1, 31, 4, 0, 0, 0, utc), time.Date(2024, 3, 31, 3, 0, 0, 0, utc)},
+		{"闰年 2 月 29 日", "0 0 29 2 *", time.Date(2024, 3, 1, 0, 0, 0, 0, utc), time.Date(2028, 2, 29, 0, 0, 0, 0, utc)},
+		{"不存在的日期", "0 0 30 2 *", time.Date(2024, 1, 1, 0, 0, 0, 0, utc), time.Time{}},
+		{"日和周满足其一", "0 0 13 * 5", time.Date(2024, 9, 1, 0, 0, 0, 0, utc), time.Date(2024, 9, 6, 0, 0, 0, 0, utc)},
+		{"周日写作 7", "0 0 * * 7", time.Date(2024, 9, 2, 0, 0, 0, 0, utc), time.Date(2024, 9, 8, 0, 0, 0, 0, utc)},
+		{"工作日跨周末", "*/15 9-17 * * 1-5", time.Date(2024, 9, 6, 17, 45, 0, 0, utc), time.Date(2024, 9, 9, 9, 0, 0, 0, utc)},
+		{"步长", "0 */6 * * *", time.Date(2024, 5, 1, 13, 0, 0, 0, utc), time.Date(2024, 5, 1, 18, 0, 0, 0, utc)},
+
+		// 夏令时开始（2024-03-10 02:00 EST 跳到 03:00 EDT）
+		{"夏令时开始：不存在的时间跳过当天", "30 2 * * *", time.Date(2024, 3, 9, 12, 0, 0, 0, ny), time.Date(2024, 3, 11, 2, 30, 0, 0, ny)},
+		{"夏令时开始：跳过的小时之后", "0 3 * * *", time.Date(2024, 3, 10, 0, 0, 0, 0, ny), time.Date(2024, 3, 10, 3, 0, 0, 0, ny)},
+		{"夏令时开始：每小时", "0 * * * *", time.Date(2024, 3, 10, 1, 30, 0, 0, ny), time.Date(2024, 3, 10, 3, 0, 0, 0, ny)},
+		{"夏令时开始：跳变前一分钟", "* * * * *", time.Date(2024, 3, 10, 1, 59, 0, 0, ny), time.Date(2024, 3, 10, 3, 0, 0, 0, ny)},
+		{"夏令时开始：午夜被跳过", "0 12 * * *", time.Date(2024, 9, 7, 13, 0, 0, 0, santiago), time.Date(2024, 9, 8, 12, 0, 0, 0, santiago)},
+
+		// 夏令时结束（2024-11-03 02:00 EDT 回到 01:00 EST）
+		{"夏令时结束：每天", "0 3 * * *", time.Date(2024, 11, 2, 3, 0, 0, 0, ny), time.Date(2024, 11, 3, 3, 0, 0, 0, ny)},
+		{"夏令时结束：午夜", "0 0 * * *", time.Date(2024, 11, 3, 0, 0, 0, 0, ny), time.Date(2024, 11, 4, 0, 0, 0, 0, ny)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mustCron(t, tt.expr).Next(tt.from)
+			if !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v，期望 %v", tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCronNextFallBackHours(t *testing.T) {
+	// 夏令时结束当天 01:00 出现两次，每小时的表达式应依次得到相隔一小时的时间
+	ny := mustLocation(t, "America/New_York")
+	c := mustCron(t, "0 * * * *")
+	at := time.Date(2024, 11, 3, 0, 30, 0, 0, ny)
+	want := []time.Time{
+		time.Date(2024, 11, 3, 5, 0, 0, 0, time.UTC), // 01:00 EDT
+		time.Date(2024, 11, 3, 6, 0, 0, 0, time.UTC), // 01:00 EST
+		time.Date(2024, 11, 3, 7, 0, 0, 0, time.UTC), // 02:00 EST
+	}
+	for _, w := range want {
+		at = c.Next(at)
+		if !at.Equal(w) {
+			t.Fatalf("Next = %v，期望 %v", at.UTC(), w)
+		}
+	}
+}
+
+func TestMaintenanceWindow(t *testing.T) {
+	utc := time.UTC
+	ny := mustLocation(t, "America/New_York")
+	tests := []struct {
+		name     string
+		expr     string
+		duration time.Duration
+		now      time.Time
+		contains bool
+		next     time.Time // 不在窗口内时的下一个窗口开始时间
+	}{
+		{"窗口开始时", "0 2 * * *", 2 * time.Hour, time.Date(2024, 5, 1, 2, 0, 0, 0, utc), true, time.Time{}},
+		{"窗口内", "0 2 * * *", 2 * time.Hour, time.Date(2024, 5, 1, 3, 59, 0, 0, utc), true, time.Time{}},
+		{"窗口结束时", "0 2 * * *", 2 * time.Hour, time.Date(2024, 5, 1, 4, 0, 0, 0, utc), false, time.Date(2024, 5, 2, 2, 0, 0, 0, utc)},
+		{"窗口开始前", "0 2 * * *", 2 * time.Hour, time.Date(2024, 5, 1, 1, 59, 0, 0, utc), false, time.Date(2024, 5, 1, 2, 0, 0, 0, utc)},
+		{"跨午夜", "0 23 * * *", 3 * time.Hour, time.Date(2024, 5, 2, 1, 30, 0, 0, utc), true, time.Time{}},
+		{"跨月", "0 23 31 * *", 2 * time.Hour, time.Date(2024, 2, 1, 0, 30, 0, 0, utc), true, time.Time{}},
+		{"跨月之后", "0 23 31 * *", 2 * time.Hour, time.Date(2024, 2, 1, 1, 30, 0, 0, utc), false, time.Date(2024, 3, 31, 23, 0, 0, 0, utc)},
+		{"周末窗口", "0 1 * * 6", 48 * time.Hour, time.Date(2024, 9, 8, 23, 0, 0, 0, utc), true, time.Time{}},
+
+		// 窗口时长按实际经过的时间计算，不按钟表时间
+		{"夏令时开始：窗口内", "0 0 * * *", 3 * time.Hour, time.Date(2024, 3, 10, 3, 30, 0, 0, ny), true, time.Time{}},
+		{"夏令时开始：实际已过 3 小时", "0 0 * * *", 3 * time.Hour, time.Date(2024, 3, 10, 4, 0, 0, 0, ny), false, time.Date(2024, 3, 11, 0, 0, 0, 0, ny)},
+		{"夏令时结束：窗口内", "0 0 * * *", 3 * time.Hour, time.Date(2024, 11, 3, 1, 30, 0, 0, ny).Add(time.Hour), true, time.Time{}},
+		{"夏令时结束：实际已过 3 小时", "0 0 * * *", 3 * time.Hour, time.Date(2024, 11, 3, 2, 0, 0, 0, ny), false, time.Date(2024, 11, 4, 0, 0, 0, 0, ny)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &MaintenanceWindow{Schedule: mustCron(t, tt.expr), Duration: tt.duration}
+			if got := w.Contains(tt.now); got != tt.contains {
+				t.Fatalf("Contains(%v) = %v，期望 %v", tt.now, got, tt.contains)
+			}
+			next := w.Next(tt.now)
+			if tt.contains {
+				if !next.Equal(tt.now) {
+					t.Errorf("窗口内 Next = %v，期望当前时间", next)
+				}
+			} else if !next.Equal(tt.next) {
+				t.Errorf("Next(%v) = %v，期望 %v", tt.now, next, tt.next)
+			}
+		})
+	}
+}
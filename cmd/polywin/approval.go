@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// readyVersion 返回已就绪、等待批准的版本
+func (u *Updater) readyVersion() string {
+	u.updateMutex.Lock()
+	defer u.updateMutex.Unlock()
+	if tx := u.state.Transaction; tx != nil && tx.Phase == TxReady {
+		return tx.Version
+	}
+	return ""
+}
+
+// awaitApproval 已校验的新版本进入等待批准状态，批准前不会替换目标程序
+func (u *Updater) awaitApproval() error {
+	u.updateMutex.Lock()
+	tx := u.state.Transaction
+	if tx != nil && u.config.ApprovalTTL > 0 {
+		expires := time.Now().Add(u.config.ApprovalTTL)
+		tx.ExpiresAt = &expires
+	}
+	err := u.transition(TxReady, "")
+	u.updateMutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if tx != nil && tx.ExpiresAt != nil {
+		log.Printf("新版本 %s 已就绪，等待批准（%s 前有效）", tx.Version, tx.ExpiresAt.Format("2006-01-02 15:04"))
+		u.scheduleExpiry(*tx.ExpiresAt)
+	} else if tx != nil {
+		log.Printf("新版本 %s 已就绪，等待批准", tx.Version)
+	}
+	return nil
+}
+
+// Approve 批准等待中的版本，之后按应用策略替换目标程序；version 非空时必须与等待批准的版本一致
+func (u *Updater) Approve(version string) (string, error) {
+	u.expireReady(time.Now())
+
+	u.updateMutex.Lock()
+	tx := u.state.Transaction
+	if tx == nil || tx.Phase != TxReady {
+		u.updateMutex.Unlock()
+		return "", fmt.Errorf("没有等待批准的版本")
+	}
+	if version != "" && !sameVersion(version, tx.Version) {
+		u.updateMutex.Unlock()
+		return "", fmt.Errorf("等待批准的版本是 %s，不是 %s", tx.Version, version)
+	}
+	err := u.transition(TxVerified, "")
+	if err == nil {
+		u.pendingUpdate = true
+	}
+	u.updateMutex.Unlock()
+	if err != nil {
+		return "", err
+	}
+
+	log.Printf("版本 %s 已批准，%s", tx.Version, u.applySchedule(time.Now()))
+	u.notifyReady()
+	return tx.Version, nil
+}
+
+// Reject 拒绝等待中的版本：删除新版本文件并加入黑名单，之后不再下载；version 非空时必须与等待批准的版本一致
+func (u *Updater) Reject(version, reason string) (string, error) {
+	if ready := u.readyVersion(); ready == "" {
+		return "", fmt.Errorf("没有等待批准的版本")
+	} else if version != "" && !sameVersion(version, ready) {
+		return "", fmt.Errorf("等待批准的版本是 %s，不是 %s", ready, version)
+	}
+
+	text := "已拒绝"
+	if reason != "" {
+		text += ": " + reason
+	}
+	rejected, ok := u.discardReady(text, (*UpdaterState).addBlacklist)
+	if !ok {
+		return "", fmt.Errorf("没有等待批准的版本")
+	}
+	log.Printf("版本 %s %s，已加入黑名单", rejected, text)
+	return rejected, nil
+}
+
+// expireReady 丢弃超过有效期仍未批准的版本并记录下来，出现更新的版本前不再下载
+func (u *Updater) expireReady(now time.Time) {
+	u.updateMutex.Lock()
+	tx := u.state.Transaction
+	expired := tx != nil && tx.Phase == TxReady && tx.ExpiresAt != nil && !now.Before(*tx.ExpiresAt)
+	u.updateMutex.Unlock()
+	if !expired {
+		return
+	}
+	if version, ok := u.discardReady("等待批准超时", (*UpdaterState).setExpired); ok {
+		log.Printf("版本 %s 等待批准超时，已丢弃，出现更新的版本前不再下载", version)
+	}
+}
+
+// scheduleExpiry 到达截止时间时丢弃仍未批准的版本，不依赖更新检查（关闭自动更新时同样会过期）
+func (u *Updater) scheduleExpiry(expires time.Time) {
+	time.AfterFunc(time.Until(expires), func() {
+		if u.ctx.Err() == nil {
+			u.expireReady(time.Now())
+		}
+	})
+}
+
+// discardReady 放弃等待批准的版本，返回被放弃的版本；没有等待批准的版本时返回 false。
+// mark 非空时在同一次状态保存中记录被放弃的版本（加入黑名单或记为超时）
+func (u *Updater) discardReady(reason string, mark func(s *UpdaterState, version string)) (string, bool) {
+	u.updateMutex.Lock()
+	tx := u.state.Transaction
+	if tx == nil || tx.Phase != TxReady {
+		u.updateMutex.Unlock()
+		return "", false
+	}
+	if mark != nil {
+		mark(u.state, tx.Version)
+	}
+	// 先结束事务再删除文件，中断后启动时作为残留文件清理
+	err := u.transition(TxRolledBack, reason)
+	u.updateMutex.Unlock()
+	if err != nil {
+		log.Printf("%v", err)
+	}
+	u.removeStaged()
+	return tx.Version, true
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSource 测试用的更新源：返回固定的最新版本，记录下载次数，下载总是失败
+type fakeSource struct {
+	mu      sync.Mutex
+	info    UpdateInfo
+	fetched int
+}
+
+func (s *fakeSource) Latest(ctx context.Context, installed InstalledRecord) (*UpdateInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info := s.info
+	return &info, nil
+}
+
+func (s *fakeSource) FetchArtifact(ctx context.Context, ref, outputPath string, expect artifactExpectation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fetched++
+	return fmt.Errorf("测试更新源不提供下载")
+}
+
+func (s *fakeSource) FetchMetadata(ctx context.Context, ref string) ([]byte, error) {
+	return nil, nil
+}
+
+func (s *fakeSource) String() string { return "fake" }
+
+// downloads 返回下载次数
+func (s *fakeSource) downloads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetched
+}
+
+// stageReady 写入等待批准的新版本和事务，expires 为零值时不过期
+func stageReady(t *testing.T, dir string, expires time.Time) {
+	t.Helper()
+	writeTestFiles(t, dir, map[string]string{"server": "v1", "server.new": "v2"})
+	tx := &UpdateTransaction{
+		Version:   "1.2.0",
+		Phase:     TxReady,
+		Target:    filepath.Join(dir, "server"),
+		Installed: InstalledRecord{Version: "1.2.0"},
+		Previous:  InstalledRecord{Version: "1.1.0"},
+	}
+	if !expires.IsZero() {
+		tx.ExpiresAt = &expires
+	}
+	saveTestState(t, dir, &UpdaterState{Installed: tx.Previous, MachineID: "test", Transaction: tx})
+}
+
+func TestReconcileReady(t *testing.T) {
+	tests := []struct {
+		name        string
+		expires     time.Duration // 相对现在的截止时间，0 表示不过期
+		removeNew   bool
+		wantFiles   map[string]string
+		wantPhase   string
+		wantExpired string
+	}{
+		{"等待批准", 0, false, map[string]string{"server": "v1", "server.new": "v2"}, TxReady, ""},
+		{"尚未过期", time.Hour, false, map[string]string{"server": "v1", "server.new": "v2"}, TxReady, ""},
+		{"已过期", -time.Minute, false, map[string]string{"server": "v1"}, TxRolledBack, "1.2.0"},
+		{"新版本文件缺失", 0, true, map[string]string{"server": "v1"}, TxRolledBack, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var expires time.Time
+			if tt.expires != 0 {
+				expires = time.Now().Add(tt.expires)
+			}
+			stageReady(t, dir, expires)
+			if tt.removeNew {
+				os.Remove(filepath.Join(dir, "server.new"))
+			}
+
+			u := newTestUpdater(t, dir, &UpdaterConfig{RequireApproval: true})
+			u.Reconcile()
+
+			if got := readTestFiles(t, dir); !reflect.DeepEqual(got, tt.wantFiles) {
+				t.Errorf("文件 = %v，期望 %v", got, tt.wantFiles)
+			}
+			state := loadTestState(t, dir)
+			if state.Transaction.Phase != tt.wantPhase || state.Expired != tt.wantExpired {
+				t.Errorf("事务阶段 %s，超时版本 %q，期望 %s、%q", state.Transaction.Phase, state.Expired, tt.wantPhase, tt.wantExpired)
+			}
+		})
+	}
+}
+
+func TestApprovalExpiresWithoutUpdateCheck(t *testing.T) {
+	// 没有更新检查（如关闭自动更新）时，等待批准的版本也会在截止时间过期
+	dir := t.TempDir()
+	stageReady(t, dir, time.Now().Add(100*time.Millisecond))
+	u := newTestUpdater(t, dir, &UpdaterConfig{RequireApproval: true})
+	u.Reconcile()
+	if u.readyVersion() != "1.2.0" {
+		t.Fatal("版本应等待批准")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for u.readyVersion() != "" {
+		if time.Now().After(deadline) {
+			t.Fatal("等待批准的版本没有过期")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := readTestFiles(t, dir); !reflect.DeepEqual(got, map[string]string{"server": "v1"}) {
+		t.Errorf("文件 = %v", got)
+	}
+	if status := u.Status(); status.ApprovalExpired != "1.2.0" || status.AwaitingApproval != "" {
+		t.Errorf("状态 = %+v", status)
+	}
+	if _, err := u.Approve(""); err == nil {
+		t.Error("过期后不能再批准")
+	}
+}
+
+func TestExpiredVersionNotDownloadedAgain(t *testing.T) {
+	dir := t.TempDir()
+	stageReady(t, dir, time.Now().Add(-time.Minute))
+	source := &fakeSource{info: UpdateInfo{Version: "1.2.0", DownloadURL: "server"}}
+	u := newTestUpdater(t, dir, &UpdaterConfig{
+		Source:          source,
+		Channel:         ChannelStable,
+		RequireApproval: true,
+		SkipSignature:   true,
+	})
+	u.Reconcile()
+
+	// 超时的版本仍是最新版本时不再下载
+	u.checkForUpdates()
+	u.checkForUpdates()
+	if n := source.downloads(); n != 0 {
+		t.Fatalf("超时的版本下载了 %d 次", n)
+	}
+	if !u.isExpired("v1.2.0") {
+		t.Error("v1.2.0 应视为已超时的版本")
+	}
+
+	// 出现更新的版本后照常下载
+	source.mu.Lock()
+	source.info.Version = "1.3.0"
+	source.mu.Unlock()
+	u.checkForUpdates()
+	if n := source.downloads(); n == 0 {
+		t.Error("更新的版本应该下载")
+	}
+}
+
+func TestApproveAndReject(t *testing.T) {
+	tests := []struct {
+		name      string
+		reject    bool
+		version   string
+		wantErr   bool
+		wantFiles map[string]string
+		wantPhase string
+		blacklist bool
+	}{
+		{"批准", false, "", false, map[string]string{"server": "v1", "server.new": "v2"}, TxVerified, false},
+		{"批准指定版本", false, "v1.2.0", false, map[string]string{"server": "v1", "server.new": "v2"}, TxVerified, false},
+		{"批准的版本不一致", false, "1.3.0", true, map[string]string{"server": "v1", "server.new": "v2"}, TxReady, false},
+		{"拒绝", true, "", false, map[string]string{"server": "v1"}, TxRolledBack, true},
+		{"拒绝的版本不一致", true, "1.3.0", true, map[string]string{"server": "v1", "server.new": "v2"}, TxReady, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			stageReady(t, dir, time.Now().Add(time.Hour))
+			u := newTestUpdater(t, dir, &UpdaterConfig{RequireApproval: true})
+			u.Reconcile()
+
+			var err error
+			if tt.reject {
+				_, err = u.Reject(tt.version, "测试")
+			} else {
+				_, err = u.Approve(tt.version)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("错误 = %v，期望出错: %v", err, tt.wantErr)
+			}
+			if got := readTestFiles(t, dir); !reflect.DeepEqual(got, tt.wantFiles) {
+				t.Errorf("文件 = %v，期望 %v", got, tt.wantFiles)
+			}
+			state := loadTestState(t, dir)
+			if state.Transaction.Phase != tt.wantPhase {
+				t.Errorf("事务阶段 = %s，期望 %s", state.Transaction.Phase, tt.wantPhase)
+			}
+			if state.isBlacklisted("1.2.0") != tt.blacklist {
+				t.Errorf("黑名单 = %v", state.Blacklist)
+			}
+			if tt.wantPhase == TxVerified && !u.HasPendingUpdate() {
+				t.Error("批准后应等待应用")
+			}
+		})
+	}
+}
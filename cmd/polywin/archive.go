@@ -0,0 +1,285 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// 发布产物压缩格式
+const (
+	archiveZip   = "zip"
+	archiveTarGz = "tar.gz"
+	archiveGz    = "gz"
+)
+
+// 解压限制，防止压缩炸弹
+const (
+	defaultMaxExtractSize = 512 << 20 // 解压后总大小上限
+	maxArchiveEntries     = 10000     // 压缩包中的条目数上限
+	maxCompressionRatio   = 200       // zip 条目声明的压缩比上限
+)
+
+// archiveKind 根据文件名判断压缩格式，不是压缩包时返回空字符串
+func archiveKind(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return archiveZip
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return archiveTarGz
+	case strings.HasSuffix(lower, ".gz"):
+		return archiveGz
+	}
+	return ""
+}
+
+// archiveExtraction 从压缩包中提取的文件
+type archiveExtraction struct {
+	Entry      string            // 目标程序在压缩包中的文件名（按文件名匹配，忽略目录）
+	Output     string            // 目标程序的输出路径（.new）
+	Companions map[string]string // 附带文件名 -> 输出路径，压缩包中没有的附带文件忽略
+	MaxSize    int64             // 解压后总大小上限
+}
+
+// extractArchive 从压缩包中提取目标程序和附带文件
+// 所有条目的路径都必须安全（不能是绝对路径、不能包含 ..），输出路径只由 Output/Companions 决定，
+// 解压大小按实际写入的字节数限制，不信任压缩包中声明的大小
+func extractArchive(kind, archivePath string, x archiveExtraction) error {
+	if x.MaxSize <= 0 {
+		x.MaxSize = defaultMaxExtractSize
+	}
+	budget := &extractBudget{remaining: x.MaxSize}
+
+	var err error
+	switch kind {
+	case archiveZip:
+		err = extractZip(archivePath, x, budget)
+	case archiveTarGz:
+		err = extractTarGz(archivePath, x, budget)
+	case archiveGz:
+		err = extractGz(archivePath, x, budget)
+	default:
+		err = fmt.Errorf("不支持的压缩格式: %s", kind)
+	}
+	if err != nil {
+		os.Remove(x.Output)
+		for _, out := range x.Companions {
+			os.Remove(out)
+		}
+		return err
+	}
+	return nil
+}
+
+// extractZip 解压 zip
+func extractZip(archivePath string, x archiveExtraction, budget *extractBudget) error {
+	r, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return fmt.Errorf("打开 zip 失败: %v", err)
+	}
+	defer r.Close()
+
+	if len(r.File) > maxArchiveEntries {
+		return fmt.Errorf("压缩包条目过多（%d 个）", len(r.File))
+	}
+
+	found := false
+	for _, f := range r.File {
+		if err := checkEntryName(f.Name); err != nil {
+			return err
+		}
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		out := x.outputFor(f.Name)
+		if out == "" {
+			continue
+		}
+		if f.CompressedSize64 > 0 && f.UncompressedSize64/f.CompressedSize64 > maxCompressionRatio {
+			return fmt.Errorf("%s 的压缩比异常（%d -> %d 字节）", f.Name, f.CompressedSize64, f.UncompressedSize64)
+		}
+		if f.UncompressedSize64 > uint64(budget.remaining) {
+			return fmt.Errorf("%s 解压后 %d 字节，超过上限", f.Name, f.UncompressedSize64)
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("读取 %s 失败: %v", f.Name, err)
+		}
+		err = budget.extract(rc, out, f.Name)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		if out == x.Output {
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("压缩包中没有 %s", x.Entry)
+	}
+	return nil
+}
+
+// extractTarGz 解压 tar.gz
+func extractTarGz(archivePath string, x archiveExtraction, budget *extractBudget) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("打开 gzip 失败: %v", err)
+	}
+	defer gz.Close()
+
+	// 跳过的条目同样需要解压，整个 tar 流按总大小上限计算
+	stream := &limitedStream{r: gz, remaining: x.MaxSize + 1<<20}
+	tr := tar.NewReader(stream)
+
+	found := false
+	for entries := 0; ; entries++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if stream.exceeded() {
+				return fmt.Errorf("压缩包解压后超过上限 %d 字节", x.MaxSize)
+			}
+			return fmt.Errorf("读取 tar 失败: %v", err)
+		}
+		if entries >= maxArchiveEntries {
+			return fmt.Errorf("压缩包条目过多")
+		}
+		if err := checkEntryName(hdr.Name); err != nil {
+			return err
+		}
+		// 只提取普通文件，符号链接、硬链接、设备文件等一律忽略
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		out := x.outputFor(hdr.Name)
+		if out == "" {
+			continue
+		}
+		if hdr.Size > budget.remaining {
+			return fmt.Errorf("%s 解压后 %d 字节，超过上限", hdr.Name, hdr.Size)
+		}
+		if err := budget.extract(tr, out, hdr.Name); err != nil {
+			return err
+		}
+		if out == x.Output {
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("压缩包中没有 %s", x.Entry)
+	}
+	return nil
+}
+
+// extractGz 解压单个 gzip 文件，内容即目标程序
+func extractGz(archivePath string, x archiveExtraction, budget *extractBudget) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("打开 gzip 失败: %v", err)
+	}
+	defer gz.Close()
+
+	return budget.extract(gz, x.Output, x.Entry)
+}
+
+// outputFor 返回条目对应的输出路径，不需要提取时返回空字符串
+func (x archiveExtraction) outputFor(name string) string {
+	base := path.Base(name)
+	if base == x.Entry {
+		return x.Output
+	}
+	return x.Companions[base]
+}
+
+// checkEntryName 检查条目路径，拒绝绝对路径和路径穿越
+func checkEntryName(name string) error {
+	if name == "" || strings.ContainsRune(name, 0) {
+		return fmt.Errorf("压缩包中有无效的文件名")
+	}
+	slashed := strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(slashed, "/") || filepath.VolumeName(name) != "" || (len(slashed) >= 2 && slashed[1] == ':') {
+		return fmt.Errorf("压缩包中有绝对路径: %s", name)
+	}
+	for _, part := range strings.Split(slashed, "/") {
+		if part == ".." {
+			return fmt.Errorf("压缩包中有路径穿越: %s", name)
+		}
+	}
+	return nil
+}
+
+// extractBudget 解压大小预算，所有提取的文件共用
+type extractBudget struct {
+	remaining int64
+}
+
+// extract 将条目内容写入 out，超过预算时中止
+func (b *extractBudget) extract(r io.Reader, out, name string) error {
+	f, err := os.OpenFile(out, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return fmt.Errorf("创建文件失败: %v", err)
+	}
+
+	n, err := io.Copy(f, io.LimitReader(r, b.remaining+1))
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("解压 %s 失败: %v", name, err)
+	}
+	if n > b.remaining {
+		return fmt.Errorf("%s 解压后超过上限", name)
+	}
+	b.remaining -= n
+
+	log.Printf("已解压 %s（%d 字节）", name, n)
+	return nil
+}
+
+// limitedStream 限制读取的总字节数，超过后返回错误
+type limitedStream struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (s *limitedStream) Read(p []byte) (int, error) {
+	if s.remaining <= 0 {
+		return 0, fmt.Errorf("超过解压上限")
+	}
+	if int64(len(p)) > s.remaining {
+		p = p[:s.remaining]
+	}
+	n, err := s.r.Read(p)
+	s.remaining -= int64(n)
+	return n, err
+}
+
+// exceeded 是否已超过上限
+func (s *limitedStream) exceeded() bool {
+	return s.remaining <= 0
+}
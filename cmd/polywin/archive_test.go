@@ -0,0 +1,226 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testEntry 测试压缩包中的条目
+type testEntry struct {
+	name string
+	data []byte
+	link bool // tar 中写为符号链接
+}
+
+// writeTestZip 生成 zip 压缩包
+func writeTestZip(t *testing.T, path string, entries []testEntry) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: e.name, Method: zip.Deflate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(e.data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTestTarGz 生成 tar.gz 压缩包
+func writeTestTarGz(t *testing.T, path string, entries []testEntry) {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0755, Size: int64(len(e.data)), Typeflag: tar.TypeReg}
+		if e.link {
+			hdr = &tar.Header{Name: e.name, Linkname: string(e.data), Typeflag: tar.TypeSymlink}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if !e.link {
+			tw.Write(e.data)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	gz.Close()
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTestGz 生成单个文件的 gzip
+func writeTestGz(t *testing.T, path string, data []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(data)
+	gz.Close()
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckEntryName(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"server", true},
+		{"bin/server", true},
+		{"./server", true},
+		{"a..b/server", true},
+		{"", false},
+		{"../server", false},
+		{"bin/../../server", false},
+		{`..\server`, false},
+		{`bin\..\..\server`, false},
+		{"/etc/passwd", false},
+		{`\Windows\server.exe`, false},
+		{`C:\server.exe`, false},
+		{"C:/server.exe", false},
+		{"ser\x00ver", false},
+	}
+	for _, tt := range tests {
+		err := checkEntryName(tt.name)
+		if (err == nil) != tt.ok {
+			t.Errorf("checkEntryName(%q) = %v，期望通过: %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestExtractArchive(t *testing.T) {
+	many := make([]testEntry, maxArchiveEntries+1)
+	for i := range many {
+		many[i] = testEntry{name: "f" + strconv.Itoa(i)}
+	}
+	many[0] = testEntry{name: "server", data: []byte("binary")}
+
+	tests := []struct {
+		name    string
+		kind    string
+		entries []testEntry
+		maxSize int64
+		wantErr string // 为空表示成功
+	}{
+		{"zip", archiveZip, []testEntry{{name: "dist/server", data: []byte("binary")}, {name: "dist/config.json", data: []byte("{}")}, {name: "README.md", data: []byte("x")}}, 0, ""},
+		{"tar.gz", archiveTarGz, []testEntry{{name: "dist/server", data: []byte("binary")}, {name: "config.json", data: []byte("{}")}}, 0, ""},
+		{"tar.gz 忽略符号链接", archiveTarGz, []testEntry{{name: "server", data: []byte("/etc/passwd"), link: true}, {name: "dist/server", data: []byte("binary")}}, 0, ""},
+		{"缺少目标程序", archiveZip, []testEntry{{name: "other", data: []byte("x")}}, 0, "压缩包中没有"},
+		{"zip 路径穿越", archiveZip, []testEntry{{name: "../server", data: []byte("binary")}}, 0, "路径穿越"},
+		{"tar.gz 路径穿越", archiveTarGz, []testEntry{{name: "dist/../../server", data: []byte("binary")}}, 0, "路径穿越"},
+		{"zip 绝对路径", archiveZip, []testEntry{{name: "/usr/bin/server", data: []byte("binary")}}, 0, "绝对路径"},
+		{"tar.gz 绝对路径", archiveTarGz, []testEntry{{name: "/usr/bin/server", data: []byte("binary")}}, 0, "绝对路径"},
+		{"zip 压缩比异常", archiveZip, []testEntry{{name: "server", data: make([]byte, 4<<20)}}, 0, "压缩比异常"},
+		{"zip 超过大小上限", archiveZip, []testEntry{{name: "server", data: incompressible(8 << 10)}}, 4 << 10, "超过上限"},
+		{"tar.gz 超过大小上限", archiveTarGz, []testEntry{{name: "server", data: incompressible(8 << 10)}}, 4 << 10, "超过上限"},
+		{"tar.gz 跳过的条目计入上限", archiveTarGz, []testEntry{{name: "padding", data: make([]byte, 2<<20)}, {name: "server", data: []byte("binary")}}, 4 << 10, "超过上限"},
+		{"多个文件共用上限", archiveZip, []testEntry{{name: "server", data: incompressible(3 << 10)}, {name: "config.json", data: incompressible(3 << 10)}}, 4 << 10, "超过上限"},
+		{"zip 条目过多", archiveZip, many, 0, "条目过多"},
+		{"tar.gz 条目过多", archiveTarGz, many, 0, "条目过多"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			archive := filepath.Join(dir, "release")
+			if tt.kind == archiveZip {
+				writeTestZip(t, archive, tt.entries)
+			} else {
+				writeTestTarGz(t, archive, tt.entries)
+			}
+
+			x := archiveExtraction{
+				Entry:      "server",
+				Output:     filepath.Join(dir, "server.new"),
+				Companions: map[string]string{"config.json": filepath.Join(dir, "config.json.new")},
+				MaxSize:    tt.maxSize,
+			}
+			err := extractArchive(tt.kind, archive, x)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("extractArchive = %v，期望包含 %q 的错误", err, tt.wantErr)
+				}
+				// 失败时不留下部分提取的文件
+				for _, out := range []string{x.Output, x.Companions["config.json"]} {
+					if _, err := os.Stat(out); err == nil {
+						t.Errorf("失败后仍有 %s", filepath.Base(out))
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("extractArchive: %v", err)
+			}
+			if data, _ := os.ReadFile(x.Output); string(data) != "binary" {
+				t.Errorf("目标程序内容为 %q", data)
+			}
+			entries, _ := os.ReadDir(dir)
+			for _, e := range entries {
+				if name := e.Name(); name != "release" && name != "server.new" && name != "config.json.new" {
+					t.Errorf("提取了不需要的文件 %s", name)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractGz(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		maxSize int64
+		ok      bool
+	}{
+		{"正常", []byte("binary"), 0, true},
+		{"超过大小上限", make([]byte, 64<<10), 4 << 10, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			archive := filepath.Join(dir, "server.gz")
+			writeTestGz(t, archive, tt.data)
+
+			x := archiveExtraction{Entry: "server", Output: filepath.Join(dir, "server.new"), MaxSize: tt.maxSize}
+			err := extractArchive(archiveGz, archive, x)
+			if (err == nil) != tt.ok {
+				t.Fatalf("extractArchive = %v，期望成功: %v", err, tt.ok)
+			}
+			if _, statErr := os.Stat(x.Output); (statErr == nil) != tt.ok {
+				t.Errorf("输出文件存在: %v，期望: %v", statErr == nil, tt.ok)
+			}
+		})
+	}
+}
+
+func TestArchiveKind(t *testing.T) {
+	tests := map[string]string{
+		"server_linux_amd64.zip":    archiveZip,
+		"server_linux_amd64.TAR.GZ": archiveTarGz,
+		"server.tgz":                archiveTarGz,
+		"server.gz":                 archiveGz,
+		"server.exe":                "",
+		"server":                    "",
+	}
+	for name, want := range tests {
+		if got := archiveKind(name); got != want {
+			t.Errorf("archiveKind(%q) = %q，期望 %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"debug/buildinfo"
+	"fmt"
+	"strings"
+)
+
+// BuildPolicy 安装前对候选程序 Go 构建信息（debug/buildinfo）的要求
+type BuildPolicy struct {
+	Module              string   // 主模块路径，为空时不检查
+	Package             string   // main 包路径，为空时不检查
+	MinGoVersion        string   // 最低 Go 工具链版本（如 go1.21），为空时不检查
+	RequireRevision     bool     // 必须包含 VCS 提交，且构建时没有未提交的修改
+	VersionVar          string   // -ldflags -X 写入版本号的变量（如 main.serverVersion），与待安装版本不一致时拒绝
+	RequireVersionStamp bool     // 必须通过 -ldflags 写入版本号
+	Deny                []string // 拒绝的模块版本：module@version，或只写 module 拒绝所有版本
+}
+
+// BuildStamp 从程序中读取的构建信息摘要
+type BuildStamp struct {
+	Module    string // 主模块路径
+	Package   string // main 包路径
+	GoVersion string // Go 工具链版本
+	Revision  string // VCS 提交
+	Modified  bool   // 构建时工作区有未提交的修改
+	Version   string // -ldflags -X 写入的版本号
+
+	deps map[string]string // 依赖模块路径 -> 版本（含主模块）
+}
+
+// Commit 返回用于记录的提交标识，工作区有修改时加 -dirty 后缀
+func (s *BuildStamp) Commit() string {
+	if s == nil || s.Revision == "" {
+		return ""
+	}
+	if s.Modified {
+		return s.Revision + "-dirty"
+	}
+	return s.Revision
+}
+
+// enabled 是否配置了任何检查
+func (p *BuildPolicy) enabled() bool {
+	return p != nil && (p.Module != "" || p.Package != "" || p.MinGoVersion != "" ||
+		p.RequireRevision || p.RequireVersionStamp || len(p.Deny) > 0)
+}
+
+// Check 读取 path 的构建信息并按策略检查，version 为待安装的版本（可以为空）
+// 没有配置任何检查时不要求程序包含构建信息，读取失败时返回 nil
+func (p *BuildPolicy) Check(path, version string) (*BuildStamp, error) {
+	versionVar := ""
+	if p != nil {
+		versionVar = p.VersionVar
+	}
+	stamp, err := readBuildStamp(path, versionVar)
+	if !p.enabled() {
+		return stamp, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取 Go 构建信息失败（程序不是 Go 构建或已被 UPX 等压缩）: %v", err)
+	}
+
+	if p.Module != "" && stamp.Module != p.Module {
+		return stamp, fmt.Errorf("主模块为 %q，期望 %q", stamp.Module, p.Module)
+	}
+	if p.Package != "" && stamp.Package != p.Package {
+		return stamp, fmt.Errorf("main 包为 %q，期望 %q", stamp.Package, p.Package)
+	}
+	if p.MinGoVersion != "" {
+		min, _ := parseGoVersion(p.MinGoVersion) // 已在配置校验中检查
+		got, err := parseGoVersion(stamp.GoVersion)
+		if err != nil {
+			return stamp, fmt.Errorf("无法识别 Go 版本 %q", stamp.GoVersion)
+		}
+		if got.Compare(min) < 0 {
+			return stamp, fmt.Errorf("Go 版本 %s 低于要求的 %s", stamp.GoVersion, p.MinGoVersion)
+		}
+	}
+	if p.RequireRevision {
+		if stamp.Revision == "" {
+			return stamp, fmt.Errorf("构建信息中没有 VCS 提交")
+		}
+		if stamp.Modified {
+			return stamp, fmt.Errorf("提交 %s 构建时有未提交的修改", stamp.Revision)
+		}
+	}
+	if p.VersionVar != "" {
+		switch {
+		case stamp.Version == "" && p.RequireVersionStamp:
+			return stamp, fmt.Errorf("没有通过 -ldflags 写入 %s", p.VersionVar)
+		case stamp.Version != "" && version != "" && !sameVersion(stamp.Version, version):
+			return stamp, fmt.Errorf("程序中的版本号 %s 与发布版本 %s 不一致", stamp.Version, version)
+		}
+	}
+	for _, rule := range p.Deny {
+		module, denied, _ := strings.Cut(rule, "@")
+		got, ok := stamp.deps[module]
+		if ok && (denied == "" || sameVersion(got, denied)) {
+			return stamp, fmt.Errorf("模块 %s@%s 在拒绝列表中", module, got)
+		}
+	}
+	return stamp, nil
+}
+
+// readBuildStamp 读取程序的 Go 构建信息，versionVar 非空时从 -ldflags 中取出该变量的值
+func readBuildStamp(path, versionVar string) (*BuildStamp, error) {
+	info, err := buildinfo.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	stamp := &BuildStamp{
+		Module:    info.Main.Path,
+		Package:   info.Path,
+		GoVersion: info.GoVersion,
+		deps:      map[string]string{info.Main.Path: info.Main.Version},
+	}
+	for _, dep := range info.Deps {
+		if dep.Replace != nil {
+			dep = dep.Replace
+		}
+		stamp.deps[dep.Path] = dep.Version
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			stamp.Revision = s.Value
+		case "vcs.modified":
+			stamp.Modified = s.Value == "true"
+		case "-ldflags":
+			if versionVar != "" {
+				stamp.Version = ldflagsValue(s.Value, versionVar)
+			}
+		}
+	}
+	return stamp, nil
+}
+
+// ldflagsValue 从 -ldflags 中取出 -X name=value 的值
+func ldflagsValue(ldflags, name string) string {
+	fields := strings.Fields(ldflags)
+	for i, f := range fields {
+		def := ""
+		switch {
+		case f == "-X" && i+1 < len(fields):
+			def = fields[i+1]
+		case strings.HasPrefix(f, "-X="):
+			def = strings.TrimPrefix(f, "-X=")
+		}
+		if v, ok := strings.CutPrefix(strings.Trim(def, `'"`), name+"="); ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// parseGoVersion 解析 Go 工具链版本，如 go1.21.5、go1.22rc1（预发布按正式版本比较）
+func parseGoVersion(s string) (Version, error) {
+	if fields := strings.Fields(s); len(fields) > 0 {
+		s = fields[0] // 去掉 " X:..." 等实验特性后缀
+	}
+	s = strings.TrimPrefix(s, "go")
+	end := 0
+	for end < len(s) && (s[end] == '.' || s[end] >= '0' && s[end] <= '9') {
+		end++
+	}
+	return ParseVersion(strings.TrimSuffix(s[:end], "."))
+}
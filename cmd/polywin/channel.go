@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 发布通道，按接收的版本范围从小到大排列：订阅某个通道时也接收更稳定通道的版本
+const (
+	ChannelStable = "stable" // 只接收正式版本
+	ChannelBeta   = "beta"   // 另外接收 beta / rc 等预发布版本
+	ChannelCanary = "canary" // 接收所有版本，包括 alpha / canary / nightly 构建
+)
+
+// channelRanks 通道的稳定程度，数值越大越不稳定
+var channelRanks = map[string]int{
+	ChannelStable: 0,
+	ChannelBeta:   1,
+	ChannelCanary: 2,
+}
+
+// channelOrder 从稳定到不稳定的通道顺序，版本号无法比较时优先选择更稳定的通道
+var channelOrder = []string{ChannelStable, ChannelBeta, ChannelCanary}
+
+// canaryPrereleases 归入 canary 通道的预发布标识，其他预发布标识归入 beta
+var canaryPrereleases = map[string]bool{
+	"alpha":    true,
+	"canary":   true,
+	"dev":      true,
+	"nightly":  true,
+	"snapshot": true,
+}
+
+// validateChannel 检查通道名称
+func validateChannel(channel string) error {
+	if _, ok := channelRanks[channel]; !ok {
+		return fmt.Errorf("未知的发布通道: %s（可选 stable / beta / canary）", channel)
+	}
+	return nil
+}
+
+// channelAllows 订阅 subscribed 通道时是否接收 release 通道的版本，release 为空视为 stable
+func channelAllows(subscribed, release string) bool {
+	if release == "" {
+		release = ChannelStable
+	}
+	r, ok := channelRanks[release]
+	return ok && r <= channelRanks[subscribed]
+}
+
+// versionChannel 根据版本号判断所属通道：正式版本为 stable，
+// 预发布版本按第一个标识区分（alpha / canary / dev / nightly / snapshot 为 canary，其他为 beta）
+// 无法解析的版本号（如提交哈希）视为 stable
+func versionChannel(version string) string {
+	v, err := ParseVersion(version)
+	if err != nil || !v.IsPrerelease() {
+		return ChannelStable
+	}
+	if canaryPrereleases[strings.ToLower(v.Prerelease[0])] {
+		return ChannelCanary
+	}
+	return ChannelBeta
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+// checksumsFileName 与发布产物一起发布的校验和文件（sha256sum 输出格式）
+const checksumsFileName = "checksums.txt"
+
+// Checksum 文件校验和
+type Checksum struct {
+	Algorithm string // sha256 / sha512
+	Sum       []byte
+}
+
+// ParseChecksum 解析校验和，支持 "sha256:<hex>"、"sha512:<hex>" 和按长度识别算法的纯十六进制
+func ParseChecksum(s string) (*Checksum, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+
+	algo := ""
+	if i := strings.IndexAny(s, ":="); i > 0 {
+		algo = strings.ToLower(strings.ReplaceAll(s[:i], "-", ""))
+		s = s[i+1:]
+	}
+
+	sum, err := hex.DecodeString(strings.ToLower(s))
+	if err != nil {
+		return nil, fmt.Errorf("无效的校验和: %v", err)
+	}
+
+	if algo == "" {
+		switch len(sum) {
+		case sha256.Size:
+			algo = "sha256"
+		case sha512.Size:
+			algo = "sha512"
+		default:
+			return nil, fmt.Errorf("无法识别校验和算法（长度 %d 字节）", len(sum))
+		}
+	}
+
+	c := &Checksum{Algorithm: algo, Sum: sum}
+	h, err := c.newHash()
+	if err != nil {
+		return nil, err
+	}
+	if len(sum) != h.Size() {
+		return nil, fmt.Errorf("%s 校验和长度应为 %d 字节，实际 %d 字节", algo, h.Size(), len(sum))
+	}
+	return c, nil
+}
+
+// newHash 创建对应算法的哈希
+func (c *Checksum) newHash() (hash.Hash, error) {
+	switch c.Algorithm {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	default:
+		return nil, fmt.Errorf("不支持的校验和算法: %s", c.Algorithm)
+	}
+}
+
+// Verify 校验计算出的摘要
+func (c *Checksum) Verify(sum []byte) error {
+	if !bytes.Equal(c.Sum, sum) {
+		return fmt.Errorf("%s 校验和不匹配: 期望 %x，实际 %x", c.Algorithm, c.Sum, sum)
+	}
+	return nil
+}
+
+// String 返回 "算法:十六进制" 格式
+func (c *Checksum) String() string {
+	return c.Algorithm + ":" + hex.EncodeToString(c.Sum)
+}
+
+// VerifyFile 计算文件摘要并校验
+func (c *Checksum) VerifyFile(path string) error {
+	h, err := c.newHash()
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("读取文件失败: %v", err)
+	}
+	return c.Verify(h.Sum(nil))
+}
+
+// findChecksum 从 checksums.txt 中查找指定文件的校验和
+// 支持 sha256sum/sha512sum 输出格式："<hex>  <name>" 或 "<hex> *<name>"
+func findChecksum(data []byte, name string) (*Checksum, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		file := strings.TrimPrefix(fields[1], "*")
+		if file == name {
+			return ParseChecksum(fields[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("%s 中没有 %s 的校验和", checksumsFileName, name)
+}
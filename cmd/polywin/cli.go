@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// runVersionsCommand 执行 polywin versions [配置参数]，通过控制接口列出版本库中的版本
+func runVersionsCommand(args []string) error {
+	cfg, err := LoadConfig(args)
+	if err != nil {
+		return err
+	}
+
+	var resp struct {
+		Versions []*VersionRecord `json:"versions"`
+	}
+	if err := controlRequest(cfg, http.MethodGet, "/versions", nil, &resp); err != nil {
+		return err
+	}
+	if len(resp.Versions) == 0 {
+		fmt.Println("版本库中没有版本")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\t版本\t校验和\t大小（字节）\t安装时间\t来源")
+	for _, rec := range resp.Versions {
+		mark := ""
+		if rec.Current {
+			mark = "*"
+		}
+		sum := strings.TrimPrefix(rec.Checksum, "sha256:")
+		if len(sum) > 12 {
+			sum = sum[:12]
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", mark, rec, sum, rec.Size,
+			rec.InstalledAt.Local().Format("2006-01-02 15:04:05"), rec.Source)
+	}
+	return w.Flush()
+}
+
+// runRollbackCommand 执行 polywin rollback --to <版本号或校验和> [配置参数]，通过控制接口切换版本
+func runRollbackCommand(args []string) error {
+	to, rest, err := cutFlag(args, "to")
+	if err != nil {
+		return err
+	}
+	if to == "" {
+		return fmt.Errorf("用法: polywin rollback --to <版本号或校验和> [配置参数]")
+	}
+
+	cfg, err := LoadConfig(rest)
+	if err != nil {
+		return err
+	}
+
+	var resp struct {
+		Version *VersionRecord `json:"version"`
+	}
+	if err := controlRequest(cfg, http.MethodPost, "/rollback", map[string]string{"to": to}, &resp); err != nil {
+		return err
+	}
+	fmt.Printf("已切换到版本 %s，守护程序将重启目标程序\n", resp.Version)
+	return nil
+}
+
+// runApprovalCommand 执行 polywin approve [--version <版本>] 或 polywin reject [--version <版本>] [--reason <原因>]，
+// 通过控制接口批准或拒绝等待批准的版本
+func runApprovalCommand(command string, args []string) error {
+	version, args, err := cutFlag(args, "version")
+	if err != nil {
+		return err
+	}
+	reason := ""
+	if command == "reject" {
+		if reason, args, err = cutFlag(args, "reason"); err != nil {
+			return err
+		}
+	}
+
+	cfg, err := LoadConfig(args)
+	if err != nil {
+		return err
+	}
+
+	var resp struct {
+		Version string `json:"version"`
+	}
+	body := map[string]string{"version": version, "reason": reason}
+	if err := controlRequest(cfg, http.MethodPost, "/"+command, body, &resp); err != nil {
+		return err
+	}
+	if command == "reject" {
+		fmt.Printf("已拒绝版本 %s，该版本已加入黑名单\n", resp.Version)
+	} else {
+		fmt.Printf("已批准版本 %s，守护程序将按应用策略替换目标程序\n", resp.Version)
+	}
+	return nil
+}
+
+// cutFlag 从参数中取出子命令自己的参数 --name <值>（也支持 -name 和 --name=<值>），其余参数用于加载配置
+func cutFlag(args []string, name string) (string, []string, error) {
+	value := ""
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--"+name || arg == "-"+name:
+			if i+1 >= len(args) {
+				return "", nil, fmt.Errorf("%s 后缺少参数值", arg)
+			}
+			value = args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--"+name+"="), strings.HasPrefix(arg, "-"+name+"="):
+			value = arg[strings.Index(arg, "=")+1:]
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return value, rest, nil
+}
+
+// controlRequest 向运行中的守护程序的控制接口发送请求，修改状态的请求携带控制接口令牌
+func controlRequest(cfg *Config, method, path string, body, out interface{}) error {
+	if cfg.Control.Addr == "" {
+		return fmt.Errorf("没有配置控制接口（control.addr），无法连接守护程序")
+	}
+	host, port, err := net.SplitHostPort(cfg.Control.Addr)
+	if err != nil {
+		return fmt.Errorf("control.addr 无效: %v", err)
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	url := "http://" + net.JoinHostPort(host, port) + path
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return err
+	}
+	if method != http.MethodGet {
+		token, err := loadControlToken(cfg, false)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("连接守护程序失败（守护程序是否在运行？）: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("读取响应失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &e) == nil && e.Error != "" {
+			return fmt.Errorf("%s", e.Error)
+		}
+		return fmt.Errorf("守护程序返回 %s", resp.Status)
+	}
+	return json.Unmarshal(data, out)
+}
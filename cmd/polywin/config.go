@@ -0,0 +1,1061 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 配置加载顺序：默认值 -> 配置文件（含 profile 覆盖）-> 环境变量 -> 命令行参数
+// 后加载的来源覆盖先加载的来源
+
+const envPrefix = "POLYWIN_"
+
+// 默认配置文件名（在可执行文件目录中按顺序查找）
+var defaultConfigFiles = []string{"polywin.json", "polywin.toml"}
+
+// Duration 支持 "30s"、"5m" 字符串或整数秒的时间间隔
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON 解析时间间隔
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		v, err := parseDuration(s)
+		if err != nil {
+			return err
+		}
+		d.Duration = v
+		return nil
+	}
+
+	var n float64
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("无效的时间间隔: %s", string(data))
+	}
+	d.Duration = time.Duration(n * float64(time.Second))
+	return nil
+}
+
+// MarshalJSON 输出时间间隔字符串
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.Duration.String())
+}
+
+// ByteSize 支持 "200MB"、"1GiB" 字符串或整数字节数的大小
+type ByteSize int64
+
+// byteUnits 大小单位（十进制和二进制单位都按 1024 计算）
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30},
+	{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30},
+	{"B", 1},
+}
+
+// UnmarshalJSON 解析大小
+func (b *ByteSize) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		v, err := parseByteSize(s)
+		if err != nil {
+			return err
+		}
+		*b = v
+		return nil
+	}
+
+	var n int64
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("无效的大小: %s", string(data))
+	}
+	*b = ByteSize(n)
+	return nil
+}
+
+// parseByteSize 解析带单位的大小
+func parseByteSize(s string) (ByteSize, error) {
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	mult := int64(1)
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(upper, unit.suffix) {
+			upper = strings.TrimSpace(strings.TrimSuffix(upper, unit.suffix))
+			mult = unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(upper, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("无效的大小: %s", s)
+	}
+	return ByteSize(n * float64(mult)), nil
+}
+
+// Config 守护程序配置
+type Config struct {
+	RepoURL       string   `json:"repo_url"`
+	UpdateURL     string   `json:"update_url"`
+	Target        string   `json:"target"`
+	CheckInterval Duration `json:"check_interval"`
+	AutoUpdate    bool     `json:"auto_update"`
+
+	Channel        string `json:"channel"`         // 发布通道：stable / beta / canary
+	AllowDowngrade bool   `json:"allow_downgrade"` // 已安装版本不属于订阅通道时，允许降级到订阅通道的最新版本
+
+	VersionConstraint string   `json:"version_constraint"` // 只安装满足约束的版本，如 ~1.4、^1.4.2、>=1.2 <1.5
+	SkipVersions      []string `json:"skip_versions"`      // 不安装的版本
+
+	MaxDownloadSize ByteSize `json:"max_download_size"` // 下载文件大小上限
+	RequireChecksum bool     `json:"require_checksum"`  // 没有可用校验和时拒绝更新
+
+	Download DownloadConfig `json:"download"`
+
+	Signing SigningConfig `json:"signing"`
+
+	Restart RestartConfig `json:"restart"`
+	Stop    StopConfig    `json:"stop"`
+	Apply   ApplyConfig   `json:"apply"`
+
+	HealthCheck HealthCheckConfig `json:"health_check"`
+	Probation   ProbationConfig   `json:"probation"`
+	Versions    VersionsConfig    `json:"versions"`
+	Control     ControlConfig     `json:"control"`
+
+	TargetVersion TargetVersionConfig `json:"target_version"`
+	Source        SourceConfig        `json:"source"`
+	GitHub        GitHubConfig        `json:"github"`
+	BuildPolicy   BuildPolicyConfig   `json:"build_policy"`
+
+	// 以下字段不来自配置文件
+	Profile    string `json:"-"` // 生效的 profile 名称
+	ConfigFile string `json:"-"` // 实际加载的配置文件路径
+	TargetPath string `json:"-"` // 解析后的目标程序完整路径
+}
+
+// DownloadConfig 下载配置
+type DownloadConfig struct {
+	Retries     int      `json:"retries"`      // 失败后的重试次数
+	RetryDelay  Duration `json:"retry_delay"`  // 首次重试等待时间，之后每次翻倍
+	IdleTimeout Duration `json:"idle_timeout"` // 在该时间内没有收到数据则中止并重试
+	Parallel    int      `json:"parallel"`     // 并行分块数，1 表示不分块
+	ChunkSize   ByteSize `json:"chunk_size"`   // 每个分块的最小大小
+	Delta       bool     `json:"delta"`        // 有增量补丁时优先下载补丁
+}
+
+// SigningConfig 发布产物签名校验配置
+type SigningConfig struct {
+	PublicKeys         []string `json:"public_keys"`          // minisign/signify 公钥，与编译时嵌入的公钥合并
+	InsecureSkipVerify bool     `json:"insecure_skip_verify"` // 不校验签名，没有配置公钥时也允许启动
+}
+
+// RestartConfig 目标程序重启策略配置
+type RestartConfig struct {
+	Policy        string   `json:"policy"`         // always / on-failure / never
+	InitialDelay  Duration `json:"initial_delay"`  // 首次重启等待时间
+	MaxDelay      Duration `json:"max_delay"`      // 指数退避上限
+	Multiplier    float64  `json:"multiplier"`     // 退避倍数
+	Jitter        float64  `json:"jitter"`         // 随机抖动比例（0~1）
+	MaxRestarts   int      `json:"max_restarts"`   // 时间窗口内允许的最大重启次数，0 表示不限制
+	Window        Duration `json:"window"`         // 崩溃循环检测窗口
+	HealthyUptime Duration `json:"healthy_uptime"` // 持续运行超过该时间后重置退避
+}
+
+// StopConfig 目标程序停止方式配置
+type StopConfig struct {
+	Signal  string   `json:"signal"`  // 停止信号，默认 SIGTERM
+	Timeout Duration `json:"timeout"` // 等待目标程序退出的宽限期，超时后强制结束
+}
+
+// ApplyConfig 新版本就绪后替换目标程序的策略配置
+type ApplyConfig struct {
+	Strategy       string   `json:"strategy"`        // immediate / on-next-exit / window
+	Window         string   `json:"window"`          // 维护窗口开始时间（cron 表达式，本地时间），如 0 2 * * *
+	WindowDuration Duration `json:"window_duration"` // 维护窗口时长
+
+	RequireApproval bool     `json:"require_approval"` // 新版本下载并校验后等待批准，不自动替换
+	ApprovalTTL     Duration `json:"approval_ttl"`     // 等待批准的有效期，0 表示不过期
+}
+
+// HealthCheckConfig 目标程序健康检查配置
+type HealthCheckConfig struct {
+	Type             string   `json:"type"`              // http / tcp / exec / none
+	URL              string   `json:"url"`               // http: 请求地址
+	ExpectedStatus   int      `json:"expected_status"`   // http: 期望状态码，默认 200
+	ExpectedBody     string   `json:"expected_body"`     // http: 响应中必须包含的内容
+	Address          string   `json:"address"`           // tcp: host:port
+	Command          []string `json:"command"`           // exec: 命令及参数
+	Interval         Duration `json:"interval"`          // 检查间隔
+	Timeout          Duration `json:"timeout"`           // 单次检查超时
+	StartPeriod      Duration `json:"start_period"`      // 启动宽限期
+	FailureThreshold int      `json:"failure_threshold"` // 连续失败阈值
+}
+
+// ProbationConfig 更新后试运行配置
+type ProbationConfig struct {
+	Window         Duration `json:"window"`          // 试运行时长，0 表示不试运行
+	RequireHealthy bool     `json:"require_healthy"` // 配置了健康检查时必须在窗口内通过
+	VersionURL     string   `json:"version_url"`     // 查询运行版本的地址，为空不校验
+	VersionField   string   `json:"version_field"`   // 版本字段路径，默认 version
+}
+
+// SourceConfig 更新源配置
+type SourceConfig struct {
+	Type     string `json:"type"`     // auto / github / manifest / directory
+	Dir      string `json:"dir"`      // directory: 发布目录（本地目录或网络共享）
+	Manifest string `json:"manifest"` // directory: 目录中的版本信息文件名，为空时按文件变化判断
+	Asset    string `json:"asset"`    // 发布产物文件名，支持 {name} {os} {arch} {ext} 占位符；.zip / .tar.gz / .gz 会自动解压
+
+	ArchiveEntry   string   `json:"archive_entry"`    // 压缩包中目标程序的文件名，默认与目标程序同名
+	Companions     []string `json:"companions"`       // 随目标程序一起从压缩包中提取的附带文件（如配置模板、DLL）
+	MaxExtractSize ByteSize `json:"max_extract_size"` // 解压后的总大小上限
+}
+
+// GitHubConfig github-api 更新源配置
+type GitHubConfig struct {
+	APIURL       string `json:"api_url"`       // API 地址，默认 https://api.github.com（GitHub Enterprise 为 https://<host>/api/v3）
+	Token        string `json:"token"`         // 访问令牌，访问私有仓库时必须配置
+	AssetPattern string `json:"asset_pattern"` // 发布产物名称模式（如 server_{os}_{arch}*），默认等于 source.asset
+}
+
+// BuildPolicyConfig 安装前对候选程序 Go 构建信息的要求
+type BuildPolicyConfig struct {
+	Module              string   `json:"module"`                // 主模块路径，默认 polywin，为空时不检查
+	Package             string   `json:"package"`               // main 包路径，默认 polywin/cmd/server，为空时不检查
+	MinGoVersion        string   `json:"min_go_version"`        // 最低 Go 工具链版本（如 go1.21）
+	RequireRevision     bool     `json:"require_revision"`      // 必须包含 VCS 提交且没有未提交的修改
+	VersionVar          string   `json:"version_var"`           // -ldflags -X 写入版本号的变量，默认 main.serverVersion
+	RequireVersionStamp bool     `json:"require_version_stamp"` // 必须通过 -ldflags 写入版本号
+	Deny                []string `json:"deny"`                  // 拒绝的模块版本（module@version 或 module）
+}
+
+// TargetVersionConfig 没有安装记录时识别目标程序版本的方式
+type TargetVersionConfig struct {
+	URL   string `json:"url"`   // 查询运行中目标程序版本的地址，为空不查询
+	Field string `json:"field"` // 版本字段路径
+}
+
+// VersionsConfig 版本库配置
+type VersionsConfig struct {
+	Keep    int      `json:"keep"`     // 最多保留的版本数量，0 表示不启用版本库
+	MaxSize ByteSize `json:"max_size"` // 版本库总大小上限，0 表示不限制
+}
+
+// ControlConfig 守护程序控制接口配置
+type ControlConfig struct {
+	Addr string `json:"addr"` // 监听地址，为空则不启用
+
+	Token string `json:"token"` // 修改状态的请求需要携带的令牌，为空时使用状态文件旁自动生成的 polywin.control-token
+}
+
+// DefaultConfig 返回默认配置
+func DefaultConfig() *Config {
+	return &Config{
+		RepoURL:       "https://github.com/0xachong/polywin.git",
+		Target:        "server" + exeSuffix(),
+		CheckInterval: Duration{30 * time.Second},
+		AutoUpdate:    true,
+		Channel:       ChannelStable,
+
+		MaxDownloadSize: 200 << 20,
+		Download: DownloadConfig{
+			Retries:     defaultDownloadRetries,
+			RetryDelay:  Duration{defaultDownloadRetryDelay},
+			IdleTimeout: Duration{defaultDownloadIdleTimeout},
+			Parallel:    1,
+			ChunkSize:   defaultDownloadChunkSize,
+			Delta:       true,
+		},
+
+		Restart: RestartConfig{
+			Policy:        string(RestartAlways),
+			InitialDelay:  Duration{3 * time.Second},
+			MaxDelay:      Duration{2 * time.Minute},
+			Multiplier:    2,
+			Jitter:        0.2,
+			MaxRestarts:   10,
+			Window:        Duration{10 * time.Minute},
+			HealthyUptime: Duration{time.Minute},
+		},
+		Stop: StopConfig{
+			Signal:  "SIGTERM",
+			Timeout: Duration{10 * time.Second},
+		},
+		Apply: ApplyConfig{
+			Strategy:       string(ApplyImmediate),
+			WindowDuration: Duration{2 * time.Hour},
+			ApprovalTTL:    Duration{72 * time.Hour},
+		},
+		HealthCheck: HealthCheckConfig{
+			Type:             "none",
+			URL:              "http://127.0.0.1:8099/ping",
+			ExpectedStatus:   200,
+			Interval:         Duration{10 * time.Second},
+			Timeout:          Duration{3 * time.Second},
+			StartPeriod:      Duration{15 * time.Second},
+			FailureThreshold: 3,
+		},
+		Probation: ProbationConfig{
+			Window:         Duration{2 * time.Minute},
+			RequireHealthy: true,
+			VersionField:   "version",
+		},
+		Versions: VersionsConfig{
+			Keep:    5,
+			MaxSize: 1 << 30,
+		},
+		Control: ControlConfig{
+			Addr: "127.0.0.1:8098",
+		},
+		Source: SourceConfig{
+			Type:           SourceAuto,
+			Manifest:       "latest.json",
+			MaxExtractSize: defaultMaxExtractSize,
+		},
+		TargetVersion: TargetVersionConfig{
+			URL:   "http://127.0.0.1:8099/info",
+			Field: "server.config.version",
+		},
+		BuildPolicy: BuildPolicyConfig{
+			Module:     "polywin",
+			Package:    "polywin/cmd/server",
+			VersionVar: "main.serverVersion",
+		},
+	}
+}
+
+// configOption 描述一个可由环境变量和命令行参数设置的配置项
+type configOption struct {
+	key    string // 配置文件键名（嵌套键用 . 分隔），环境变量为 POLYWIN_ + 大写键名
+	flag   string // 命令行参数名
+	usage  string
+	isBool bool
+	set    func(c *Config, value string) error
+}
+
+// configOptions 所有可覆盖的配置项
+var configOptions = []configOption{
+	stringOption("repo_url", "repo", "Git 仓库 URL", func(c *Config) *string { return &c.RepoURL }),
+	stringOption("update_url", "update-url", "更新信息 URL（JSON 格式的 UpdateInfo）", func(c *Config) *string { return &c.UpdateURL }),
+	stringOption("target", "target", "目标可执行文件名或路径", func(c *Config) *string { return &c.Target }),
+	durationOption("check_interval", "check-interval", "更新检查间隔（如 30s、5m）", func(c *Config) *Duration { return &c.CheckInterval }),
+	boolOption("auto_update", "auto-update", "是否启用自动更新", func(c *Config) *bool { return &c.AutoUpdate }),
+	stringOption("channel", "channel", "发布通道：stable / beta / canary", func(c *Config) *string { return &c.Channel }),
+	boolOption("allow_downgrade", "allow-downgrade", "切换到更稳定的通道时允许降级到该通道的最新版本", func(c *Config) *bool { return &c.AllowDowngrade }),
+	stringOption("version_constraint", "version-constraint", "只安装满足约束的版本（如 ~1.4、^1.4.2、>=1.2 <1.5）", func(c *Config) *string { return &c.VersionConstraint }),
+	listOption("skip_versions", "skip-versions", "不安装的版本，多个用逗号分隔", func(c *Config) *[]string { return &c.SkipVersions }),
+	byteSizeOption("max_download_size", "max-download-size", "下载文件大小上限（如 200MB，0 表示不限制）", func(c *Config) *ByteSize { return &c.MaxDownloadSize }),
+	boolOption("require_checksum", "require-checksum", "没有可用校验和时拒绝更新", func(c *Config) *bool { return &c.RequireChecksum }),
+	intOption("download.retries", "download-retries", "下载失败后的重试次数", func(c *Config) *int { return &c.Download.Retries }),
+	durationOption("download.retry_delay", "download-retry-delay", "下载首次重试等待时间（之后每次翻倍）", func(c *Config) *Duration { return &c.Download.RetryDelay }),
+	durationOption("download.idle_timeout", "download-idle-timeout", "下载在该时间内没有收到数据则中止并重试", func(c *Config) *Duration { return &c.Download.IdleTimeout }),
+	intOption("download.parallel", "download-parallel", "并行下载的分块数（1 表示不分块）", func(c *Config) *int { return &c.Download.Parallel }),
+	byteSizeOption("download.chunk_size", "download-chunk-size", "并行下载时每个分块的最小大小", func(c *Config) *ByteSize { return &c.Download.ChunkSize }),
+	boolOption("download.delta", "download-delta", "有增量补丁时优先下载补丁，失败时下载完整文件", func(c *Config) *bool { return &c.Download.Delta }),
+	listOption("signing.public_keys", "public-keys", "受信任的签名公钥，多个用逗号分隔", func(c *Config) *[]string { return &c.Signing.PublicKeys }),
+	boolOption("signing.insecure_skip_verify", "insecure-skip-verify", "不校验更新的签名（不安全）", func(c *Config) *bool { return &c.Signing.InsecureSkipVerify }),
+
+	stringOption("restart.policy", "restart-policy", "重启策略：always / on-failure / never", func(c *Config) *string { return &c.Restart.Policy }),
+	durationOption("restart.initial_delay", "restart-delay", "首次重启等待时间", func(c *Config) *Duration { return &c.Restart.InitialDelay }),
+	durationOption("restart.max_delay", "restart-max-delay", "重启等待时间上限", func(c *Config) *Duration { return &c.Restart.MaxDelay }),
+	intOption("restart.max_restarts", "max-restarts", "时间窗口内允许的最大重启次数（0 表示不限制）", func(c *Config) *int { return &c.Restart.MaxRestarts }),
+	durationOption("restart.window", "restart-window", "崩溃循环检测的时间窗口", func(c *Config) *Duration { return &c.Restart.Window }),
+
+	stringOption("stop.signal", "stop-signal", "停止目标程序时发送的信号", func(c *Config) *string { return &c.Stop.Signal }),
+	durationOption("stop.timeout", "stop-timeout", "停止目标程序的宽限期，超时后强制结束", func(c *Config) *Duration { return &c.Stop.Timeout }),
+
+	stringOption("apply.strategy", "apply-strategy", "新版本就绪后的应用策略：immediate / on-next-exit / window", func(c *Config) *string { return &c.Apply.Strategy }),
+	stringOption("apply.window", "apply-window", "维护窗口开始时间（cron 表达式，如 \"0 2 * * *\"）", func(c *Config) *string { return &c.Apply.Window }),
+	durationOption("apply.window_duration", "apply-window-duration", "维护窗口时长", func(c *Config) *Duration { return &c.Apply.WindowDuration }),
+	boolOption("apply.require_approval", "require-approval", "新版本下载并校验后等待批准（polywin approve / reject），不自动替换", func(c *Config) *bool { return &c.Apply.RequireApproval }),
+	durationOption("apply.approval_ttl", "approval-ttl", "等待批准的有效期，过期后丢弃（0 表示不过期）", func(c *Config) *Duration { return &c.Apply.ApprovalTTL }),
+
+	stringOption("health_check.type", "health-check", "健康检查类型：http / tcp / exec / none", func(c *Config) *string { return &c.HealthCheck.Type }),
+	stringOption("health_check.url", "health-url", "HTTP 健康检查地址", func(c *Config) *string { return &c.HealthCheck.URL }),
+	stringOption("health_check.address", "health-address", "TCP 健康检查地址（host:port）", func(c *Config) *string { return &c.HealthCheck.Address }),
+	durationOption("health_check.interval", "health-interval", "健康检查间隔", func(c *Config) *Duration { return &c.HealthCheck.Interval }),
+	durationOption("health_check.timeout", "health-timeout", "单次健康检查超时", func(c *Config) *Duration { return &c.HealthCheck.Timeout }),
+	durationOption("health_check.start_period", "health-start-period", "启动宽限期，期间失败不计数", func(c *Config) *Duration { return &c.HealthCheck.StartPeriod }),
+	intOption("health_check.failure_threshold", "health-failures", "连续失败多少次后重启目标程序", func(c *Config) *int { return &c.HealthCheck.FailureThreshold }),
+
+	durationOption("probation.window", "probation-window", "更新后试运行时长，期间退出或检查失败则回滚（0 表示不试运行）", func(c *Config) *Duration { return &c.Probation.Window }),
+	stringOption("probation.version_url", "probation-version-url", "试运行时查询目标程序版本的地址", func(c *Config) *string { return &c.Probation.VersionURL }),
+
+	intOption("versions.keep", "versions-keep", "版本库最多保留的版本数量（0 表示不启用）", func(c *Config) *int { return &c.Versions.Keep }),
+	byteSizeOption("versions.max_size", "versions-max-size", "版本库总大小上限（0 表示不限制）", func(c *Config) *ByteSize { return &c.Versions.MaxSize }),
+
+	stringOption("source.type", "source", "更新源类型：auto / github / github-api / manifest / directory", func(c *Config) *string { return &c.Source.Type }),
+	stringOption("source.dir", "source-dir", "directory 更新源的发布目录（本地目录或网络共享）", func(c *Config) *string { return &c.Source.Dir }),
+	stringOption("source.manifest", "source-manifest", "发布目录中的版本信息文件名", func(c *Config) *string { return &c.Source.Manifest }),
+	stringOption("source.asset", "asset", "发布产物文件名，支持 {name} {os} {arch} {ext} 占位符（.zip / .tar.gz / .gz 会自动解压）", func(c *Config) *string { return &c.Source.Asset }),
+	stringOption("source.archive_entry", "archive-entry", "压缩包中目标程序的文件名（默认与目标程序同名）", func(c *Config) *string { return &c.Source.ArchiveEntry }),
+	listOption("source.companions", "companions", "随目标程序一起从压缩包中提取的附带文件，多个用逗号分隔", func(c *Config) *[]string { return &c.Source.Companions }),
+	byteSizeOption("source.max_extract_size", "max-extract-size", "压缩包解压后的总大小上限", func(c *Config) *ByteSize { return &c.Source.MaxExtractSize }),
+
+	stringOption("github.api_url", "github-api-url", "GitHub API 地址", func(c *Config) *string { return &c.GitHub.APIURL }),
+	stringOption("github.token", "github-token", "GitHub 访问令牌（私有仓库）", func(c *Config) *string { return &c.GitHub.Token }),
+	stringOption("github.asset_pattern", "asset-pattern", "发布产物名称模式（如 server_{os}_{arch}*）", func(c *Config) *string { return &c.GitHub.AssetPattern }),
+
+	stringOption("target_version.url", "target-version-url", "查询目标程序版本的地址（为空不查询）", func(c *Config) *string { return &c.TargetVersion.URL }),
+	stringOption("target_version.field", "target-version-field", "目标程序版本字段路径", func(c *Config) *string { return &c.TargetVersion.Field }),
+
+	stringOption("build_policy.module", "build-module", "新版本的主模块路径必须与此一致（为空不检查）", func(c *Config) *string { return &c.BuildPolicy.Module }),
+	stringOption("build_policy.package", "build-package", "新版本的 main 包路径必须与此一致（为空不检查）", func(c *Config) *string { return &c.BuildPolicy.Package }),
+	stringOption("build_policy.min_go_version", "build-min-go", "新版本的最低 Go 工具链版本（如 go1.21）", func(c *Config) *string { return &c.BuildPolicy.MinGoVersion }),
+	boolOption("build_policy.require_revision", "build-require-revision", "新版本必须包含 VCS 提交且没有未提交的修改", func(c *Config) *bool { return &c.BuildPolicy.RequireRevision }),
+	stringOption("build_policy.version_var", "build-version-var", "-ldflags -X 写入版本号的变量，与发布版本不一致时拒绝", func(c *Config) *string { return &c.BuildPolicy.VersionVar }),
+	boolOption("build_policy.require_version_stamp", "build-require-version-stamp", "新版本必须通过 -ldflags 写入版本号", func(c *Config) *bool { return &c.BuildPolicy.RequireVersionStamp }),
+	listOption("build_policy.deny", "build-deny", "拒绝安装的模块版本（module@version），多个用逗号分隔", func(c *Config) *[]string { return &c.BuildPolicy.Deny }),
+
+	stringOption("control.addr", "control-addr", "控制接口监听地址，为空则不启用", func(c *Config) *string { return &c.Control.Addr }),
+	stringOption("control.token", "control-token", "控制接口令牌，为空时使用自动生成的令牌文件", func(c *Config) *string { return &c.Control.Token }),
+}
+
+// stringOption 字符串配置项
+func stringOption(key, flagName, usage string, field func(c *Config) *string) configOption {
+	return configOption{key: key, flag: flagName, usage: usage, set: func(c *Config, v string) error {
+		*field(c) = v
+		return nil
+	}}
+}
+
+// durationOption 时间间隔配置项
+func durationOption(key, flagName, usage string, field func(c *Config) *Duration) configOption {
+	return configOption{key: key, flag: flagName, usage: usage, set: func(c *Config, v string) error {
+		d, err := parseDuration(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = Duration{d}
+		return nil
+	}}
+}
+
+// boolOption 布尔配置项
+func boolOption(key, flagName, usage string, field func(c *Config) *bool) configOption {
+	return configOption{key: key, flag: flagName, usage: usage, isBool: true, set: func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("无效的布尔值: %s", v)
+		}
+		*field(c) = b
+		return nil
+	}}
+}
+
+// byteSizeOption 大小配置项
+func byteSizeOption(key, flagName, usage string, field func(c *Config) *ByteSize) configOption {
+	return configOption{key: key, flag: flagName, usage: usage, set: func(c *Config, v string) error {
+		n, err := parseByteSize(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = n
+		return nil
+	}}
+}
+
+// listOption 列表配置项，逗号分隔
+func listOption(key, flagName, usage string, field func(c *Config) *[]string) configOption {
+	return configOption{key: key, flag: flagName, usage: usage, set: func(c *Config, v string) error {
+		var items []string
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*field(c) = items
+		return nil
+	}}
+}
+
+// intOption 整数配置项
+func intOption(key, flagName, usage string, field func(c *Config) *int) configOption {
+	return configOption{key: key, flag: flagName, usage: usage, set: func(c *Config, v string) error {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return fmt.Errorf("无效的整数: %s", v)
+		}
+		*field(c) = n
+		return nil
+	}}
+}
+
+// optionValue 记录命令行参数的原始值，稍后按顺序应用
+type optionValue struct {
+	isBool bool
+	value  string
+	set    bool
+}
+
+func (v *optionValue) String() string   { return v.value }
+func (v *optionValue) IsBoolFlag() bool { return v.isBool }
+func (v *optionValue) Set(s string) error {
+	v.value = s
+	v.set = true
+	return nil
+}
+
+// LoadConfig 从配置文件、环境变量和命令行参数加载配置
+func LoadConfig(args []string) (*Config, error) {
+	fs := flag.NewFlagSet("polywin", flag.ContinueOnError)
+	configPath := fs.String("config", "", "配置文件路径（JSON 或 TOML），默认查找可执行文件目录下的 polywin.json / polywin.toml")
+	profile := fs.String("profile", "", "使用配置文件中的 profile（如 dev、staging、prod）")
+
+	values := make([]*optionValue, len(configOptions))
+	for i, opt := range configOptions {
+		values[i] = &optionValue{isBool: opt.isBool}
+		fs.Var(values[i], opt.flag, fmt.Sprintf("%s（环境变量 %s）", opt.usage, envName(opt.key)))
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("未知参数: %s", strings.Join(fs.Args(), " "))
+	}
+
+	execPath, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("获取可执行文件路径失败: %v", err)
+	}
+	execDir := filepath.Dir(execPath)
+
+	cfg := DefaultConfig()
+
+	// 配置文件
+	path := *configPath
+	explicit := path != ""
+	if !explicit {
+		path = os.Getenv(envPrefix + "CONFIG")
+		explicit = path != ""
+	}
+	if !explicit {
+		for _, name := range defaultConfigFiles {
+			candidate := filepath.Join(execDir, name)
+			if _, err := os.Stat(candidate); err == nil {
+				path = candidate
+				break
+			}
+		}
+	}
+
+	profileName := *profile
+	if profileName == "" {
+		profileName = os.Getenv(envPrefix + "PROFILE")
+	}
+
+	if path != "" {
+		if err := cfg.loadFile(path, profileName); err != nil {
+			return nil, err
+		}
+	} else if profileName != "" {
+		return nil, fmt.Errorf("指定了 profile %q，但没有找到配置文件", profileName)
+	}
+
+	// 环境变量
+	for _, opt := range configOptions {
+		if v, ok := os.LookupEnv(envName(opt.key)); ok {
+			if err := opt.set(cfg, v); err != nil {
+				return nil, fmt.Errorf("环境变量 %s: %v", envName(opt.key), err)
+			}
+		}
+	}
+
+	// 命令行参数
+	for i, opt := range configOptions {
+		if values[i].set {
+			if err := opt.set(cfg, values[i].value); err != nil {
+				return nil, fmt.Errorf("参数 -%s: %v", opt.flag, err)
+			}
+		}
+	}
+
+	cfg.TargetPath = withExeSuffix(cfg.Target)
+	if !filepath.IsAbs(cfg.TargetPath) {
+		cfg.TargetPath = filepath.Join(execDir, cfg.TargetPath)
+	}
+	if cfg.Source.Dir != "" && !filepath.IsAbs(cfg.Source.Dir) {
+		cfg.Source.Dir = filepath.Join(execDir, cfg.Source.Dir)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile 加载配置文件，并应用指定的 profile
+func (c *Config) loadFile(path, profileName string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取配置文件失败: %v", err)
+	}
+
+	var raw map[string]json.RawMessage
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		table, err := parseTOML(data)
+		if err != nil {
+			return fmt.Errorf("解析配置文件 %s 失败: %v", path, err)
+		}
+		data, err = json.Marshal(table)
+		if err != nil {
+			return fmt.Errorf("转换配置文件 %s 失败: %v", path, err)
+		}
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("解析配置文件 %s 失败: %v", path, err)
+	}
+
+	// 文件中的默认 profile
+	if profileName == "" {
+		if v, ok := raw["profile"]; ok {
+			if err := json.Unmarshal(v, &profileName); err != nil {
+				return fmt.Errorf("配置文件 %s: profile 必须是字符串", path)
+			}
+		}
+	}
+
+	profiles := make(map[string]json.RawMessage)
+	if v, ok := raw["profiles"]; ok {
+		if err := json.Unmarshal(v, &profiles); err != nil {
+			return fmt.Errorf("配置文件 %s: profiles 格式错误: %v", path, err)
+		}
+	}
+	delete(raw, "profile")
+	delete(raw, "profiles")
+
+	base, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	if err := decodeStrict(base, c); err != nil {
+		return fmt.Errorf("配置文件 %s: %v", path, err)
+	}
+
+	if profileName != "" {
+		overlay, ok := profiles[profileName]
+		if !ok {
+			names := make([]string, 0, len(profiles))
+			for name := range profiles {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return fmt.Errorf("配置文件 %s 中不存在 profile %q（可用: %s）", path, profileName, strings.Join(names, ", "))
+		}
+		if err := decodeStrict(overlay, c); err != nil {
+			return fmt.Errorf("配置文件 %s profile %q: %v", path, profileName, err)
+		}
+	}
+
+	c.ConfigFile = path
+	c.Profile = profileName
+	return nil
+}
+
+// Validate 校验配置
+func (c *Config) Validate() error {
+	if strings.TrimSpace(c.Target) == "" {
+		return fmt.Errorf("目标程序 target 不能为空")
+	}
+	if c.CheckInterval.Duration < time.Second {
+		return fmt.Errorf("更新检查间隔 check_interval 不能小于 1s（当前: %v）", c.CheckInterval.Duration)
+	}
+	if c.UpdateURL != "" {
+		if err := validateHTTPURL(c.UpdateURL); err != nil {
+			return fmt.Errorf("update_url: %v", err)
+		}
+	}
+	if err := validateChannel(c.Channel); err != nil {
+		return fmt.Errorf("channel: %v", err)
+	}
+	if _, err := c.Constraint(); err != nil {
+		return fmt.Errorf("version_constraint: %v", err)
+	}
+	for _, v := range c.SkipVersions {
+		if strings.TrimSpace(v) == "" {
+			return fmt.Errorf("skip_versions 不能包含空版本号")
+		}
+	}
+	source, err := c.UpdateSource(nil)
+	if err != nil {
+		return fmt.Errorf("source: %v", err)
+	}
+	if c.AutoUpdate && source == nil {
+		return fmt.Errorf("启用自动更新时必须配置 repo_url、update_url 或 source.dir")
+	}
+
+	if c.MaxDownloadSize < 0 {
+		return fmt.Errorf("max_download_size 不能为负数")
+	}
+	for _, name := range c.Source.Companions {
+		if name == "" || name != filepath.Base(name) || strings.ContainsAny(name, `/\`) || name == ".." {
+			return fmt.Errorf("source.companions: 附带文件必须是文件名，不能包含路径: %q", name)
+		}
+		if strings.EqualFold(name, filepath.Base(c.TargetPath)) {
+			return fmt.Errorf("source.companions: 不能包含目标程序 %s", name)
+		}
+	}
+	if c.Source.MaxExtractSize <= 0 {
+		return fmt.Errorf("source.max_extract_size 必须大于 0")
+	}
+
+	dl := c.Download
+	if dl.Retries < 0 {
+		return fmt.Errorf("download.retries 不能为负数")
+	}
+	if dl.RetryDelay.Duration < 0 || dl.IdleTimeout.Duration <= 0 {
+		return fmt.Errorf("download.retry_delay 不能为负数，download.idle_timeout 必须大于 0")
+	}
+	if dl.Parallel < 1 || dl.Parallel > 16 {
+		return fmt.Errorf("download.parallel 必须在 1 到 16 之间")
+	}
+	if dl.ChunkSize <= 0 {
+		return fmt.Errorf("download.chunk_size 必须大于 0")
+	}
+
+	keys, err := c.PublicKeys()
+	if err != nil {
+		return fmt.Errorf("signing.public_keys: %v", err)
+	}
+	if len(keys) == 0 && !c.Signing.InsecureSkipVerify {
+		return fmt.Errorf("没有配置签名公钥（signing.public_keys），确实不需要校验签名时设置 signing.insecure_skip_verify")
+	}
+
+	r := c.Restart
+	switch RestartPolicy(r.Policy) {
+	case RestartAlways, RestartOnFailure, RestartNever:
+	default:
+		return fmt.Errorf("restart.policy 无效: %q（可选: always、on-failure、never）", r.Policy)
+	}
+	if r.InitialDelay.Duration <= 0 {
+		return fmt.Errorf("restart.initial_delay 必须大于 0")
+	}
+	if r.MaxDelay.Duration < r.InitialDelay.Duration {
+		return fmt.Errorf("restart.max_delay 不能小于 restart.initial_delay")
+	}
+	if r.Multiplier < 1 {
+		return fmt.Errorf("restart.multiplier 不能小于 1")
+	}
+	if r.Jitter < 0 || r.Jitter > 1 {
+		return fmt.Errorf("restart.jitter 必须在 0 到 1 之间")
+	}
+	if r.MaxRestarts < 0 {
+		return fmt.Errorf("restart.max_restarts 不能为负数")
+	}
+	if r.MaxRestarts > 0 && r.Window.Duration <= 0 {
+		return fmt.Errorf("设置 restart.max_restarts 时 restart.window 必须大于 0")
+	}
+
+	if _, err := parseStopSignal(c.Stop.Signal); err != nil {
+		return fmt.Errorf("stop.signal: %v", err)
+	}
+	if c.Stop.Timeout.Duration < 0 {
+		return fmt.Errorf("stop.timeout 不能为负数")
+	}
+
+	if _, err := c.MaintenanceWindow(); err != nil {
+		return err
+	}
+	if c.Apply.ApprovalTTL.Duration < 0 {
+		return fmt.Errorf("apply.approval_ttl 不能为负数")
+	}
+
+	if _, err := NewHealthChecker(c.HealthCheck); err != nil {
+		return err
+	}
+	hc := c.HealthCheck
+	if hc.Interval.Duration <= 0 || hc.Timeout.Duration <= 0 {
+		return fmt.Errorf("health_check.interval 和 health_check.timeout 必须大于 0")
+	}
+	if hc.FailureThreshold < 1 {
+		return fmt.Errorf("health_check.failure_threshold 不能小于 1")
+	}
+	if hc.StartPeriod.Duration < 0 {
+		return fmt.Errorf("health_check.start_period 不能为负数")
+	}
+
+	if c.Probation.Window.Duration < 0 {
+		return fmt.Errorf("probation.window 不能为负数")
+	}
+	if c.Probation.VersionURL != "" {
+		if err := validateHTTPURL(c.Probation.VersionURL); err != nil {
+			return fmt.Errorf("probation.version_url: %v", err)
+		}
+	}
+
+	if c.Versions.Keep < 0 || c.Versions.MaxSize < 0 {
+		return fmt.Errorf("versions.keep 和 versions.max_size 不能为负数")
+	}
+
+	if c.TargetVersion.URL != "" {
+		if err := validateHTTPURL(c.TargetVersion.URL); err != nil {
+			return fmt.Errorf("target_version.url: %v", err)
+		}
+	}
+
+	bp := c.BuildPolicy
+	if bp.MinGoVersion != "" {
+		if _, err := parseGoVersion(bp.MinGoVersion); err != nil {
+			return fmt.Errorf("build_policy.min_go_version 无效: %s", bp.MinGoVersion)
+		}
+	}
+	if bp.RequireVersionStamp && bp.VersionVar == "" {
+		return fmt.Errorf("build_policy.require_version_stamp 需要配置 build_policy.version_var")
+	}
+	for _, rule := range bp.Deny {
+		if module, _, _ := strings.Cut(rule, "@"); module == "" {
+			return fmt.Errorf("build_policy.deny: 无效的模块版本 %q", rule)
+		}
+	}
+
+	if c.Control.Addr != "" {
+		if _, _, err := net.SplitHostPort(c.Control.Addr); err != nil {
+			return fmt.Errorf("control.addr 无效: %v", err)
+		}
+	}
+	return nil
+}
+
+// UpdaterConfig 根据配置生成更新器配置
+func (c *Config) UpdaterConfig() *UpdaterConfig {
+	keys, _ := c.PublicKeys() // 已在 Validate 中校验
+	downloader := c.Downloader()
+	source, _ := c.UpdateSource(downloader) // 已在 Validate 中校验
+	constraint, _ := c.Constraint()         // 已在 Validate 中校验
+	window, _ := c.MaintenanceWindow()      // 已在 Validate 中校验
+	return &UpdaterConfig{
+		Source:           source,
+		Downloader:       downloader,
+		CheckInterval:    c.CheckInterval.Duration,
+		EnableAutoUpdate: c.AutoUpdate,
+		Channel:          c.Channel,
+		AllowDowngrade:   c.AllowDowngrade,
+		Constraint:       constraint,
+		SkipVersions:     c.SkipVersions,
+		Versions:         c.VersionStore(),
+		ApplyStrategy:    ApplyStrategy(c.Apply.Strategy),
+		ApplyWindow:      window,
+		RequireApproval:  c.Apply.RequireApproval,
+		ApprovalTTL:      c.Apply.ApprovalTTL.Duration,
+		TargetExecutable: filepath.Base(c.TargetPath),
+		TargetPath:       c.TargetPath,
+		StatePath:        defaultStatePath(c.TargetPath),
+		MaxDownloadSize:  int64(c.MaxDownloadSize),
+		RequireChecksum:  c.RequireChecksum,
+		Delta:            c.Download.Delta,
+		ArchiveEntry:     c.Source.ArchiveEntry,
+		Companions:       c.Source.Companions,
+		MaxExtractSize:   int64(c.Source.MaxExtractSize),
+		PublicKeys:       keys,
+		SkipSignature:    c.Signing.InsecureSkipVerify,
+		VersionURL:       c.TargetVersion.URL,
+		VersionField:     c.TargetVersion.Field,
+		BuildPolicy: &BuildPolicy{
+			Module:              c.BuildPolicy.Module,
+			Package:             c.BuildPolicy.Package,
+			MinGoVersion:        c.BuildPolicy.MinGoVersion,
+			RequireRevision:     c.BuildPolicy.RequireRevision,
+			VersionVar:          c.BuildPolicy.VersionVar,
+			RequireVersionStamp: c.BuildPolicy.RequireVersionStamp,
+			Deny:                c.BuildPolicy.Deny,
+		},
+	}
+}
+
+// Downloader 根据配置创建下载器
+func (c *Config) Downloader() *Downloader {
+	d := NewDownloader()
+	d.Retries = c.Download.Retries
+	d.RetryDelay = c.Download.RetryDelay.Duration
+	d.IdleTimeout = c.Download.IdleTimeout.Duration
+	d.Parallel = c.Download.Parallel
+	d.ChunkSize = int64(c.Download.ChunkSize)
+	return d
+}
+
+// UpdateSource 根据 source.type 创建更新源，没有配置任何更新源时返回 nil
+// downloader 为 nil 时使用默认下载器
+func (c *Config) UpdateSource(downloader *Downloader) (UpdateSource, error) {
+	asset := assetName(c.Source.Asset, filepath.Base(c.TargetPath))
+
+	typ := c.Source.Type
+	if typ == SourceAuto || typ == "" {
+		switch {
+		case c.UpdateURL != "":
+			typ = SourceManifest
+		case c.RepoURL != "" && (c.GitHub.Token != "" || c.Channel != ChannelStable || c.VersionConstraint != ""):
+			typ = SourceGitHubAPI
+		case c.RepoURL != "":
+			typ = SourceGitHub
+		default:
+			return nil, nil
+		}
+	}
+
+	switch typ {
+	case SourceGitHub:
+		if c.Channel != ChannelStable {
+			return nil, fmt.Errorf("github 更新源只能获取正式版本，%s 通道请使用 github-api", c.Channel)
+		}
+		return newGitHubDownloadSource(c.RepoURL, asset, downloader)
+	case SourceGitHubAPI:
+		pattern := asset
+		if c.GitHub.AssetPattern != "" {
+			pattern = assetName(c.GitHub.AssetPattern, filepath.Base(c.TargetPath))
+		}
+		constraint, _ := c.Constraint() // 已在 Validate 中校验
+		return newGitHubReleaseSource(c.GitHub.APIURL, c.RepoURL, c.GitHub.Token, pattern, c.Channel, constraint, nil, downloader)
+	case SourceManifest:
+		if c.UpdateURL == "" {
+			return nil, fmt.Errorf("manifest 更新源需要配置 update_url")
+		}
+		return newManifestSource(c.UpdateURL, asset, c.Channel, downloader)
+	case SourceDirectory:
+		return newDirectorySource(c.Source.Dir, c.Source.Manifest, asset, c.Channel)
+	default:
+		return nil, fmt.Errorf("未知的更新源类型: %s（可选 auto / github / github-api / manifest / directory）", typ)
+	}
+}
+
+// MaintenanceWindow 检查应用策略并返回维护窗口，策略不是 window 时返回 nil
+func (c *Config) MaintenanceWindow() (*MaintenanceWindow, error) {
+	a := c.Apply
+	switch ApplyStrategy(a.Strategy) {
+	case ApplyImmediate, ApplyOnNextExit:
+		return nil, nil
+	case ApplyWindow:
+	default:
+		return nil, fmt.Errorf("apply.strategy 无效: %q（可选: immediate、on-next-exit、window）", a.Strategy)
+	}
+	if strings.TrimSpace(a.Window) == "" {
+		return nil, fmt.Errorf("apply.strategy 为 window 时必须配置 apply.window")
+	}
+	schedule, err := ParseCron(a.Window)
+	if err != nil {
+		return nil, fmt.Errorf("apply.window: %v", err)
+	}
+	if schedule.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("apply.window 永远不会触发: %s", a.Window)
+	}
+	if a.WindowDuration.Duration < time.Minute {
+		return nil, fmt.Errorf("apply.window_duration 不能小于 1 分钟")
+	}
+	return &MaintenanceWindow{Schedule: schedule, Duration: a.WindowDuration.Duration}, nil
+}
+
+// VersionStore 返回目标程序目录下的版本库，没有启用时返回 nil
+func (c *Config) VersionStore() *VersionStore {
+	if c.Versions.Keep <= 0 {
+		return nil
+	}
+	return &VersionStore{
+		Dir:     filepath.Join(filepath.Dir(c.TargetPath), versionsDirName),
+		Keep:    c.Versions.Keep,
+		MaxSize: int64(c.Versions.MaxSize),
+	}
+}
+
+// Constraint 返回解析后的版本约束，没有配置时返回 nil
+func (c *Config) Constraint() (*VersionConstraint, error) {
+	if strings.TrimSpace(c.VersionConstraint) == "" {
+		return nil, nil
+	}
+	return ParseConstraint(c.VersionConstraint)
+}
+
+// PublicKeys 返回编译时嵌入和配置文件中的全部签名公钥
+func (c *Config) PublicKeys() ([]*PublicKey, error) {
+	return ParsePublicKeys(append(embeddedPublicKeys(), c.Signing.PublicKeys...))
+}
+
+// SupervisorConfig 根据配置生成进程监督配置
+func (c *Config) SupervisorConfig() *SupervisorConfig {
+	r := c.Restart
+	stopSignal, _ := parseStopSignal(c.Stop.Signal) // 已在 Validate 中校验
+
+	var health *HealthCheckSettings
+	if checker, _ := NewHealthChecker(c.HealthCheck); checker != nil {
+		health = &HealthCheckSettings{
+			Checker:          checker,
+			Interval:         c.HealthCheck.Interval.Duration,
+			Timeout:          c.HealthCheck.Timeout.Duration,
+			StartPeriod:      c.HealthCheck.StartPeriod.Duration,
+			FailureThreshold: c.HealthCheck.FailureThreshold,
+		}
+	}
+
+	return &SupervisorConfig{
+		TargetPath:    c.TargetPath,
+		RestartPolicy: RestartPolicy(r.Policy),
+		InitialDelay:  r.InitialDelay.Duration,
+		MaxDelay:      r.MaxDelay.Duration,
+		Multiplier:    r.Multiplier,
+		Jitter:        r.Jitter,
+		MaxRestarts:   r.MaxRestarts,
+		RestartWindow: r.Window.Duration,
+		HealthyUptime: r.HealthyUptime.Duration,
+		StopSignal:    stopSignal,
+		StopTimeout:   c.Stop.Timeout.Duration,
+		HealthCheck:   health,
+		Probation: ProbationSettings{
+			Window:         c.Probation.Window.Duration,
+			RequireHealthy: c.Probation.RequireHealthy,
+			VersionURL:     c.Probation.VersionURL,
+			VersionField:   c.Probation.VersionField,
+		},
+	}
+}
+
+// envName 返回配置项对应的环境变量名
+func envName(key string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// decodeStrict 解析 JSON，拒绝未知字段
+func decodeStrict(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// parseDuration 解析时间间隔，纯数字按秒处理
+func parseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(n * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("无效的时间间隔: %s", s)
+	}
+	return d, nil
+}
+
+// validateHTTPURL 校验 http/https URL
+func validateHTTPURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("无效的 URL: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("仅支持 http/https URL: %s", raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("URL 缺少主机名: %s", raw)
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// VersionConstraint 版本约束，语法与 npm / Cargo 类似：
+//
+//	1.4、1.4.x、1.4.*   >=1.4.0 <1.5.0
+//	^1.4.2             >=1.4.2 <2.0.0（0.x 版本只允许 patch 升级：^0.4.2 为 >=0.4.2 <0.5.0）
+//	~1.4.2             >=1.4.2 <1.5.0
+//	>=1.2 <1.5         多个条件用空格或逗号分隔，需要全部满足
+//	1.2 - 1.4          >=1.2.0 <1.5.0
+//	^1.4 || ^2.1       满足任意一组即可
+//
+// 上限不包括该版本的预发布版本（<1.5.0 不匹配 1.5.0-rc.1），是否接收预发布版本由发布通道决定
+type VersionConstraint struct {
+	raw  string
+	sets [][]versionComparator
+}
+
+// versionComparator 单个比较条件
+type versionComparator struct {
+	op string // =、>、>=、<、<=
+	v  Version
+}
+
+// ParseConstraint 解析版本约束
+func ParseConstraint(s string) (*VersionConstraint, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, fmt.Errorf("版本约束为空")
+	}
+	c := &VersionConstraint{raw: s}
+	for _, alt := range strings.Split(s, "||") {
+		set, err := parseComparatorSet(strings.TrimSpace(alt))
+		if err != nil {
+			return nil, fmt.Errorf("无效的版本约束 %q: %v", s, err)
+		}
+		c.sets = append(c.sets, set)
+	}
+	return c, nil
+}
+
+// Check 版本是否满足约束，无法解析的版本号（如提交哈希）不满足任何约束；c 为 nil 时总是满足
+func (c *VersionConstraint) Check(version string) bool {
+	if c == nil {
+		return true
+	}
+	v, err := ParseVersion(version)
+	if err != nil {
+		return false
+	}
+	for _, set := range c.sets {
+		ok := true
+		for _, cmp := range set {
+			if !cmp.match(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// String 返回原始约束
+func (c *VersionConstraint) String() string {
+	if c == nil {
+		return ""
+	}
+	return c.raw
+}
+
+// match 判断版本是否满足条件
+func (cmp versionComparator) match(v Version) bool {
+	c := v.Compare(cmp.v)
+	switch cmp.op {
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	}
+	return c == 0
+}
+
+// parseComparatorSet 解析一组需要全部满足的条件
+func parseComparatorSet(s string) ([]versionComparator, error) {
+	if s == "" {
+		return nil, fmt.Errorf("|| 两侧不能为空")
+	}
+	// 范围：1.2 - 1.4
+	if parts := strings.Split(s, " - "); len(parts) == 2 {
+		low, _, err := parsePartialVersion(strings.TrimSpace(parts[0]))
+		if err != nil {
+			return nil, err
+		}
+		high, n, err := parsePartialVersion(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, err
+		}
+		set := []versionComparator{{">=", low}}
+		return append(set, upperBound("<=", high, n)...), nil
+	}
+
+	// 允许运算符和版本号之间有空格（>= 1.2）
+	var tokens []string
+	pending := ""
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' || r == '\t' }) {
+		if strings.Trim(f, "<>=^~") == "" {
+			pending += f
+			continue
+		}
+		tokens = append(tokens, pending+f)
+		pending = ""
+	}
+	if pending != "" {
+		return nil, fmt.Errorf("运算符 %s 后缺少版本号", pending)
+	}
+
+	var set []versionComparator
+	for _, token := range tokens {
+		cmps, err := parseComparator(token)
+		if err != nil {
+			return nil, err
+		}
+		set = append(set, cmps...)
+	}
+	return set, nil
+}
+
+// parseComparator 将单个条件展开为基本比较
+func parseComparator(token string) ([]versionComparator, error) {
+	op := ""
+	for _, prefix := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(token, prefix) {
+			op = prefix
+			break
+		}
+	}
+	v, n, err := parsePartialVersion(strings.TrimSpace(token[len(op):]))
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		// * 匹配所有版本
+		if op == "<" || op == ">" {
+			return nil, fmt.Errorf("%s* 不能匹配任何版本", op)
+		}
+		return nil, nil
+	}
+
+	switch op {
+	case "^":
+		high := v
+		switch {
+		case v.Major > 0 || n == 1:
+			high = Version{Major: v.Major + 1}
+		case v.Minor > 0 || n == 2:
+			high = Version{Minor: v.Minor + 1}
+		default:
+			high = Version{Patch: v.Patch + 1}
+		}
+		return []versionComparator{{">=", v}, {"<", floorVersion(high)}}, nil
+	case "~":
+		if n == 1 {
+			return []versionComparator{{">=", v}, {"<", floorVersion(Version{Major: v.Major + 1})}}, nil
+		}
+		return []versionComparator{{">=", v}, {"<", floorVersion(Version{Major: v.Major, Minor: v.Minor + 1})}}, nil
+	case ">=":
+		return []versionComparator{{">=", v}}, nil
+	case ">":
+		if n < 3 {
+			return []versionComparator{{">=", bumpVersion(v, n)}}, nil
+		}
+		return []versionComparator{{">", v}}, nil
+	case "<":
+		return []versionComparator{{"<", floorVersion(v)}}, nil
+	case "<=":
+		return upperBound("<=", v, n), nil
+	}
+	// 精确版本或省略部分的版本（1.4 即 1.4.x）
+	if n == 3 {
+		return []versionComparator{{"=", v}}, nil
+	}
+	return []versionComparator{{">=", v}, {"<", floorVersion(bumpVersion(v, n))}}, nil
+}
+
+// upperBound 上限条件：完整版本号包含该版本，省略部分的版本号包含整个范围（<=1.4 即 <1.5.0）
+func upperBound(op string, v Version, n int) []versionComparator {
+	if n == 0 {
+		return nil
+	}
+	if n < 3 {
+		return []versionComparator{{"<", floorVersion(bumpVersion(v, n))}}
+	}
+	return []versionComparator{{op, v}}
+}
+
+// bumpVersion 将第 n 个指定的部分加一，如 1.4（n=2）变为 1.5.0
+func bumpVersion(v Version, n int) Version {
+	if n == 1 {
+		return Version{Major: v.Major + 1}
+	}
+	return Version{Major: v.Major, Minor: v.Minor + 1}
+}
+
+// floorVersion 返回版本的最低预发布版本（1.5.0-0），作为上限时排除 1.5.0 的预发布版本
+func floorVersion(v Version) Version {
+	if !v.IsPrerelease() {
+		v.Prerelease = []string{"0"}
+	}
+	return v
+}
+
+// parsePartialVersion 解析可以省略部分或用 x / * 代替的版本号，返回版本和指定的部分数量（* 为 0）
+func parsePartialVersion(s string) (Version, int, error) {
+	// 预发布标识和 build 元数据中也可能有点号，只按核心部分计数
+	core, suffix := strings.TrimPrefix(s, "v"), ""
+	if i := strings.IndexAny(core, "-+"); i >= 0 {
+		core, suffix = core[:i], core[i:]
+	}
+	parts := strings.SplitN(core, ".", 3)
+	n := 0
+	for _, p := range parts {
+		if p == "x" || p == "X" || p == "*" {
+			break
+		}
+		n++
+	}
+	if n == 0 {
+		if suffix != "" || s != "*" && s != "x" && s != "X" && s != "" {
+			return Version{}, 0, fmt.Errorf("无效的版本号: %s", s)
+		}
+		return Version{}, 0, nil
+	}
+	if n < len(parts) {
+		// 1.x.3 这样的写法没有意义，通配符后面只能是通配符
+		for _, p := range parts[n:] {
+			if p != "x" && p != "X" && p != "*" {
+				return Version{}, 0, fmt.Errorf("无效的版本号: %s", s)
+			}
+		}
+	}
+	if suffix != "" && n < 3 {
+		return Version{}, 0, fmt.Errorf("带预发布标识的版本号必须完整: %s", s)
+	}
+	v, err := ParseVersion(strings.Join(parts[:n], ".") + suffix)
+	if err != nil {
+		return Version{}, 0, err
+	}
+	return v, n, nil
+}
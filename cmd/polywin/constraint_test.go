@@ -0,0 +1,90 @@
+package main
+
+import "testing"
+
+func TestVersionConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		match      []string
+		noMatch    []string
+	}{
+		{"1.4", []string{"1.4.0", "v1.4.9", "1.4.2+build"}, []string{"1.3.9", "1.5.0", "1.5.0-rc.1", "1.4.0-rc.1"}},
+		{"1.4.x", []string{"1.4.0", "1.4.9"}, []string{"1.3.9", "1.5.0"}},
+		{"v1.4.*", []string{"1.4.0", "1.4.9"}, []string{"1.3.9", "1.5.0"}},
+		{"1.4.2", []string{"1.4.2", "v1.4.2"}, []string{"1.4.1", "1.4.3", "1.4.2-rc.1"}},
+		{"=1.4.2", []string{"1.4.2"}, []string{"1.4.3"}},
+		{"^1.4.2", []string{"1.4.2", "1.9.9"}, []string{"1.4.1", "2.0.0", "2.0.0-rc.1"}},
+		{"^1.4", []string{"1.4.0", "1.99.0"}, []string{"1.3.9", "2.0.0"}},
+		{"^0.4.2", []string{"0.4.2", "0.4.9"}, []string{"0.4.1", "0.5.0"}},
+		{"^0.4", []string{"0.4.0", "0.4.9"}, []string{"0.5.0"}},
+		{"^0.0.3", []string{"0.0.3"}, []string{"0.0.4", "0.1.0"}},
+		{"~1.4.2", []string{"1.4.2", "1.4.9"}, []string{"1.4.1", "1.5.0"}},
+		{"~1", []string{"1.0.0", "1.9.9"}, []string{"0.9.9", "2.0.0"}},
+		{">=1.2 <1.5", []string{"1.2.0", "1.4.9"}, []string{"1.1.9", "1.5.0", "1.5.0-rc.1"}},
+		{">= 1.2, < 1.5", []string{"1.2.0", "1.4.9"}, []string{"1.1.9", "1.5.0"}},
+		{">1.4", []string{"1.5.0", "2.0.0"}, []string{"1.4.9", "1.4.0"}},
+		{">1.4.2", []string{"1.4.3"}, []string{"1.4.2"}},
+		{"<=1.4", []string{"1.4.9", "1.0.0"}, []string{"1.5.0", "1.5.0-rc.1"}},
+		{"<=1.4.2", []string{"1.4.2"}, []string{"1.4.3"}},
+		{"<2", []string{"1.99.99"}, []string{"2.0.0", "2.0.0-rc.1"}},
+		{"1.2 - 1.4", []string{"1.2.0", "1.4.9"}, []string{"1.1.9", "1.5.0"}},
+		{"1.2.0 - 1.4.3", []string{"1.2.0", "1.4.3"}, []string{"1.4.4"}},
+		{"^1.4 || ^2.1", []string{"1.4.0", "2.1.0", "2.9.0"}, []string{"1.3.0", "2.0.9", "3.0.0"}},
+		{">=1.5.0-rc.1", []string{"1.5.0-rc.1", "1.5.0-rc.2", "1.5.0", "2.0.0"}, []string{"1.5.0-beta.1", "1.4.9"}},
+		{"*", []string{"0.0.1", "1.2.3", "9.9.9-rc.1"}, []string{"3effef0", "latest"}},
+		{"x", []string{"1.2.3"}, nil},
+	}
+	for _, tt := range tests {
+		c, err := ParseConstraint(tt.constraint)
+		if err != nil {
+			t.Errorf("ParseConstraint(%q): %v", tt.constraint, err)
+			continue
+		}
+		for _, v := range tt.match {
+			if !c.Check(v) {
+				t.Errorf("%q 应该匹配 %s", tt.constraint, v)
+			}
+		}
+		for _, v := range tt.noMatch {
+			if c.Check(v) {
+				t.Errorf("%q 不应该匹配 %s", tt.constraint, v)
+			}
+		}
+		if c.String() != tt.constraint {
+			t.Errorf("String() = %q，期望 %q", c.String(), tt.constraint)
+		}
+	}
+}
+
+func TestParseConstraintErrors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"   ",
+		"||",
+		"^1.4 ||",
+		">=",
+		">= ",
+		"1.x.3",
+		"abc",
+		">*",
+		"<*",
+		"1.4-rc.1",
+		"1.2.3.4",
+		">=1.2 <abc",
+		"1.2 - x.y",
+	} {
+		if c, err := ParseConstraint(s); err == nil {
+			t.Errorf("ParseConstraint(%q) = %v，期望返回错误", s, c)
+		}
+	}
+}
+
+func TestNilConstraint(t *testing.T) {
+	var c *VersionConstraint
+	if !c.Check("1.2.3") || !c.Check("3effef0") {
+		t.Error("没有约束时应该匹配所有版本")
+	}
+	if c.String() != "" {
+		t.Errorf("String() = %q", c.String())
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// controlTokenFileName 控制接口令牌文件名（与状态文件位于同一目录）
+const controlTokenFileName = "polywin.control-token"
+
+// ControlServer 守护程序本地控制接口
+type ControlServer struct {
+	addr       string
+	token      string // 修改状态的请求需要携带的令牌
+	supervisor *Supervisor
+	updater    *Updater
+	server     *http.Server
+}
+
+// NewControlServer 创建控制接口，token 为修改状态的请求需要携带的令牌
+func NewControlServer(addr, token string, supervisor *Supervisor, updater *Updater) *ControlServer {
+	c := &ControlServer{
+		addr:       addr,
+		token:      token,
+		supervisor: supervisor,
+		updater:    updater,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", c.handleStatus)
+	mux.HandleFunc("/health", c.handleHealth)
+	mux.HandleFunc("/hold", c.handleHold)
+	mux.HandleFunc("/versions", c.handleVersions)
+	mux.HandleFunc("/rollback", c.handleRollback)
+	mux.HandleFunc("/approve", c.handleApproval)
+	mux.HandleFunc("/reject", c.handleApproval)
+
+	c.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return c
+}
+
+// Start 开始监听控制接口
+func (c *ControlServer) Start() error {
+	ln, err := net.Listen("tcp", c.addr)
+	if err != nil {
+		return fmt.Errorf("监听控制接口失败: %v", err)
+	}
+
+	go func() {
+		if err := c.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Printf("控制接口异常退出: %v", err)
+		}
+	}()
+
+	log.Printf("控制接口已启动: http://%s", ln.Addr())
+	return nil
+}
+
+// Stop 关闭控制接口
+func (c *ControlServer) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	c.server.Shutdown(ctx)
+}
+
+// loadControlToken 返回控制接口令牌：配置了 control.token 时使用配置，否则读取状态文件旁的令牌文件；
+// create 为 true 时令牌文件不存在则生成（权限 0600，只有运行守护程序的用户可以读取）
+func loadControlToken(cfg *Config, create bool) (string, error) {
+	if cfg.Control.Token != "" {
+		return cfg.Control.Token, nil
+	}
+
+	path := filepath.Join(filepath.Dir(defaultStatePath(cfg.TargetPath)), controlTokenFileName)
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil && strings.TrimSpace(string(data)) != "":
+		return strings.TrimSpace(string(data)), nil
+	case err == nil && !create:
+		return "", fmt.Errorf("控制接口令牌文件 %s 为空", path)
+	case err != nil && (!os.IsNotExist(err) || !create):
+		return "", fmt.Errorf("读取控制接口令牌失败（可以用 control.token 指定）: %v", err)
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成控制接口令牌失败: %v", err)
+	}
+	token := hex.EncodeToString(buf)
+	if err := writeFileAtomic(path, []byte(token+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("保存控制接口令牌失败: %v", err)
+	}
+	log.Printf("已生成控制接口令牌: %s", path)
+	return token, nil
+}
+
+// authorize 检查修改状态的请求：必须是 JSON 请求、不能带 Origin 头，并携带正确的令牌（Authorization: Bearer <令牌>），
+// 避免本机浏览器中的网页通过跨站请求调用控制接口；检查失败时已输出错误响应
+func (c *ControlServer) authorize(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Origin") != "" {
+		writeError(w, http.StatusForbidden, "不接受来自浏览器的请求")
+		return false
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, "请求需要 Content-Type: application/json")
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || c.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(c.token)) != 1 {
+		writeError(w, http.StatusUnauthorized, "缺少令牌或令牌无效")
+		return false
+	}
+	return true
+}
+
+// handleStatus 返回守护程序和目标程序状态
+func (c *ControlServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "仅支持 GET")
+		return
+	}
+
+	target := c.supervisor.Status()
+	update := c.updater.Status()
+	if !target.Supervising {
+		// 不再启动目标程序，已就绪的新版本在守护程序下次启动时应用，没有计划应用时间
+		update.NextApply = nil
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"daemon": map[string]interface{}{
+			"version": version,
+			"pid":     os.Getpid(),
+		},
+		"target": target,
+		"update": update,
+	})
+}
+
+// handleHealth 返回目标程序健康状态，不健康时返回 503
+func (c *ControlServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "仅支持 GET")
+		return
+	}
+
+	status := c.supervisor.Status()
+	code := http.StatusOK
+	if status.State != StateRunning || status.Health.Status == HealthUnhealthy {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, map[string]interface{}{
+		"state":  status.State,
+		"health": status.Health,
+	})
+}
+
+// handleHold 暂停（POST，可选 JSON 请求体 {"reason": "..."}）或恢复（DELETE）更新
+func (c *ControlServer) handleHold(w http.ResponseWriter, r *http.Request) {
+	var hold bool
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	switch r.Method {
+	case http.MethodPost:
+		hold = true
+	case http.MethodDelete:
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "仅支持 POST（暂停更新）和 DELETE（恢复更新）")
+		return
+	}
+	if !c.authorize(w, r) {
+		return
+	}
+	if hold {
+		if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&req); err != nil && err != io.EOF {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("解析请求失败: %v", err))
+			return
+		}
+	}
+
+	current, err := c.updater.SetHold(hold, req.Reason)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"hold": current,
+	})
+}
+
+// handleVersions 返回版本库中的版本
+func (c *ControlServer) handleVersions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "仅支持 GET")
+		return
+	}
+
+	versions, err := c.updater.Versions()
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if versions == nil {
+		versions = []*VersionRecord{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"versions": versions,
+	})
+}
+
+// handleRollback 切换到版本库中的指定版本（POST，JSON 请求体 {"to": "版本号或校验和"}），守护程序随后重启目标程序
+func (c *ControlServer) handleRollback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "仅支持 POST")
+		return
+	}
+	if !c.authorize(w, r) {
+		return
+	}
+
+	var req struct {
+		To string `json:"to"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("解析请求失败: %v", err))
+		return
+	}
+	if req.To == "" {
+		writeError(w, http.StatusBadRequest, "缺少要切换到的版本（to）")
+		return
+	}
+
+	rec, err := c.updater.SwitchVersion(req.To)
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"version": rec,
+	})
+}
+
+// handleApproval 批准（/approve）或拒绝（/reject）等待批准的版本，
+// 可选 JSON 请求体 {"version": "...", "reason": "..."}，指定 version 时必须与等待批准的版本一致
+func (c *ControlServer) handleApproval(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "仅支持 POST")
+		return
+	}
+	if !c.authorize(w, r) {
+		return
+	}
+
+	var req struct {
+		Version string `json:"version"`
+		Reason  string `json:"reason"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&req); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("解析请求失败: %v", err))
+		return
+	}
+
+	var version string
+	var err error
+	if r.URL.Path == "/reject" {
+		version, err = c.updater.Reject(req.Version, req.Reason)
+	} else {
+		version, err = c.updater.Approve(req.Version)
+	}
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"version": version,
+	})
+}
+
+// writeJSON 输出 JSON 响应
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// writeError 输出 JSON 错误响应
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// 增量补丁格式（bsdiff 算法，压缩方式和布局不同于 BSDIFF40）：
+//   8 字节 magic "PWDIFF01"
+//   8 字节新文件大小（小端 int64）
+//   gzip 压缩的记录流，每条记录：
+//     3 个小端 int64 控制字段 (add, copy, seek)
+//     add 字节差值：新文件字节 = 差值 + 旧文件对应字节
+//     copy 字节新增内容：直接写入新文件
+//     之后旧文件读取位置再移动 seek 字节
+
+// deltaMagic 增量补丁文件头
+const deltaMagic = "PWDIFF01"
+
+// errCorruptPatch 补丁格式错误
+var errCorruptPatch = errors.New("补丁文件已损坏")
+
+// patchFileName 返回与发布产物一起发布的补丁文件名：<产物文件名>.<旧版本>.patch
+func patchFileName(asset, from string) string {
+	return asset + "." + from + ".patch"
+}
+
+// runDiffCommand 执行 polywin diff <旧版本> <新版本> <补丁>，生成增量补丁
+func runDiffCommand(args []string) error {
+	if len(args) != 3 {
+		return fmt.Errorf("用法: polywin diff <旧版本文件> <新版本文件> <输出补丁文件>")
+	}
+	old, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	new, err := os.ReadFile(args[1])
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(args[2])
+	if err != nil {
+		return err
+	}
+	if err := CreatePatch(old, new, out); err != nil {
+		out.Close()
+		os.Remove(args[2])
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	// 生成后立即验证补丁能还原出新版本
+	var restored bytes.Buffer
+	patch, err := os.Open(args[2])
+	if err != nil {
+		return err
+	}
+	defer patch.Close()
+	if err := ApplyPatch(old, bufio.NewReader(patch), &restored, 0); err != nil || !bytes.Equal(restored.Bytes(), new) {
+		return fmt.Errorf("补丁验证失败")
+	}
+	fi, _ := patch.Stat()
+	fmt.Printf("已生成补丁 %s（%d 字节，新版本 %d 字节）\n", args[2], fi.Size(), len(new))
+	return nil
+}
+
+// CreatePatch 生成从 old 到 new 的补丁
+func CreatePatch(old, new []byte, w io.Writer) error {
+	header := make([]byte, 16)
+	copy(header, deltaMagic)
+	binary.LittleEndian.PutUint64(header[8:], uint64(len(new)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	gz, _ := gzip.NewWriterLevel(w, gzip.BestCompression)
+	bw := bufio.NewWriter(gz)
+	writeRecord := func(add, extra []byte, oldStart int, seek int64) error {
+		var ctrl [24]byte
+		binary.LittleEndian.PutUint64(ctrl[0:], uint64(len(add)))
+		binary.LittleEndian.PutUint64(ctrl[8:], uint64(len(extra)))
+		binary.LittleEndian.PutUint64(ctrl[16:], uint64(seek))
+		if _, err := bw.Write(ctrl[:]); err != nil {
+			return err
+		}
+		for i, b := range add {
+			bw.WriteByte(b - old[oldStart+i])
+		}
+		_, err := bw.Write(extra)
+		return err
+	}
+
+	if err := bsdiff(old, new, writeRecord); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// ApplyPatch 将补丁应用到 old，结果写入 w；maxSize 限制新文件大小（0 表示不限制）
+func ApplyPatch(old []byte, patch io.Reader, w io.Writer, maxSize int64) error {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(patch, header); err != nil || string(header[:8]) != deltaMagic {
+		return fmt.Errorf("不是有效的补丁文件")
+	}
+	newSize := int64(binary.LittleEndian.Uint64(header[8:]))
+	if newSize < 0 || (maxSize > 0 && newSize > maxSize) {
+		return fmt.Errorf("补丁生成的文件大小 %d 字节超过上限", newSize)
+	}
+
+	gz, err := gzip.NewReader(patch)
+	if err != nil {
+		return errCorruptPatch
+	}
+	defer gz.Close()
+	r := bufio.NewReader(gz)
+	bw := bufio.NewWriter(w)
+
+	var oldPos, newPos int64
+	var ctrl [24]byte
+	buf := make([]byte, 32<<10)
+	for newPos < newSize {
+		if _, err := io.ReadFull(r, ctrl[:]); err != nil {
+			return errCorruptPatch
+		}
+		add := int64(binary.LittleEndian.Uint64(ctrl[0:]))
+		extra := int64(binary.LittleEndian.Uint64(ctrl[8:]))
+		seek := int64(binary.LittleEndian.Uint64(ctrl[16:]))
+		if add < 0 || extra < 0 || add > newSize-newPos || extra > newSize-newPos-add {
+			return errCorruptPatch
+		}
+
+		for add > 0 {
+			n := int64(len(buf))
+			if n > add {
+				n = add
+			}
+			if _, err := io.ReadFull(r, buf[:n]); err != nil {
+				return errCorruptPatch
+			}
+			for i := int64(0); i < n; i++ {
+				if p := oldPos + i; p >= 0 && p < int64(len(old)) {
+					buf[i] += old[p]
+				}
+			}
+			if _, err := bw.Write(buf[:n]); err != nil {
+				return err
+			}
+			add -= n
+			oldPos += n
+			newPos += n
+		}
+
+		if _, err := io.CopyN(bw, r, extra); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return errCorruptPatch
+			}
+			return err
+		}
+		newPos += extra
+		oldPos += seek
+	}
+	return bw.Flush()
+}
+
+// applyPatchFile 将补丁文件应用到 oldPath，结果写入 outputPath
+func applyPatchFile(oldPath, patchPath, outputPath string, maxSize int64) error {
+	old, err := os.ReadFile(oldPath)
+	if err != nil {
+		return fmt.Errorf("读取当前版本失败: %v", err)
+	}
+	patch, err := os.Open(patchPath)
+	if err != nil {
+		return err
+	}
+	defer patch.Close()
+
+	out, err := os.OpenFile(outputPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return fmt.Errorf("创建文件失败: %v", err)
+	}
+	err = ApplyPatch(old, bufio.NewReader(patch), out, maxSize)
+	closeErr := out.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(outputPath)
+		return err
+	}
+	return nil
+}
+
+// bsdiff 使用 bsdiff 算法对比 old 和 new，对每段输出一条记录
+// emit 的参数：与旧文件 old[oldStart:] 做差的新内容、直接写入的新内容、旧文件读取位置的偏移
+func bsdiff(old, new []byte, emit func(add, extra []byte, oldStart int, seek int64) error) error {
+	if len(old) == 0 {
+		return emit(nil, new, 0, 0)
+	}
+	I := suffixSort(old)
+
+	var scan, pos, length int
+	var lastScan, lastPos, lastOffset int
+	for scan < len(new) {
+		oldScore := 0
+		scan += length
+		for scsc := scan; scan < len(new); scan++ {
+			pos, length = search(I, old, new[scan:], 0, len(old))
+			for ; scsc < scan+length; scsc++ {
+				if scsc+lastOffset < len(old) && old[scsc+lastOffset] == new[scsc] {
+					oldScore++
+				}
+			}
+			if (length == oldScore && length != 0) || length > oldScore+8 {
+				break
+			}
+			if scan+lastOffset < len(old) && old[scan+lastOffset] == new[scan] {
+				oldScore--
+			}
+		}
+
+		if length == oldScore && scan != len(new) {
+			continue
+		}
+
+		// 向前扩展：从上一个匹配位置开始，差异不超过一半的区域
+		s, sf, lenf := 0, 0, 0
+		for i := 0; lastScan+i < scan && lastPos+i < len(old); {
+			if old[lastPos+i] == new[lastScan+i] {
+				s++
+			}
+			i++
+			if s*2-i > sf*2-lenf {
+				sf, lenf = s, i
+			}
+		}
+
+		// 向后扩展：从当前匹配位置往回
+		lenb := 0
+		if scan < len(new) {
+			s, sb := 0, 0
+			for i := 1; scan >= lastScan+i && pos >= i; i++ {
+				if old[pos-i] == new[scan-i] {
+					s++
+				}
+				if s*2-i > sb*2-lenb {
+					sb, lenb = s, i
+				}
+			}
+		}
+
+		// 两个方向重叠时取最佳分界点
+		if lastScan+lenf > scan-lenb {
+			overlap := (lastScan + lenf) - (scan - lenb)
+			s, ss, lens := 0, 0, 0
+			for i := 0; i < overlap; i++ {
+				if new[lastScan+lenf-overlap+i] == old[lastPos+lenf-overlap+i] {
+					s++
+				}
+				if new[scan-lenb+i] == old[pos-lenb+i] {
+					s--
+				}
+				if s > ss {
+					ss, lens = s, i+1
+				}
+			}
+			lenf += lens - overlap
+			lenb -= lens
+		}
+
+		add := new[lastScan : lastScan+lenf]
+		extra := new[lastScan+lenf : scan-lenb]
+		seek := int64((pos - lenb) - (lastPos + lenf))
+		if err := emit(add, extra, lastPos, seek); err != nil {
+			return err
+		}
+
+		lastScan = scan - lenb
+		lastPos = pos - lenb
+		lastOffset = pos - scan
+	}
+	return nil
+}
+
+// search 在后缀数组中二分查找与 target 最长匹配的位置
+func search(I []int, old, target []byte, st, en int) (int, int) {
+	for en-st >= 2 {
+		x := st + (en-st)/2
+		n := len(old) - I[x]
+		if n > len(target) {
+			n = len(target)
+		}
+		if bytes.Compare(old[I[x]:I[x]+n], target[:n]) < 0 {
+			st = x
+		} else {
+			en = x
+		}
+	}
+	x := matchLen(old[I[st]:], target)
+	y := matchLen(old[I[en]:], target)
+	if x > y {
+		return I[st], x
+	}
+	return I[en], y
+}
+
+// matchLen 返回 a 和 b 的公共前缀长度
+func matchLen(a, b []byte) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// suffixSort 使用 Larsson-Sadakane qsufsort 构建后缀数组（长度 len(buf)+1，含空后缀）
+func suffixSort(buf []byte) []int {
+	n := len(buf)
+	I := make([]int, n+1)
+	V := make([]int, n+1)
+
+	var buckets [256]int
+	for _, c := range buf {
+		buckets[c]++
+	}
+	for i := 1; i < 256; i++ {
+		buckets[i] += buckets[i-1]
+	}
+	copy(buckets[1:], buckets[:255])
+	buckets[0] = 0
+
+	for i, c := range buf {
+		buckets[c]++
+		I[buckets[c]] = i
+	}
+	I[0] = n
+	for i, c := range buf {
+		V[i] = buckets[c]
+	}
+	V[n] = 0
+	for i := 1; i < 256; i++ {
+		if buckets[i] == buckets[i-1]+1 {
+			I[buckets[i]] = -1
+		}
+	}
+	I[0] = -1
+
+	for h := 1; I[0] != -(n + 1); h += h {
+		length := 0
+		i := 0
+		for i < n+1 {
+			if I[i] < 0 {
+				length -= I[i]
+				i -= I[i]
+			} else {
+				if length != 0 {
+					I[i-length] = -length
+				}
+				length = V[I[i]] + 1 - i
+				split(I, V, i, length, h)
+				i += length
+				length = 0
+			}
+		}
+		if length != 0 {
+			I[i-length] = -length
+		}
+	}
+
+	for i := 0; i < n+1; i++ {
+		I[V[i]] = i
+	}
+	return I
+}
+
+// split qsufsort 的三路划分
+func split(I, V []int, start, length, h int) {
+	if length < 16 {
+		for k := start; k < start+length; {
+			j := 1
+			x := V[I[k]+h]
+			for i := 1; k+i < start+length; i++ {
+				if v := V[I[k+i]+h]; v < x {
+					x = v
+					j = 0
+				}
+				if V[I[k+i]+h] == x {
+					I[k+j], I[k+i] = I[k+i], I[k+j]
+					j++
+				}
+			}
+			for i := 0; i < j; i++ {
+				V[I[k+i]] = k + j - 1
+			}
+			if j == 1 {
+				I[k] = -1
+			}
+			k += j
+		}
+		return
+	}
+
+	x := V[I[start+length/2]+h]
+	jj, kk := 0, 0
+	for i := start; i < start+length; i++ {
+		if V[I[i]+h] < x {
+			jj++
+		}
+		if V[I[i]+h] == x {
+			kk++
+		}
+	}
+	jj += start
+	kk += jj
+
+	i, j, k := start, 0, 0
+	for i < jj {
+		switch v := V[I[i]+h]; {
+		case v < x:
+			i++
+		case v == x:
+			I[i], I[jj+j] = I[jj+j], I[i]
+			j++
+		default:
+			I[i], I[kk+k] = I[kk+k], I[i]
+			k++
+		}
+	}
+	for jj+j < kk {
+		if V[I[jj+j]+h] == x {
+			j++
+		} else {
+			I[jj+j], I[kk+k] = I[kk+k], I[jj+j]
+			k++
+		}
+	}
+
+	if jj > start {
+		split(I, V, start, jj-start, h)
+	}
+	for i := 0; i < kk-jj; i++ {
+		V[I[jj+i]] = kk - 1
+	}
+	if jj == kk-1 {
+		I[jj] = -1
+	}
+	if start+length > kk {
+		split(I, V, kk, start+length-kk, h)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"testing"
+)
+
+// rawPatch 按补丁格式直接拼出补丁：文件头声明 newSize，body 为 gzip 压缩前的记录流
+func rawPatch(newSize int64, body []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(deltaMagic)
+	binary.Write(&buf, binary.LittleEndian, newSize)
+	gz := gzip.NewWriter(&buf)
+	gz.Write(body)
+	gz.Close()
+	return buf.Bytes()
+}
+
+// patchRecord 返回一条记录：控制字段和之后的数据
+func patchRecord(add, extra, seek int64, data []byte) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, [3]int64{add, extra, seek})
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+func TestPatchRoundTrip(t *testing.T) {
+	base := incompressible(64 << 10)
+
+	edited := append([]byte(nil), base...)
+	copy(edited[1000:], "new version string")
+	edited[40000] ^= 0xff
+
+	inserted := append(append(append([]byte(nil), base[:30000]...), incompressible(5000)...), base[30000:]...)
+	deleted := append(append([]byte(nil), base[:10000]...), base[20000:]...)
+	moved := append(append([]byte(nil), base[32<<10:]...), base[:32<<10]...)
+
+	tests := []struct {
+		name     string
+		old, new []byte
+	}{
+		{"相同", base, base},
+		{"修改少量字节", base, edited},
+		{"插入", base, inserted},
+		{"删除", base, deleted},
+		{"移动", base, moved},
+		{"完全不同", base, bytes.Repeat([]byte("polywin"), 2000)},
+		{"旧版本为空", nil, []byte("brand new")},
+		{"新版本为空", base, []byte{}},
+		{"短文本", []byte("hello world"), []byte("hello, brave new world")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var patch bytes.Buffer
+			if err := CreatePatch(tt.old, tt.new, &patch); err != nil {
+				t.Fatalf("CreatePatch: %v", err)
+			}
+			var out bytes.Buffer
+			if err := ApplyPatch(tt.old, bytes.NewReader(patch.Bytes()), &out, 0); err != nil {
+				t.Fatalf("ApplyPatch: %v", err)
+			}
+			if !bytes.Equal(out.Bytes(), tt.new) {
+				t.Fatalf("还原结果不一致（%d 字节，期望 %d 字节）", out.Len(), len(tt.new))
+			}
+		})
+	}
+
+	// 相似的版本生成的补丁应远小于新版本
+	var patch bytes.Buffer
+	CreatePatch(base, edited, &patch)
+	if patch.Len() > len(edited)/10 {
+		t.Errorf("补丁 %d 字节，新版本 %d 字节", patch.Len(), len(edited))
+	}
+}
+
+func TestApplyPatchRejectsCorrupt(t *testing.T) {
+	old := []byte("0123456789abcdef")
+	var valid bytes.Buffer
+	if err := CreatePatch(old, []byte("0123456789ABCDEF-extra"), &valid); err != nil {
+		t.Fatal(err)
+	}
+
+	notGzip := append([]byte(nil), valid.Bytes()[:16]...)
+	notGzip = append(notGzip, "not gzip data"...)
+
+	tests := []struct {
+		name    string
+		patch   []byte
+		maxSize int64
+		corrupt bool // 期望返回 errCorruptPatch，否则只要求返回错误
+	}{
+		{"空文件", nil, 0, false},
+		{"文件头错误", append([]byte("BSDIFF40"), valid.Bytes()[8:]...), 0, false},
+		{"超过大小上限", valid.Bytes(), 8, false},
+		{"新文件大小为负", rawPatch(-1, nil), 0, false},
+		{"不是 gzip", notGzip, 0, true},
+		{"截断", valid.Bytes()[:valid.Len()/2+8], 0, true},
+		{"记录不足", rawPatch(32, patchRecord(0, 4, 0, []byte("abcd"))), 0, true},
+		{"控制字段为负", rawPatch(4, patchRecord(-1, 4, 0, []byte("abcd"))), 0, true},
+		{"差值超出新文件大小", rawPatch(4, patchRecord(8, 0, 0, make([]byte, 8))), 0, true},
+		{"新内容超出新文件大小", rawPatch(4, patchRecord(0, 8, 0, []byte("abcdefgh"))), 0, true},
+		{"数据不足", rawPatch(8, patchRecord(0, 8, 0, []byte("abc"))), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := ApplyPatch(old, bytes.NewReader(tt.patch), &out, tt.maxSize)
+			if err == nil {
+				t.Fatal("期望返回错误")
+			}
+			if tt.corrupt && err != errCorruptPatch {
+				t.Errorf("ApplyPatch = %v，期望 errCorruptPatch", err)
+			}
+		})
+	}
+}
+
+func TestApplyPatchRecords(t *testing.T) {
+	// 手工构造的补丁：差值与旧文件对应位置的字节相加，seek 为负时旧文件读取位置向回移动
+	old := []byte("abcdef")
+	var body []byte
+	body = append(body, patchRecord(3, 1, 2, []byte{0, 0, 1, 'X'})...) // abd + X，跳过 de
+	body = append(body, patchRecord(1, 0, -5, []byte{0})...)           // f，回到 b
+	body = append(body, patchRecord(2, 0, 0, []byte{0, 0})...)         // bc
+	var out bytes.Buffer
+	if err := ApplyPatch(old, bytes.NewReader(rawPatch(7, body)), &out, 0); err != nil {
+		t.Fatalf("ApplyPatch: %v", err)
+	}
+	if out.String() != "abdXfbc" {
+		t.Errorf("结果为 %q", out.String())
+	}
+}
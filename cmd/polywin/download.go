@@ -0,0 +1,699 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// metadataSizeLimit 元数据（版本信息、校验和、签名）大小上限
+const metadataSizeLimit = 1 << 20
+
+// artifactExpectation 下载文件的完整性要求
+type artifactExpectation struct {
+	Checksum *Checksum // 为 nil 时不校验
+	Size     int64     // 期望大小，0 表示不校验
+	MaxSize  int64     // 大小上限，0 表示不限制
+}
+
+// integrityError 下载文件未通过完整性校验，属于不可重试的错误
+type integrityError struct {
+	msg string
+}
+
+func (e *integrityError) Error() string { return e.msg }
+
+// fetchSmall 下载小文件（版本信息、校验和、签名），404 时返回 nil
+func fetchSmall(ctx context.Context, url string) ([]byte, error) {
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %v", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP 状态码: %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, metadataSizeLimit))
+	if err != nil {
+		return nil, fmt.Errorf("读取失败: %v", err)
+	}
+	return data, nil
+}
+
+// saveArtifact 将发布产物写入 outputPath，并按 expect 校验大小和校验和
+// length 为已知的内容长度（未知时 <= 0），用于在写入前提前拒绝；校验失败时删除已写入的文件
+func saveArtifact(r io.Reader, length int64, outputPath string, expect artifactExpectation) error {
+	if length > 0 {
+		if expect.MaxSize > 0 && length > expect.MaxSize {
+			return &integrityError{fmt.Sprintf("文件大小 %d 字节超过上限 %d 字节", length, expect.MaxSize)}
+		}
+		if expect.Size > 0 && length != expect.Size {
+			return &integrityError{fmt.Sprintf("文件大小不匹配: 期望 %d 字节，实际 %d 字节", expect.Size, length)}
+		}
+	}
+
+	outFile, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("创建文件失败: %v", err)
+	}
+
+	body := r
+	if expect.MaxSize > 0 {
+		// 多读 1 字节用于判断是否超限
+		body = io.LimitReader(r, expect.MaxSize+1)
+	}
+
+	var w io.Writer = outFile
+	var h hash.Hash
+	if expect.Checksum != nil {
+		if h, err = expect.Checksum.newHash(); err != nil {
+			outFile.Close()
+			os.Remove(outputPath)
+			return &integrityError{err.Error()}
+		}
+		w = io.MultiWriter(outFile, h)
+	}
+
+	written, err := io.Copy(w, body)
+	closeErr := outFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(outputPath)
+		return fmt.Errorf("写入文件失败: %v", err)
+	}
+
+	if written == 0 {
+		os.Remove(outputPath)
+		return fmt.Errorf("下载的文件为空")
+	}
+
+	if expect.MaxSize > 0 && written > expect.MaxSize {
+		os.Remove(outputPath)
+		return &integrityError{fmt.Sprintf("文件大小超过上限 %d 字节", expect.MaxSize)}
+	}
+	if expect.Size > 0 && written != expect.Size {
+		os.Remove(outputPath)
+		return &integrityError{fmt.Sprintf("文件大小不匹配: 期望 %d 字节，实际 %d 字节", expect.Size, written)}
+	}
+	if h != nil {
+		if err := expect.Checksum.Verify(h.Sum(nil)); err != nil {
+			os.Remove(outputPath)
+			return &integrityError{err.Error()}
+		}
+		log.Printf("校验和验证通过 (%s)", expect.Checksum.Algorithm)
+	}
+
+	log.Printf("下载完成，文件大小: %d 字节", written)
+	return nil
+}
+
+// 下载器默认参数
+const (
+	defaultDownloadRetries     = 3
+	defaultDownloadRetryDelay  = 2 * time.Second
+	defaultDownloadIdleTimeout = 30 * time.Second
+	defaultDownloadChunkSize   = 8 << 20
+	maxDownloadRetryDelay      = time.Minute
+	progressLogInterval        = 5 * time.Second
+)
+
+// Downloader 下载引擎，首次下载和更新共用
+// 下载内容先写入 <输出文件>.partial，进度记录在 .partial.json 中：失败后按指数退避重试，
+// 重试和守护程序重启后都通过 HTTP Range 从断点继续；每个分块单独计算空闲超时而不是限制总时长；
+// 文件足够大且服务器支持 Range 时可以并行下载多个分块
+type Downloader struct {
+	Client      *http.Client  // 不设置总超时，由 IdleTimeout 控制
+	Retries     int           // 失败后的重试次数
+	RetryDelay  time.Duration // 首次重试等待时间，之后每次翻倍
+	IdleTimeout time.Duration // 分块在该时间内没有收到数据则中止并重试
+	Parallel    int           // 并行分块数，1 表示不分块
+	ChunkSize   int64         // 每个分块的最小大小，文件小于 2 个分块时不分块
+
+	OnProgress func(DownloadProgress) // 下载进度回调
+}
+
+// DownloadProgress 下载进度
+type DownloadProgress struct {
+	URL        string    `json:"url"`
+	Downloaded int64     `json:"downloaded"`
+	Total      int64     `json:"total"` // 0 表示未知
+	Chunks     int       `json:"chunks"`
+	Attempt    int       `json:"attempt"`
+	StartedAt  time.Time `json:"started_at"`
+}
+
+// partialState 未完成下载的进度，保存在 .partial.json 中
+type partialState struct {
+	URL       string       `json:"url"`
+	Validator string       `json:"validator,omitempty"` // ETag 或 Last-Modified，续传时用于 If-Range
+	Total     int64        `json:"total"`               // 0 表示未知
+	Chunks    []chunkState `json:"chunks"`
+}
+
+// chunkState 分块进度
+type chunkState struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`  // 最后一个字节的位置（含），-1 表示到文件末尾
+	Done  int64 `json:"done"` // 已写入的字节数
+}
+
+// remaining 分块是否未完成
+func (c *chunkState) remaining() bool {
+	return c.End < 0 || c.Start+c.Done <= c.End
+}
+
+// errRestartDownload 已下载的部分不能继续使用（文件已变化或服务器不再支持 Range），需要从头下载
+var errRestartDownload = errors.New("服务器上的文件已变化，重新下载")
+
+// statusError 非预期的 HTTP 状态码
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string { return fmt.Sprintf("HTTP 状态码: %d", e.code) }
+
+// NewDownloader 使用默认参数创建下载器
+func NewDownloader() *Downloader {
+	return &Downloader{
+		Client:      &http.Client{},
+		Retries:     defaultDownloadRetries,
+		RetryDelay:  defaultDownloadRetryDelay,
+		IdleTimeout: defaultDownloadIdleTimeout,
+		Parallel:    1,
+		ChunkSize:   defaultDownloadChunkSize,
+	}
+}
+
+// Download 下载 url 到 outputPath，并按 expect 校验大小和校验和
+// prepare 用于设置额外的请求头（如认证），可以为 nil
+// 网络错误时保留 .partial 文件，下次调用从断点继续；完整性校验失败时删除
+func (d *Downloader) Download(ctx context.Context, url, outputPath string, expect artifactExpectation, prepare func(*http.Request)) error {
+	partialPath := outputPath + ".partial"
+	statePath := partialPath + ".json"
+
+	state := loadPartialState(statePath, partialPath)
+	if state == nil || state.URL != url {
+		if state != nil {
+			log.Printf("已下载的部分来自其他地址，重新下载")
+		}
+		os.Remove(partialPath)
+		os.Remove(statePath)
+		state = &partialState{URL: url}
+	} else if downloaded := state.downloaded(); downloaded > 0 {
+		log.Printf("从断点继续下载（已下载 %d 字节）", downloaded)
+	}
+
+	progress := &progressReporter{d: d, p: DownloadProgress{URL: url, StartedAt: time.Now()}}
+	delay := d.RetryDelay
+	for attempt := 0; ; attempt++ {
+		progress.attempt(attempt + 1)
+		err := d.attempt(ctx, state, partialPath, statePath, expect, prepare, progress)
+		if err == nil {
+			break
+		}
+
+		var integrity *integrityError
+		switch {
+		case errors.As(err, &integrity):
+			os.Remove(partialPath)
+			os.Remove(statePath)
+			return err
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err == errRestartDownload:
+			os.Remove(partialPath)
+			os.Remove(statePath)
+			state = &partialState{URL: url}
+		case !retryable(err):
+			return err
+		}
+
+		if attempt >= d.Retries {
+			return fmt.Errorf("下载失败（已重试 %d 次）: %v", d.Retries, err)
+		}
+		log.Printf("下载中断: %v，%v 后重试（%d/%d）", err, delay, attempt+1, d.Retries)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > maxDownloadRetryDelay {
+			delay = maxDownloadRetryDelay
+		}
+	}
+
+	if err := finishPartial(partialPath, state, expect); err != nil {
+		os.Remove(partialPath)
+		os.Remove(statePath)
+		return err
+	}
+	os.Remove(statePath)
+	if err := os.Rename(partialPath, outputPath); err != nil {
+		return fmt.Errorf("移动下载文件失败: %v", err)
+	}
+	log.Printf("下载完成，文件大小: %d 字节", state.Total)
+	return nil
+}
+
+// attempt 下载所有未完成的分块；首次下载时先确定文件大小并规划分块
+func (d *Downloader) attempt(ctx context.Context, state *partialState, partialPath, statePath string, expect artifactExpectation, prepare func(*http.Request), progress *progressReporter) error {
+	var first *http.Response
+	if len(state.Chunks) == 0 {
+		resp, err := d.get(ctx, state.URL, "bytes=0-", "", prepare)
+		if err != nil {
+			return err
+		}
+		if err := d.plan(state, resp, expect); err != nil {
+			resp.Body.Close()
+			return err
+		}
+		first = resp
+		if err := state.save(statePath); err != nil {
+			resp.Body.Close()
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(partialPath, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		if first != nil {
+			first.Body.Close()
+		}
+		return fmt.Errorf("创建文件失败: %v", err)
+	}
+	defer f.Close()
+
+	progress.start(state)
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(state.Chunks))
+	for i := range state.Chunks {
+		c := &state.Chunks[i]
+		if !c.remaining() && c.End >= 0 {
+			continue
+		}
+		var resp *http.Response
+		if i == 0 && first != nil {
+			resp, first = first, nil
+		}
+		wg.Add(1)
+		go func(i int, c *chunkState, resp *http.Response) {
+			defer wg.Done()
+			errs[i] = d.fetchChunk(ctx, state, c, f, resp, expect.MaxSize, prepare, progress)
+		}(i, c, resp)
+	}
+	if first != nil {
+		first.Body.Close()
+	}
+	wg.Wait()
+
+	// 保存进度，重试或下次启动时从断点继续
+	progress.mu.Lock()
+	saveErr := state.save(statePath)
+	progress.mu.Unlock()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	if saveErr != nil {
+		log.Printf("保存下载进度失败: %v", saveErr)
+	}
+	return nil
+}
+
+// plan 根据首个响应确定文件大小，规划分块
+func (d *Downloader) plan(state *partialState, resp *http.Response, expect artifactExpectation) error {
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		total, err := contentRangeTotal(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return err
+		}
+		state.Total = total
+	case http.StatusOK:
+		// 不支持 Range，只能单连接下载
+		if resp.ContentLength > 0 {
+			state.Total = resp.ContentLength
+		}
+	default:
+		return &statusError{resp.StatusCode}
+	}
+	state.Validator = validator(resp)
+
+	if state.Total > 0 {
+		if expect.MaxSize > 0 && state.Total > expect.MaxSize {
+			return &integrityError{fmt.Sprintf("文件大小 %d 字节超过上限 %d 字节", state.Total, expect.MaxSize)}
+		}
+		if expect.Size > 0 && state.Total != expect.Size {
+			return &integrityError{fmt.Sprintf("文件大小不匹配: 期望 %d 字节，实际 %d 字节", expect.Size, state.Total)}
+		}
+	}
+
+	chunks := 1
+	if resp.StatusCode == http.StatusPartialContent && d.Parallel > 1 && d.ChunkSize > 0 {
+		chunks = int(state.Total / d.ChunkSize)
+		if chunks > d.Parallel {
+			chunks = d.Parallel
+		}
+		if chunks < 2 {
+			chunks = 1
+		}
+	}
+
+	if state.Total == 0 {
+		state.Chunks = []chunkState{{Start: 0, End: -1}}
+		return nil
+	}
+	size := state.Total / int64(chunks)
+	for i := 0; i < chunks; i++ {
+		c := chunkState{Start: int64(i) * size, End: int64(i+1)*size - 1}
+		if i == chunks-1 {
+			c.End = state.Total - 1
+		}
+		state.Chunks = append(state.Chunks, c)
+	}
+	if chunks > 1 {
+		log.Printf("文件大小 %d 字节，分 %d 块并行下载", state.Total, chunks)
+	}
+	return nil
+}
+
+// fetchChunk 下载一个分块的剩余部分；resp 不为 nil 时直接读取已打开的响应
+// 大小未知的分块最多读取 maxSize+1 字节，超过上限立即中止（maxSize 为 0 时不限制）
+func (d *Downloader) fetchChunk(ctx context.Context, state *partialState, c *chunkState, f *os.File, resp *http.Response, maxSize int64, prepare func(*http.Request), progress *progressReporter) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if resp == nil {
+		rng := fmt.Sprintf("bytes=%d-", c.Start+c.Done)
+		if c.End >= 0 {
+			rng += strconv.FormatInt(c.End, 10)
+		}
+		var err error
+		if resp, err = d.get(ctx, state.URL, rng, state.Validator, prepare); err != nil {
+			return err
+		}
+		switch resp.StatusCode {
+		case http.StatusPartialContent:
+			if start, err := contentRangeStart(resp.Header.Get("Content-Range")); err != nil || start != c.Start+c.Done {
+				resp.Body.Close()
+				return errRestartDownload
+			}
+		case http.StatusOK, http.StatusRequestedRangeNotSatisfiable:
+			// 文件已变化（If-Range 不匹配）或服务器不再支持 Range：已下载的部分和大小都不可信，从头下载
+			resp.Body.Close()
+			return errRestartDownload
+		default:
+			resp.Body.Close()
+			return &statusError{resp.StatusCode}
+		}
+	}
+	defer resp.Body.Close()
+
+	// 空闲超时：每次收到数据后重新计时；关闭响应体使阻塞的读取立即返回
+	var idle atomic.Bool
+	timer := time.AfterFunc(d.IdleTimeout, func() {
+		idle.Store(true)
+		cancel()
+		resp.Body.Close()
+	})
+	defer timer.Stop()
+
+	var body io.Reader = resp.Body
+	switch {
+	case c.End >= 0:
+		body = io.LimitReader(resp.Body, c.End-(c.Start+c.Done)+1)
+	case maxSize > 0:
+		body = io.LimitReader(resp.Body, maxSize-(c.Start+c.Done)+1)
+	}
+
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			timer.Reset(d.IdleTimeout)
+			if _, werr := f.WriteAt(buf[:n], c.Start+c.Done); werr != nil {
+				return fmt.Errorf("写入文件失败: %v", werr)
+			}
+			progress.add(c, int64(n))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if idle.Load() {
+				return fmt.Errorf("%v 内没有收到数据", d.IdleTimeout)
+			}
+			return fmt.Errorf("读取失败: %v", err)
+		}
+	}
+
+	if c.End < 0 {
+		if maxSize > 0 && c.Start+c.Done > maxSize {
+			return &integrityError{fmt.Sprintf("文件大小超过上限 %d 字节", maxSize)}
+		}
+		// 大小未知的单分块：以实际收到的数据为准
+		progress.mu.Lock()
+		c.End = c.Start + c.Done - 1
+		state.Total = c.Done
+		progress.mu.Unlock()
+		return nil
+	}
+	if c.remaining() {
+		return fmt.Errorf("连接提前断开（分块 %d-%d 缺少 %d 字节）", c.Start, c.End, c.End-(c.Start+c.Done)+1)
+	}
+	return nil
+}
+
+// get 发送 GET 请求；空闲超时从发出请求开始计时，服务器迟迟不返回响应头时同样中止
+func (d *Downloader) get(ctx context.Context, url, rng, ifRange string, prepare func(*http.Request)) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("创建请求失败: %v", err)
+	}
+	req.Header.Set("User-Agent", "PolyWin-Updater/1.0")
+	req.Header.Set("Range", rng)
+	if ifRange != "" {
+		req.Header.Set("If-Range", ifRange)
+	}
+	if prepare != nil {
+		prepare(req)
+	}
+
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	timer := time.AfterFunc(d.IdleTimeout, cancel)
+	resp, err := client.Do(req)
+	if !timer.Stop() {
+		if err == nil {
+			resp.Body.Close()
+		}
+		cancel()
+		return nil, fmt.Errorf("%v 内没有收到响应", d.IdleTimeout)
+	}
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("请求失败: %v", err)
+	}
+	resp.Body = &cancelOnClose{resp.Body, cancel}
+	return resp, nil
+}
+
+// cancelOnClose 关闭响应体时取消请求的上下文
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// finishPartial 下载完成后截断多余内容，并校验大小和校验和
+func finishPartial(partialPath string, state *partialState, expect artifactExpectation) error {
+	if state.Total == 0 {
+		return fmt.Errorf("下载的文件为空")
+	}
+	if err := os.Truncate(partialPath, state.Total); err != nil {
+		return fmt.Errorf("截断文件失败: %v", err)
+	}
+	return verifyArtifact(partialPath, state.Total, expect)
+}
+
+// verifyArtifact 按 expect 校验大小为 size 的文件
+func verifyArtifact(path string, size int64, expect artifactExpectation) error {
+	if expect.MaxSize > 0 && size > expect.MaxSize {
+		return &integrityError{fmt.Sprintf("文件大小超过上限 %d 字节", expect.MaxSize)}
+	}
+	if expect.Size > 0 && size != expect.Size {
+		return &integrityError{fmt.Sprintf("文件大小不匹配: 期望 %d 字节，实际 %d 字节", expect.Size, size)}
+	}
+	if expect.Checksum != nil {
+		if err := expect.Checksum.VerifyFile(path); err != nil {
+			return &integrityError{err.Error()}
+		}
+		log.Printf("校验和验证通过 (%s)", expect.Checksum.Algorithm)
+	}
+	return nil
+}
+
+// retryable 错误是否值得重试：网络错误、5xx、408 和 429 可以重试，其他 HTTP 状态码不重试
+func retryable(err error) bool {
+	var status *statusError
+	if errors.As(err, &status) {
+		return status.code >= 500 || status.code == http.StatusRequestTimeout || status.code == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// validator 返回响应的 ETag（弱 ETag 不能用于 If-Range），没有时返回 Last-Modified
+func validator(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+// contentRangeStart 解析 Content-Range 的起始位置（bytes 100-199/1000）
+func contentRangeStart(v string) (int64, error) {
+	v = strings.TrimPrefix(v, "bytes ")
+	if i := strings.IndexByte(v, '-'); i > 0 {
+		return strconv.ParseInt(v[:i], 10, 64)
+	}
+	return 0, fmt.Errorf("无效的 Content-Range: %s", v)
+}
+
+// contentRangeTotal 解析 Content-Range 的文件总大小
+func contentRangeTotal(v string) (int64, error) {
+	if i := strings.LastIndexByte(v, '/'); i >= 0 {
+		if total, err := strconv.ParseInt(v[i+1:], 10, 64); err == nil && total > 0 {
+			return total, nil
+		}
+	}
+	return 0, fmt.Errorf("无效的 Content-Range: %s", v)
+}
+
+// loadPartialState 读取未完成下载的进度，进度与 .partial 文件不一致时返回 nil
+func loadPartialState(statePath, partialPath string) *partialState {
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		return nil
+	}
+	var state partialState
+	if err := json.Unmarshal(data, &state); err != nil || len(state.Chunks) == 0 {
+		return nil
+	}
+	if _, err := os.Stat(partialPath); err != nil {
+		return nil
+	}
+	return &state
+}
+
+// save 保存下载进度
+func (s *partialState) save(path string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// downloaded 已下载的字节数
+func (s *partialState) downloaded() int64 {
+	var n int64
+	for _, c := range s.Chunks {
+		n += c.Done
+	}
+	return n
+}
+
+// progressReporter 汇总各分块的进度，定期输出日志并回调 OnProgress
+type progressReporter struct {
+	d       *Downloader
+	mu      sync.Mutex
+	p       DownloadProgress
+	lastLog time.Time
+}
+
+// attempt 记录当前尝试次数
+func (r *progressReporter) attempt(n int) {
+	r.mu.Lock()
+	r.p.Attempt = n
+	r.mu.Unlock()
+}
+
+// start 开始下载分块时记录总大小和已下载量
+func (r *progressReporter) start(state *partialState) {
+	r.mu.Lock()
+	r.p.Total = state.Total
+	r.p.Chunks = len(state.Chunks)
+	r.p.Downloaded = state.downloaded()
+	p := r.p
+	r.mu.Unlock()
+	r.report(p)
+}
+
+// add 累加分块进度（delta 为负数表示分块从头开始）
+func (r *progressReporter) add(c *chunkState, delta int64) {
+	r.mu.Lock()
+	c.Done += delta
+	r.p.Downloaded += delta
+	p := r.p
+	logNow := time.Since(r.lastLog) >= progressLogInterval
+	if logNow {
+		r.lastLog = time.Now()
+	}
+	r.mu.Unlock()
+
+	if logNow {
+		if p.Total > 0 {
+			log.Printf("下载进度: %d / %d 字节 (%.1f%%)", p.Downloaded, p.Total, float64(p.Downloaded)*100/float64(p.Total))
+		} else {
+			log.Printf("下载进度: %d 字节", p.Downloaded)
+		}
+	}
+	r.report(p)
+}
+
+// report 回调进度
+func (r *progressReporter) report(p DownloadProgress) {
+	if r.d.OnProgress != nil {
+		r.d.OnProgress(p)
+	}
+}
@@ -0,0 +1,458 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testFileServer 模拟发布产物的下载服务器，记录每个请求的 Range 和 If-Range
+type testFileServer struct {
+	mu          sync.Mutex
+	content     []byte
+	etag        string
+	ignoreRange bool          // 不支持 Range，总是返回 200 和完整内容
+	noLength    bool          // 不返回 Content-Length
+	cutAfter    int           // 大于 0 时下一个响应只发送这么多字节就断开
+	stallHeader bool          // 不返回响应头，直到客户端断开
+	stallAfter  int           // 大于 0 时发送这么多字节后不再发送，直到客户端断开
+	status      int           // 非 0 时直接返回该状态码
+	ranges      []string      // 收到的 Range 请求头
+	ifRanges    []string      // 收到的 If-Range 请求头
+	sent        int           // 已发送的字节数
+	release     chan struct{} // 测试结束时关闭，结束阻塞的请求
+}
+
+// newTestFileServer 启动下载服务器
+func newTestFileServer(t *testing.T, content []byte) (*testFileServer, *httptest.Server) {
+	t.Helper()
+	s := &testFileServer{content: content, etag: `"v1"`, release: make(chan struct{})}
+	srv := httptest.NewServer(s)
+	t.Cleanup(func() {
+		close(s.release)
+		srv.Close()
+	})
+	return s, srv
+}
+
+// update 修改服务器状态
+func (s *testFileServer) update(f func(s *testFileServer)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f(s)
+}
+
+// requests 返回收到的 Range 和 If-Range 请求头
+func (s *testFileServer) requests() ([]string, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.ranges...), append([]string(nil), s.ifRanges...)
+}
+
+func (s *testFileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.ranges = append(s.ranges, r.Header.Get("Range"))
+	s.ifRanges = append(s.ifRanges, r.Header.Get("If-Range"))
+	content, etag, status := s.content, s.etag, s.status
+	ignoreRange, noLength, stallHeader := s.ignoreRange, s.noLength, s.stallHeader
+	cut, stall := s.cutAfter, s.stallAfter
+	s.cutAfter = 0
+	s.mu.Unlock()
+
+	if status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+	if stallHeader {
+		s.wait(r)
+		return
+	}
+
+	out := &testResponseWriter{ResponseWriter: w, s: s, limit: -1}
+	switch {
+	case cut > 0:
+		out.limit = cut
+	case stall > 0:
+		out.limit = stall
+		out.stall = func() { s.wait(r) }
+	}
+
+	w.Header().Set("ETag", etag)
+	if ignoreRange || noLength {
+		if !noLength {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		}
+		w.WriteHeader(http.StatusOK)
+		for off := 0; off < len(content); off += 1024 {
+			end := off + 1024
+			if end > len(content) {
+				end = len(content)
+			}
+			if _, err := out.Write(content[off:end]); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+		}
+		return
+	}
+	http.ServeContent(out, r, "server", time.Time{}, bytes.NewReader(content))
+}
+
+// wait 阻塞到客户端断开或测试结束
+func (s *testFileServer) wait(r *http.Request) {
+	select {
+	case <-r.Context().Done():
+	case <-s.release:
+	}
+}
+
+// testResponseWriter 发送 limit 字节后断开（stall 不为 nil 时改为阻塞）
+type testResponseWriter struct {
+	http.ResponseWriter
+	s     *testFileServer
+	limit int // 小于 0 时不限制
+	stall func()
+}
+
+func (w *testResponseWriter) Write(p []byte) (int, error) {
+	if w.limit >= 0 && len(p) > w.limit {
+		p = p[:w.limit]
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.s.mu.Lock()
+	w.s.sent += n
+	w.s.mu.Unlock()
+	if w.limit >= 0 {
+		w.limit -= n
+		if w.limit == 0 {
+			w.ResponseWriter.(http.Flusher).Flush()
+			if w.stall != nil {
+				w.stall()
+			}
+			return n, errors.New("测试服务器断开连接")
+		}
+	}
+	return n, err
+}
+
+// newTestDownloader 返回重试间隔很短的下载器
+func newTestDownloader() *Downloader {
+	d := NewDownloader()
+	d.RetryDelay = time.Millisecond
+	d.IdleTimeout = 2 * time.Second
+	return d
+}
+
+// sha256Checksum 返回 content 的 sha256 校验和
+func sha256Checksum(content []byte) *Checksum {
+	sum := sha256.Sum256(content)
+	return &Checksum{Algorithm: "sha256", Sum: sum[:]}
+}
+
+// incompressible 返回难以压缩的数据
+func incompressible(n int) []byte {
+	data := make([]byte, n)
+	x := uint32(2463534242)
+	for i := range data {
+		x ^= x << 13
+		x ^= x >> 17
+		x ^= x << 5
+		data[i] = byte(x)
+	}
+	return data
+}
+
+func TestDownload(t *testing.T) {
+	content := incompressible(100 << 10)
+	tests := []struct {
+		name       string
+		setup      func(s *testFileServer)
+		parallel   int
+		wantRanges int // 期望的请求数
+	}{
+		{"单连接", nil, 1, 1},
+		{"并行分块", nil, 4, 4},
+		{"服务器不支持 Range", func(s *testFileServer) { s.ignoreRange = true }, 4, 1},
+		{"大小未知", func(s *testFileServer) { s.noLength = true }, 4, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, srv := newTestFileServer(t, content)
+			if tt.setup != nil {
+				s.update(tt.setup)
+			}
+			d := newTestDownloader()
+			d.Parallel = tt.parallel
+			d.ChunkSize = 16 << 10
+
+			out := filepath.Join(t.TempDir(), "server.new")
+			expect := artifactExpectation{Checksum: sha256Checksum(content), MaxSize: 1 << 20}
+			if err := d.Download(context.Background(), srv.URL, out, expect, nil); err != nil {
+				t.Fatalf("Download: %v", err)
+			}
+			if data, _ := os.ReadFile(out); !bytes.Equal(data, content) {
+				t.Fatalf("下载的内容不一致（%d 字节）", len(data))
+			}
+			if ranges, _ := s.requests(); len(ranges) != tt.wantRanges {
+				t.Errorf("请求 %v，期望 %d 个", ranges, tt.wantRanges)
+			}
+			assertNoPartial(t, out)
+		})
+	}
+}
+
+// assertNoPartial 下载结束后不应留下 .partial 和进度文件
+func assertNoPartial(t *testing.T, out string) {
+	t.Helper()
+	for _, path := range []string{out + ".partial", out + ".partial.json"} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s 没有删除: %v", filepath.Base(path), err)
+		}
+	}
+}
+
+func TestDownloadResume(t *testing.T) {
+	content := incompressible(64 << 10)
+	const cut = 20 << 10
+
+	tests := []struct {
+		name       string
+		resume     func(s *testFileServer) // 断开后修改服务器
+		restart    bool                    // 模拟守护程序重启：第一次下载不重试，第二次调用从断点继续
+		want       []byte
+		wantRanges []string
+	}{
+		{
+			name:       "重试时从断点继续",
+			want:       content,
+			wantRanges: []string{"bytes=0-", "bytes=20480-65535"},
+		},
+		{
+			name:       "守护程序重启后从断点继续",
+			restart:    true,
+			want:       content,
+			wantRanges: []string{"bytes=0-", "bytes=20480-65535"},
+		},
+		{
+			name:       "续传时服务器返回 200：从头下载",
+			resume:     func(s *testFileServer) { s.ignoreRange = true },
+			want:       content,
+			wantRanges: []string{"bytes=0-", "bytes=20480-65535", "bytes=0-"},
+		},
+		{
+			name: "续传时文件已变化：从头下载新文件",
+			resume: func(s *testFileServer) {
+				s.content = bytes.Repeat([]byte("new version "), 5000)
+				s.etag = `"v2"`
+			},
+			want:       bytes.Repeat([]byte("new version "), 5000),
+			wantRanges: []string{"bytes=0-", "bytes=20480-65535", "bytes=0-"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, srv := newTestFileServer(t, content)
+			s.update(func(s *testFileServer) { s.cutAfter = cut })
+
+			d := newTestDownloader()
+			out := filepath.Join(t.TempDir(), "server.new")
+			if tt.restart {
+				d.Retries = 0
+				if err := d.Download(context.Background(), srv.URL, out, artifactExpectation{}, nil); err == nil {
+					t.Fatal("连接断开时应返回错误")
+				}
+				if info, err := os.Stat(out + ".partial"); err != nil || info.Size() != cut {
+					t.Fatalf("已下载的部分应保留: %v", err)
+				}
+			} else if tt.resume != nil {
+				// 断开后再修改服务器，让第一次请求仍然是原来的文件
+				d.Retries = 0
+				d.Download(context.Background(), srv.URL, out, artifactExpectation{}, nil)
+				s.update(tt.resume)
+				d.Retries = 2
+			}
+
+			if err := d.Download(context.Background(), srv.URL, out, artifactExpectation{Checksum: sha256Checksum(tt.want)}, nil); err != nil {
+				t.Fatalf("Download: %v", err)
+			}
+			if data, _ := os.ReadFile(out); !bytes.Equal(data, tt.want) {
+				t.Fatalf("下载的内容不一致（%d 字节，期望 %d 字节）", len(data), len(tt.want))
+			}
+			ranges, ifRanges := s.requests()
+			if strings.Join(ranges, " ") != strings.Join(tt.wantRanges, " ") {
+				t.Errorf("Range = %q，期望 %q", ranges, tt.wantRanges)
+			}
+			if len(ifRanges) > 1 && ifRanges[1] != `"v1"` {
+				t.Errorf("续传请求的 If-Range = %q，期望 ETag", ifRanges[1])
+			}
+			assertNoPartial(t, out)
+		})
+	}
+}
+
+func TestDownloadLimits(t *testing.T) {
+	content := incompressible(64 << 10)
+	tests := []struct {
+		name    string
+		setup   func(s *testFileServer)
+		expect  artifactExpectation
+		wantErr string
+	}{
+		{"超过大小上限", nil, artifactExpectation{MaxSize: 32 << 10}, "超过上限"},
+		{"大小未知时超过上限", func(s *testFileServer) { s.noLength = true }, artifactExpectation{MaxSize: 32 << 10}, "超过上限"},
+		{"大小不匹配", nil, artifactExpectation{Size: 1000}, "大小不匹配"},
+		{"大小未知时大小不匹配", func(s *testFileServer) { s.noLength = true }, artifactExpectation{Size: 1000}, "大小不匹配"},
+		{"校验和不匹配", nil, artifactExpectation{Checksum: sha256Checksum([]byte("other"))}, "校验和"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, srv := newTestFileServer(t, content)
+			if tt.setup != nil {
+				s.update(tt.setup)
+			}
+			d := newTestDownloader()
+			out := filepath.Join(t.TempDir(), "server.new")
+			err := d.Download(context.Background(), srv.URL, out, tt.expect, nil)
+
+			var integrity *integrityError
+			if !errors.As(err, &integrity) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Download = %v，期望包含 %q 的完整性错误", err, tt.wantErr)
+			}
+			if ranges, _ := s.requests(); len(ranges) != 1 {
+				t.Errorf("完整性错误不应重试，收到 %d 个请求", len(ranges))
+			}
+			if _, err := os.Stat(out); !os.IsNotExist(err) {
+				t.Error("校验失败时不应生成输出文件")
+			}
+			assertNoPartial(t, out)
+		})
+	}
+}
+
+func TestDownloadUnknownSizeStopsAtLimit(t *testing.T) {
+	// 大小未知的下载超过上限后立即中止，不会读完整个响应
+	content := incompressible(4 << 20)
+	s, srv := newTestFileServer(t, content)
+	s.update(func(s *testFileServer) { s.noLength = true })
+
+	d := newTestDownloader()
+	out := filepath.Join(t.TempDir(), "server.new")
+	if err := d.Download(context.Background(), srv.URL, out, artifactExpectation{MaxSize: 64 << 10}, nil); err == nil {
+		t.Fatal("超过上限时应返回错误")
+	}
+	if info, err := os.Stat(out + ".partial"); err == nil {
+		t.Errorf(".partial 没有删除（%d 字节）", info.Size())
+	}
+	s.mu.Lock()
+	sent := s.sent
+	s.mu.Unlock()
+	if sent >= len(content) {
+		t.Errorf("服务器发送了全部 %d 字节", sent)
+	}
+}
+
+func TestDownloadIdleTimeout(t *testing.T) {
+	content := incompressible(64 << 10)
+	tests := []struct {
+		name    string
+		setup   func(s *testFileServer)
+		wantErr string
+	}{
+		{"迟迟不返回响应头", func(s *testFileServer) { s.stallHeader = true }, "内没有收到响应"},
+		{"传输中途停止发送", func(s *testFileServer) { s.stallAfter = 10 << 10 }, "内没有收到数据"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, srv := newTestFileServer(t, content)
+			s.update(tt.setup)
+			d := newTestDownloader()
+			d.Retries = 0
+			d.IdleTimeout = 200 * time.Millisecond
+
+			start := time.Now()
+			err := d.Download(context.Background(), srv.URL, filepath.Join(t.TempDir(), "server.new"), artifactExpectation{}, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Download = %v，期望包含 %q", err, tt.wantErr)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("空闲超时后 %v 才返回", elapsed)
+			}
+		})
+	}
+}
+
+func TestDownloadIdleTimeoutResumes(t *testing.T) {
+	// 空闲超时后重试，从已收到的位置继续
+	content := incompressible(64 << 10)
+	s, srv := newTestFileServer(t, content)
+	s.update(func(s *testFileServer) { s.stallAfter = 10 << 10 })
+
+	d := newTestDownloader()
+	d.IdleTimeout = 200 * time.Millisecond
+	d.OnProgress = func(p DownloadProgress) {
+		if p.Attempt > 1 {
+			s.update(func(s *testFileServer) { s.stallAfter = 0 })
+		}
+	}
+	out := filepath.Join(t.TempDir(), "server.new")
+	if err := d.Download(context.Background(), srv.URL, out, artifactExpectation{Checksum: sha256Checksum(content)}, nil); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	if ranges, _ := s.requests(); len(ranges) != 2 || ranges[1] != "bytes=10240-65535" {
+		t.Errorf("Range = %q", ranges)
+	}
+}
+
+func TestDownloadStatus(t *testing.T) {
+	tests := []struct {
+		status    int
+		wantTries int
+	}{
+		{http.StatusNotFound, 1},
+		{http.StatusForbidden, 1},
+		{http.StatusServiceUnavailable, 3},
+		{http.StatusTooManyRequests, 3},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			s, srv := newTestFileServer(t, []byte("x"))
+			s.update(func(s *testFileServer) { s.status = tt.status })
+			d := newTestDownloader()
+			d.Retries = 2
+			err := d.Download(context.Background(), srv.URL, filepath.Join(t.TempDir(), "server.new"), artifactExpectation{}, nil)
+			if err == nil || !strings.Contains(err.Error(), strconv.Itoa(tt.status)) {
+				t.Fatalf("Download = %v", err)
+			}
+			if ranges, _ := s.requests(); len(ranges) != tt.wantTries {
+				t.Errorf("请求了 %d 次，期望 %d 次", len(ranges), tt.wantTries)
+			}
+		})
+	}
+}
+
+func TestDownloadCancel(t *testing.T) {
+	s, srv := newTestFileServer(t, incompressible(64<<10))
+	s.update(func(s *testFileServer) { s.stallAfter = 10 << 10 })
+	d := newTestDownloader()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	out := filepath.Join(t.TempDir(), "server.new")
+	if err := d.Download(ctx, srv.URL, out, artifactExpectation{}, nil); err != context.Canceled {
+		t.Fatalf("Download = %v，期望 context.Canceled", err)
+	}
+	// 取消时保留已下载的部分，下次从断点继续
+	if _, err := os.Stat(out + ".partial"); err != nil {
+		t.Errorf("已下载的部分应保留: %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+)
+
+// elfMachines GOARCH 对应的 ELF 机器类型
+var elfMachines = map[string]elf.Machine{
+	"386":     elf.EM_386,
+	"amd64":   elf.EM_X86_64,
+	"arm":     elf.EM_ARM,
+	"arm64":   elf.EM_AARCH64,
+	"loong64": elf.EM_LOONGARCH,
+	"mips":    elf.EM_MIPS,
+	"mipsle":  elf.EM_MIPS,
+	"ppc64":   elf.EM_PPC64,
+	"ppc64le": elf.EM_PPC64,
+	"riscv64": elf.EM_RISCV,
+	"s390x":   elf.EM_S390,
+}
+
+// peMachines GOARCH 对应的 PE 机器类型
+var peMachines = map[string]uint16{
+	"386":   pe.IMAGE_FILE_MACHINE_I386,
+	"amd64": pe.IMAGE_FILE_MACHINE_AMD64,
+	"arm":   pe.IMAGE_FILE_MACHINE_ARMNT,
+	"arm64": pe.IMAGE_FILE_MACHINE_ARM64,
+}
+
+// machoCPUs GOARCH 对应的 Mach-O CPU 类型
+var machoCPUs = map[string]macho.Cpu{
+	"386":   macho.Cpu386,
+	"amd64": macho.CpuAmd64,
+	"arm64": macho.CpuArm64,
+}
+
+// validateExecutable 检查文件是否为当前平台（GOOS/GOARCH）可以执行的程序
+// 用于在替换前拒绝 HTML 错误页、其他平台的程序和动态库
+func validateExecutable(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var magic [4]byte
+	if _, err := io.ReadFull(f, magic[:]); err != nil {
+		return fmt.Errorf("文件过小，不是可执行文件")
+	}
+
+	switch runtime.GOOS {
+	case "windows":
+		return validatePE(f, magic[:])
+	case "darwin", "ios":
+		return validateMachO(f, magic[:])
+	default:
+		return validateELF(f, magic[:])
+	}
+}
+
+// validatePE 检查 Windows PE 可执行文件
+func validatePE(r io.ReaderAt, magic []byte) error {
+	if string(magic[:2]) != "MZ" {
+		return fmt.Errorf("不是 Windows 可执行文件（%s）", describeMagic(magic))
+	}
+	f, err := pe.NewFile(r)
+	if err != nil {
+		return fmt.Errorf("解析 PE 文件失败: %v", err)
+	}
+	defer f.Close()
+
+	if f.Characteristics&pe.IMAGE_FILE_EXECUTABLE_IMAGE == 0 || f.Characteristics&pe.IMAGE_FILE_DLL != 0 {
+		return fmt.Errorf("PE 文件不是可执行程序（可能是 DLL 或目标文件）")
+	}
+	if want, ok := peMachines[runtime.GOARCH]; ok && f.Machine != want {
+		return fmt.Errorf("程序架构不匹配: 文件为 0x%x，当前平台 %s 需要 0x%x", f.Machine, platformKey(), want)
+	}
+	return nil
+}
+
+// validateELF 检查 ELF 可执行文件
+func validateELF(r io.ReaderAt, magic []byte) error {
+	if string(magic) != elf.ELFMAG {
+		return fmt.Errorf("不是 ELF 可执行文件（%s）", describeMagic(magic))
+	}
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return fmt.Errorf("解析 ELF 文件失败: %v", err)
+	}
+	defer f.Close()
+
+	// 位置无关的可执行文件（PIE）与动态库同为 ET_DYN
+	switch f.Type {
+	case elf.ET_EXEC:
+	case elf.ET_DYN:
+		if !isPIE(f) {
+			return fmt.Errorf("ELF 文件是动态库，不是可执行程序")
+		}
+	default:
+		return fmt.Errorf("ELF 文件不是可执行程序（类型 %s）", f.Type)
+	}
+	if want, ok := elfMachines[runtime.GOARCH]; ok && f.Machine != want {
+		return fmt.Errorf("程序架构不匹配: 文件为 %s，当前平台 %s 需要 %s", f.Machine, platformKey(), want)
+	}
+	wantClass := elf.ELFCLASS32
+	if strconv.IntSize == 64 {
+		wantClass = elf.ELFCLASS64
+	}
+	if f.Class != wantClass {
+		return fmt.Errorf("程序位数不匹配: 文件为 %s，当前平台 %s", f.Class, platformKey())
+	}
+	return nil
+}
+
+// isPIE ET_DYN 类型的 ELF 文件是否为可执行程序：有程序解释器（PT_INTERP），
+// 或者是静态链接的 PIE（DT_FLAGS_1 含 DF_1_PIE）；动态库两者都没有
+func isPIE(f *elf.File) bool {
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_INTERP {
+			return true
+		}
+	}
+	flags, err := f.DynValue(elf.DT_FLAGS_1)
+	return err == nil && len(flags) > 0 && flags[0]&uint64(elf.DF_1_PIE) != 0
+}
+
+// validateMachO 检查 Mach-O 可执行文件，通用二进制（fat）需要包含当前架构
+func validateMachO(r io.ReaderAt, magic []byte) error {
+	want, known := machoCPUs[runtime.GOARCH]
+
+	if fat, err := macho.NewFatFile(r); err == nil {
+		defer fat.Close()
+		for _, arch := range fat.Arches {
+			if !known || arch.Cpu == want {
+				return checkMachOType(arch.File)
+			}
+		}
+		return fmt.Errorf("通用二进制中没有 %s 架构", platformKey())
+	}
+
+	f, err := macho.NewFile(r)
+	if err != nil {
+		return fmt.Errorf("不是 Mach-O 可执行文件（%s）", describeMagic(magic))
+	}
+	defer f.Close()
+	if known && f.Cpu != want {
+		return fmt.Errorf("程序架构不匹配: 文件为 %s，当前平台 %s 需要 %s", f.Cpu, platformKey(), want)
+	}
+	return checkMachOType(f)
+}
+
+// checkMachOType 检查 Mach-O 文件类型
+func checkMachOType(f *macho.File) error {
+	if f.Type != macho.TypeExec {
+		return fmt.Errorf("Mach-O 文件不是可执行程序（类型 %s）", f.Type)
+	}
+	return nil
+}
+
+// describeMagic 描述文件开头的内容，便于识别下载到的 HTML 错误页等
+func describeMagic(magic []byte) string {
+	switch {
+	case magic[0] == '<' || magic[0] == '{':
+		return "看起来是 HTML / JSON 文本，可能是错误页面"
+	case string(magic[:2]) == "MZ":
+		return "Windows 程序"
+	case string(magic) == elf.ELFMAG:
+		return "Linux ELF 程序"
+	case string(magic) == "\xcf\xfa\xed\xfe" || string(magic) == "\xce\xfa\xed\xfe" || string(magic) == "\xca\xfe\xba\xbe":
+		return "macOS Mach-O 程序"
+	case string(magic[:2]) == "PK":
+		return "zip 压缩包"
+	case magic[0] == 0x1f && magic[1] == 0x8b:
+		return "gzip 压缩包"
+	}
+	return fmt.Sprintf("文件头 % x", magic)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// HealthStatus 目标程序健康状态
+type HealthStatus string
+
+const (
+	HealthUnknown   HealthStatus = "unknown"   // 未配置健康检查或进程未运行
+	HealthStarting  HealthStatus = "starting"  // 启动宽限期内，尚未通过检查
+	HealthHealthy   HealthStatus = "healthy"   // 最近一次检查通过
+	HealthUnhealthy HealthStatus = "unhealthy" // 连续失败达到阈值
+)
+
+// HealthChecker 健康检查接口
+type HealthChecker interface {
+	// Check 执行一次检查，ctx 带有单次检查的超时
+	Check(ctx context.Context) error
+	// String 返回检查描述，用于日志
+	String() string
+}
+
+// HealthCheckSettings 健康检查运行参数
+type HealthCheckSettings struct {
+	Checker          HealthChecker
+	Interval         time.Duration // 检查间隔
+	Timeout          time.Duration // 单次检查超时
+	StartPeriod      time.Duration // 启动宽限期，期间的失败不计入阈值
+	FailureThreshold int           // 连续失败多少次判定为不健康
+}
+
+// HealthState 健康检查结果
+type HealthState struct {
+	Status              HealthStatus `json:"status"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	LastCheck           *time.Time   `json:"last_check,omitempty"`
+	LastError           string       `json:"last_error,omitempty"`
+}
+
+// NewHealthChecker 根据配置创建健康检查，类型为空或 none 时返回 nil
+func NewHealthChecker(cfg HealthCheckConfig) (HealthChecker, error) {
+	switch strings.ToLower(cfg.Type) {
+	case "", "none":
+		return nil, nil
+	case "http":
+		if err := validateHTTPURL(cfg.URL); err != nil {
+			return nil, fmt.Errorf("health_check.url: %v", err)
+		}
+		status := cfg.ExpectedStatus
+		if status == 0 {
+			status = http.StatusOK
+		}
+		return &httpHealthCheck{url: cfg.URL, expectedStatus: status, expectedBody: cfg.ExpectedBody}, nil
+	case "tcp":
+		if _, _, err := net.SplitHostPort(cfg.Address); err != nil {
+			return nil, fmt.Errorf("health_check.address 无效: %v", err)
+		}
+		return &tcpHealthCheck{address: cfg.Address}, nil
+	case "exec":
+		if len(cfg.Command) == 0 || cfg.Command[0] == "" {
+			return nil, fmt.Errorf("health_check.command 不能为空")
+		}
+		return &execHealthCheck{command: cfg.Command}, nil
+	default:
+		return nil, fmt.Errorf("health_check.type 无效: %q（可选: http、tcp、exec、none）", cfg.Type)
+	}
+}
+
+// httpHealthCheck HTTP GET 检查，校验状态码和响应内容
+type httpHealthCheck struct {
+	url            string
+	expectedStatus int
+	expectedBody   string // 响应中必须包含的内容，为空不校验
+}
+
+func (h *httpHealthCheck) Check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", h.url, nil)
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %v", err)
+	}
+	req.Header.Set("User-Agent", "PolyWin-HealthCheck/1.0")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != h.expectedStatus {
+		return fmt.Errorf("HTTP 状态码: %d（期望 %d）", resp.StatusCode, h.expectedStatus)
+	}
+
+	if h.expectedBody != "" {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		if err != nil {
+			return fmt.Errorf("读取响应失败: %v", err)
+		}
+		if !strings.Contains(string(body), h.expectedBody) {
+			return fmt.Errorf("响应中不包含 %q", h.expectedBody)
+		}
+	}
+	return nil
+}
+
+func (h *httpHealthCheck) String() string { return "http " + h.url }
+
+// tcpHealthCheck TCP 连接检查
+type tcpHealthCheck struct {
+	address string
+}
+
+func (t *tcpHealthCheck) Check(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", t.address)
+	if err != nil {
+		return fmt.Errorf("连接失败: %v", err)
+	}
+	return conn.Close()
+}
+
+func (t *tcpHealthCheck) String() string { return "tcp " + t.address }
+
+// execHealthCheck 执行命令检查，退出码为 0 视为健康
+type execHealthCheck struct {
+	command []string
+}
+
+func (e *execHealthCheck) Check(ctx context.Context) error {
+	out, err := exec.CommandContext(ctx, e.command[0], e.command[1:]...).CombinedOutput()
+	if err != nil {
+		msg := strings.TrimSpace(string(out))
+		if len(msg) > 200 {
+			msg = msg[:200]
+		}
+		if msg != "" {
+			return fmt.Errorf("%v: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+func (e *execHealthCheck) String() string { return "exec " + strings.Join(e.command, " ") }
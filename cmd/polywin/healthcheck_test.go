@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// checkFunc 测试用的健康检查
+type checkFunc func(ctx context.Context) error
+
+func (f checkFunc) Check(ctx context.Context) error { return f(ctx) }
+
+func (f checkFunc) String() string { return "test" }
+
+func TestHealthCheckers(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"status": "ok"}`)
+	}))
+	defer srv.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	tests := []struct {
+		name    string
+		config  HealthCheckConfig
+		mode    string // exec 检查运行的测试目标程序的运行方式
+		wantErr string
+	}{
+		{"http 通过", HealthCheckConfig{Type: "http", URL: srv.URL}, "", ""},
+		{"http 校验响应内容", HealthCheckConfig{Type: "http", URL: srv.URL, ExpectedBody: `"ok"`}, "", ""},
+		{"http 状态码不符", HealthCheckConfig{Type: "http", URL: srv.URL + "/down"}, "", "HTTP 状态码: 503"},
+		{"http 期望的状态码", HealthCheckConfig{Type: "http", URL: srv.URL + "/down", ExpectedStatus: 503}, "", ""},
+		{"http 响应内容不符", HealthCheckConfig{Type: "http", URL: srv.URL, ExpectedBody: "ready"}, "", "响应中不包含"},
+		{"tcp 通过", HealthCheckConfig{Type: "tcp", Address: listener.Addr().String()}, "", ""},
+		{"tcp 连接失败", HealthCheckConfig{Type: "tcp", Address: closed.Addr().String()}, "", "连接失败"},
+		{"exec 通过", HealthCheckConfig{Type: "exec", Command: []string{os.Args[0]}}, "exit0", ""},
+		{"exec 退出码非 0", HealthCheckConfig{Type: "exec", Command: []string{os.Args[0]}}, "exit1", "exit status 1"},
+		{"exec 超时", HealthCheckConfig{Type: "exec", Command: []string{os.Args[0]}}, "run", "killed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mode != "" {
+				t.Setenv(testTargetEnv, tt.mode)
+			}
+			checker, err := NewHealthChecker(tt.config)
+			if err != nil {
+				t.Fatalf("NewHealthChecker: %v", err)
+			}
+			// 测试目标程序启动可能较慢，只有超时的用例使用较短的超时
+			timeout := 10 * time.Second
+			if tt.mode == "run" {
+				timeout = 300 * time.Millisecond
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			err = checker.Check(ctx)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Check = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Check = %v，期望包含 %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewHealthCheckerInvalid(t *testing.T) {
+	tests := []HealthCheckConfig{
+		{Type: "http", URL: "ftp://localhost/health"},
+		{Type: "tcp", Address: "localhost"},
+		{Type: "exec"},
+		{Type: "grpc"},
+	}
+	for _, cfg := range tests {
+		if _, err := NewHealthChecker(cfg); err == nil {
+			t.Errorf("NewHealthChecker(%+v) 应返回错误", cfg)
+		}
+	}
+	if checker, err := NewHealthChecker(HealthCheckConfig{Type: "none"}); checker != nil || err != nil {
+		t.Errorf("none = %v, %v", checker, err)
+	}
+}
+
+func TestUnhealthyTargetRestarted(t *testing.T) {
+	var checks atomic.Int32
+	s, target := newTestSupervisor(t, "run", SupervisorConfig{
+		RestartPolicy: RestartOnFailure,
+		MaxRestarts:   1,
+		RestartWindow: time.Hour,
+		HealthCheck: &HealthCheckSettings{
+			Checker: checkFunc(func(ctx context.Context) error {
+				checks.Add(1)
+				return errors.New("没有响应")
+			}),
+			Interval:         20 * time.Millisecond,
+			Timeout:          time.Second,
+			FailureThreshold: 3,
+		},
+	}, nil)
+	waitDone(t, runSupervisor(s))
+
+	// 连续失败达到阈值后停止并重启，第二次仍不健康时触发崩溃循环保护
+	if n := target.starts(); n != 2 {
+		t.Errorf("启动了 %d 次，期望 2 次", n)
+	}
+	if n := checks.Load(); n < 6 {
+		t.Errorf("只检查了 %d 次", n)
+	}
+	status := s.Status()
+	if status.State != StateFailed || !strings.Contains(status.LastExit, "健康检查失败: 没有响应") {
+		t.Errorf("状态 = %+v", status)
+	}
+}
+
+func TestHealthState(t *testing.T) {
+	var healthy atomic.Bool
+	s, target := newTestSupervisor(t, "run", SupervisorConfig{
+		HealthCheck: &HealthCheckSettings{
+			Checker: checkFunc(func(ctx context.Context) error {
+				if !healthy.Load() {
+					return errors.New("启动中")
+				}
+				return nil
+			}),
+			Interval:         20 * time.Millisecond,
+			Timeout:          time.Second,
+			StartPeriod:      time.Hour,
+			FailureThreshold: 1,
+		},
+	}, nil)
+	runSupervisor(s)
+
+	// 启动宽限期内的失败不计数
+	waitFor(t, "第一次健康检查", func() bool { return s.Status().Health.LastCheck != nil })
+	time.Sleep(100 * time.Millisecond)
+	if health := s.Status().Health; health.Status != HealthStarting || health.LastError != "启动中" {
+		t.Errorf("宽限期内健康状态 = %+v", health)
+	}
+
+	healthy.Store(true)
+	waitFor(t, "健康检查通过", func() bool { return s.Status().Health.Status == HealthHealthy })
+	if n := target.starts(); n != 1 {
+		t.Errorf("启动了 %d 次，期望 1 次", n)
+	}
+
+	// 通过后不再有宽限期，失败达到阈值立即重启
+	healthy.Store(false)
+	waitFor(t, "不健康的目标程序重启", func() bool { return target.starts() == 2 })
+}
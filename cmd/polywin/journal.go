@@ -0,0 +1,390 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// 更新事务阶段，事务记录在状态文件中，每次进入新阶段都先写入磁盘
+const (
+	TxStaged     = "staged"      // 新版本已下载到 .new，尚未校验
+	TxVerified   = "verified"    // 新版本已通过校验并写入磁盘，可以替换
+	TxReady      = "ready"       // 新版本已通过校验，等待批准后进入 verified
+	TxSwapped    = "swapped"     // 已替换目标程序，旧版本保留为 .old（Windows 上替换由更新脚本在目标程序退出后完成）
+	TxProbation  = "probation"   // 新版本已启动，正在试运行
+	TxCommitted  = "committed"   // 新版本通过试运行，已删除旧版本
+	TxRolledBack = "rolled_back" // 已放弃新版本或恢复旧版本
+)
+
+// updateScriptName 旧版本在 Windows 上使用的更新脚本文件名，启动时作为残留文件删除
+const updateScriptName = "update_server.bat"
+
+// UpdateTransaction 一次更新的事务记录，守护程序启动时根据它完成或回滚被中断的更新
+type UpdateTransaction struct {
+	Version   string          `json:"version"`
+	Phase     string          `json:"phase"`
+	Target    string          `json:"target"`            // 目标程序路径，配置变化后不再处理旧事务
+	Installed InstalledRecord `json:"installed"`         // 替换后的版本记录
+	Previous  InstalledRecord `json:"previous"`          // 替换前的版本记录，回滚时恢复
+	Resumed   bool            `json:"resumed,omitempty"` // 试运行被守护程序重启打断，已重新试运行过一次
+	Reason    string          `json:"reason,omitempty"`  // 回滚原因
+
+	RollingBack bool      `json:"rolling_back,omitempty"` // 已决定回滚，正在恢复旧版本
+	StartedAt   time.Time `json:"started_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // 等待批准的截止时间，过期后丢弃
+}
+
+// active 事务是否尚未结束
+func (tx *UpdateTransaction) active() bool {
+	return tx != nil && tx.Phase != TxCommitted && tx.Phase != TxRolledBack
+}
+
+// beginTransaction 新版本下载完成后开始更新事务
+func (u *Updater) beginTransaction(info *UpdateInfo) {
+	u.updateMutex.Lock()
+	defer u.updateMutex.Unlock()
+	now := time.Now()
+	u.state.Transaction = &UpdateTransaction{
+		Version:   info.ID(),
+		Target:    u.config.TargetPath,
+		Previous:  u.state.Installed,
+		StartedAt: now,
+	}
+	if err := u.transition(TxStaged, ""); err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+// transition 将当前事务推进到 phase 并保存状态文件，调用时必须持有 updateMutex
+func (u *Updater) transition(phase, reason string) error {
+	tx := u.state.Transaction
+	if tx == nil {
+		return nil
+	}
+	tx.Phase = phase
+	tx.Reason = reason
+	tx.UpdatedAt = time.Now()
+	if !tx.active() {
+		tx.RollingBack = false
+	}
+	if err := u.state.save(u.config.StatePath); err != nil {
+		return fmt.Errorf("保存更新事务（%s）失败: %v", phase, err)
+	}
+	return nil
+}
+
+// setPhase 推进当前事务的阶段
+func (u *Updater) setPhase(phase, reason string) {
+	u.updateMutex.Lock()
+	defer u.updateMutex.Unlock()
+	if err := u.transition(phase, reason); err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+// verifyStaged 新版本通过校验后设置可执行权限并写入磁盘，事务进入 verified
+func (u *Updater) verifyStaged(record InstalledRecord) error {
+	newPath := u.config.TargetPath + ".new"
+	if err := os.Chmod(newPath, 0755); err != nil {
+		return fmt.Errorf("设置可执行权限失败: %v", err)
+	}
+	paths := []string{newPath}
+	dir := filepath.Dir(u.config.TargetPath)
+	for _, name := range u.config.Companions {
+		if _, err := os.Stat(filepath.Join(dir, name+".new")); err == nil {
+			paths = append(paths, filepath.Join(dir, name+".new"))
+		}
+	}
+	for _, path := range paths {
+		if err := syncFile(path); err != nil {
+			return fmt.Errorf("写入新版本失败: %v", err)
+		}
+	}
+	if err := syncDir(dir); err != nil {
+		return fmt.Errorf("写入新版本失败: %v", err)
+	}
+
+	u.updateMutex.Lock()
+	defer u.updateMutex.Unlock()
+	if tx := u.state.Transaction; tx != nil {
+		tx.Installed = record
+	}
+	return u.transition(TxVerified, "")
+}
+
+// discardStaged 放弃未替换的新版本：删除 .new 文件，事务标记为已回滚
+func (u *Updater) discardStaged(reason string) {
+	u.removeStaged()
+	u.setPhase(TxRolledBack, reason)
+}
+
+// removeStaged 删除未替换的新版本文件
+func (u *Updater) removeStaged() {
+	dir := filepath.Dir(u.config.TargetPath)
+	os.Remove(u.config.TargetPath + ".new")
+	for _, name := range u.config.Companions {
+		os.Remove(filepath.Join(dir, name+".new"))
+	}
+	syncDir(dir)
+}
+
+// swapFiles 将 .new 替换为目标程序，原文件保留为 .old，可以在任意步骤中断后重复执行
+// 替换失败时恢复原文件
+func (u *Updater) swapFiles() error {
+	targetPath := u.config.TargetPath
+	newPath := targetPath + ".new"
+	oldPath := targetPath + ".old"
+	dir := filepath.Dir(targetPath)
+
+	if _, err := os.Stat(newPath); err != nil {
+		if _, err := os.Stat(targetPath); err != nil {
+			return fmt.Errorf("新版本文件和目标程序都不存在")
+		}
+		// 已经替换完成
+		u.swapCompanions()
+		return syncDir(dir)
+	}
+
+	if _, err := os.Stat(targetPath); err == nil {
+		// 目标程序还在原位，之前的 .old 是已经通过试运行的版本
+		os.Remove(oldPath)
+		if err := os.Rename(targetPath, oldPath); err != nil {
+			return fmt.Errorf("重命名当前可执行文件失败: %v", err)
+		}
+	}
+	if err := os.Rename(newPath, targetPath); err != nil {
+		// 如果失败，尝试恢复
+		os.Rename(oldPath, targetPath)
+		syncDir(dir)
+		return fmt.Errorf("移动新版本失败: %v", err)
+	}
+	if err := syncDir(dir); err != nil {
+		return fmt.Errorf("写入目录失败: %v", err)
+	}
+
+	u.swapCompanions()
+	return syncDir(dir)
+}
+
+// Reconcile 守护程序启动时（目标程序启动前）处理上次未完成的更新事务并清理残留文件：
+// 未校验的新版本直接丢弃，已校验但未替换的新版本保留为待应用（或等待批准）的更新，替换到一半的更新完成替换并重新进入试运行，
+// 试运行再次被打断的版本回滚到旧版本；最后将当前版本加入版本库
+func (u *Updater) Reconcile() {
+	u.updateMutex.Lock()
+	tx := u.state.Transaction
+	if tx.active() && tx.Target != u.config.TargetPath {
+		log.Printf("更新事务的目标程序 %s 与当前配置不同，忽略该事务", tx.Target)
+		u.transition(TxRolledBack, "目标程序配置已变化")
+		tx = nil
+	}
+	u.updateMutex.Unlock()
+
+	if tx.active() {
+		log.Printf("发现未完成的更新事务: 版本 %s，阶段 %s", tx.Version, tx.Phase)
+		u.resumeTransaction(tx)
+	}
+	u.cleanupStray()
+	u.recordCurrentVersion()
+}
+
+// resumeTransaction 完成或回滚被中断的事务
+func (u *Updater) resumeTransaction(tx *UpdateTransaction) {
+	if tx.Phase == TxStaged {
+		log.Printf("版本 %s 尚未完成校验，丢弃", tx.Version)
+		u.discardStaged("守护程序在校验新版本时中断")
+		return
+	}
+
+	// 等待批准的新版本不会开始替换，文件缺失时直接丢弃
+	if tx.Phase == TxReady {
+		if !u.notSwapped() {
+			u.discardStaged("等待批准的新版本文件缺失")
+			return
+		}
+		log.Printf("版本 %s 已就绪，等待批准", tx.Version)
+		u.expireReady(time.Now())
+		if tx.ExpiresAt != nil {
+			u.scheduleExpiry(*tx.ExpiresAt)
+		}
+		return
+	}
+
+	// 已就绪但尚未开始替换：保留为待应用的更新，按应用策略替换
+	if tx.Phase == TxVerified && u.notSwapped() {
+		u.setPendingUpdate(true)
+		log.Printf("版本 %s 已就绪，尚未应用，%s", tx.Version, u.applySchedule(time.Now()))
+		u.notifyReady()
+		return
+	}
+
+	p := &installedUpdate{
+		Version:     tx.Version,
+		BackupPath:  u.config.TargetPath + ".old",
+		InstalledAt: tx.UpdatedAt,
+		Previous:    tx.Previous,
+	}
+
+	if tx.RollingBack {
+		log.Printf("继续回滚版本 %s（%s）", tx.Version, tx.Reason)
+		u.updateMutex.Lock()
+		u.probation = p
+		u.updateMutex.Unlock()
+		if err := u.rollbackProbation(p, tx.Reason); err != nil {
+			log.Printf("回滚失败: %v", err)
+		}
+		return
+	}
+
+	if err := u.swapFiles(); err != nil {
+		log.Printf("完成版本 %s 的替换失败，回滚: %v", tx.Version, err)
+		u.updateMutex.Lock()
+		u.probation = p
+		u.updateMutex.Unlock()
+		if err := u.rollbackProbation(p, fmt.Sprintf("替换中断后无法完成: %v", err)); err != nil {
+			log.Printf("回滚失败: %v", err)
+		}
+		return
+	}
+
+	u.updateMutex.Lock()
+	u.probation = p
+	phase := tx.Phase
+	if phase == TxProbation && tx.Resumed {
+		u.updateMutex.Unlock()
+		if err := u.rollbackProbation(p, "试运行期间守护程序再次中断"); err != nil {
+			log.Printf("回滚失败: %v", err)
+		}
+		return
+	}
+	if phase == TxProbation {
+		tx.Resumed = true
+	}
+	u.state.Installed = tx.Installed
+	err := u.transition(TxSwapped, "")
+	u.updateMutex.Unlock()
+	if err != nil {
+		log.Printf("%v", err)
+	}
+
+	if phase == TxProbation {
+		log.Printf("版本 %s 的试运行被守护程序重启打断，重新试运行", tx.Version)
+	} else {
+		log.Printf("已完成版本 %s 的替换，启动后进入试运行", tx.Version)
+	}
+}
+
+// notSwapped 目标程序和 .new 都在原位，替换尚未开始
+func (u *Updater) notSwapped() bool {
+	if _, err := os.Stat(u.config.TargetPath + ".new"); err != nil {
+		return false
+	}
+	_, err := os.Stat(u.config.TargetPath)
+	return err == nil
+}
+
+// cleanupStray 删除更新残留的文件：不再等待应用的 .new、补丁、Windows 更新脚本，
+// 以及不在试运行中的 .old（目标程序缺失时先用 .old 恢复）
+// 未完成的下载（.partial）保留，用于断点续传
+func (u *Updater) cleanupStray() {
+	targetPath := u.config.TargetPath
+	dir := filepath.Dir(targetPath)
+
+	stray := []string{
+		targetPath + ".new.patch",
+		filepath.Join(dir, updateScriptName),
+		u.config.StatePath + ".tmp",
+	}
+	// 等待应用或等待批准的新版本保留
+	if !u.HasPendingUpdate() && u.readyVersion() == "" {
+		stray = append(stray, targetPath+".new")
+		for _, name := range u.config.Companions {
+			stray = append(stray, filepath.Join(dir, name+".new"))
+		}
+	}
+
+	if !u.InProbation() {
+		oldPath := targetPath + ".old"
+		if _, err := os.Stat(targetPath); os.IsNotExist(err) {
+			if _, err := os.Stat(oldPath); err == nil {
+				log.Printf("目标程序缺失，使用旧版本备份 %s 恢复", oldPath)
+				if err := os.Rename(oldPath, targetPath); err != nil {
+					log.Printf("恢复目标程序失败: %v", err)
+				}
+			}
+		}
+		stray = append(stray, oldPath)
+		for _, name := range u.config.Companions {
+			stray = append(stray, filepath.Join(dir, name+".old"))
+		}
+	}
+
+	removed := false
+	for _, path := range stray {
+		if err := os.Remove(path); err == nil {
+			log.Printf("已删除残留文件: %s", path)
+			removed = true
+		} else if !os.IsNotExist(err) {
+			log.Printf("删除残留文件 %s 失败: %v", path, err)
+		}
+	}
+	if removed {
+		syncDir(dir)
+	}
+}
+
+// writeFileAtomic 写入临时文件并刷新到磁盘后重命名，保证文件要么是旧内容，要么是完整的新内容
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmpPath := path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// syncFile 将文件内容刷新到磁盘
+func syncFile(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+// syncDir 将目录中的重命名、删除刷新到磁盘；Windows 不支持同步目录，由文件系统日志保证
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReconcile(t *testing.T) {
+	v1 := InstalledRecord{Version: "1.0.0", Source: "update"}
+	v2 := InstalledRecord{Version: "2.0.0", Source: "update"}
+
+	tests := []struct {
+		name      string
+		tx        *UpdateTransaction // Target 为空时使用当前目标程序
+		installed InstalledRecord
+		files     map[string]string
+
+		wantFiles     map[string]string
+		wantPhase     string
+		wantInstalled string
+		wantBlacklist []string
+		wantPending   bool
+		wantProbation bool
+	}{
+		{
+			name:      "没有事务时清理残留文件",
+			installed: v1,
+			files:     map[string]string{"server": "v1", "server.old": "v0", "server.new.patch": "p", updateScriptName: "bat", "server.new.partial": "v2"},
+			wantFiles: map[string]string{"server": "v1", "server.new.partial": "v2"},
+
+			wantInstalled: "1.0.0",
+		},
+		{
+			name:      "目标程序缺失时用旧版本备份恢复",
+			installed: v1,
+			files:     map[string]string{"server.old": "v1"},
+			wantFiles: map[string]string{"server": "v1"},
+
+			wantInstalled: "1.0.0",
+		},
+		{
+			name:      "staged：未完成校验的新版本丢弃",
+			tx:        &UpdateTransaction{Phase: TxStaged},
+			installed: v1,
+			files:     map[string]string{"server": "v1", "server.new": "v2"},
+			wantFiles: map[string]string{"server": "v1"},
+
+			wantPhase:     TxRolledBack,
+			wantInstalled: "1.0.0",
+		},
+		{
+			name:      "verified：尚未替换，保留为待应用的更新",
+			tx:        &UpdateTransaction{Phase: TxVerified},
+			installed: v1,
+			files:     map[string]string{"server": "v1", "server.new": "v2"},
+			wantFiles: map[string]string{"server": "v1", "server.new": "v2"},
+
+			wantPhase:     TxVerified,
+			wantInstalled: "1.0.0",
+			wantPending:   true,
+		},
+		{
+			name:      "verified：替换到一半，完成替换并进入试运行",
+			tx:        &UpdateTransaction{Phase: TxVerified},
+			installed: v1,
+			files:     map[string]string{"server.old": "v1", "server.new": "v2"},
+			wantFiles: map[string]string{"server": "v2", "server.old": "v1"},
+
+			wantPhase:     TxSwapped,
+			wantInstalled: "2.0.0",
+			wantProbation: true,
+		},
+		{
+			name:      "swapped：重新进入试运行",
+			tx:        &UpdateTransaction{Phase: TxSwapped},
+			installed: v2,
+			files:     map[string]string{"server": "v2", "server.old": "v1"},
+			wantFiles: map[string]string{"server": "v2", "server.old": "v1"},
+
+			wantPhase:     TxSwapped,
+			wantInstalled: "2.0.0",
+			wantProbation: true,
+		},
+		{
+			name:      "swapped：新版本和旧版本都不存在时回滚",
+			tx:        &UpdateTransaction{Phase: TxSwapped},
+			installed: v2,
+			files:     map[string]string{},
+			wantFiles: map[string]string{},
+
+			wantPhase:     TxRolledBack,
+			wantInstalled: "1.0.0",
+			wantBlacklist: []string{"2.0.0"},
+		},
+		{
+			name:      "probation：第一次被打断，重新试运行",
+			tx:        &UpdateTransaction{Phase: TxProbation},
+			installed: v2,
+			files:     map[string]string{"server": "v2", "server.old": "v1"},
+			wantFiles: map[string]string{"server": "v2", "server.old": "v1"},
+
+			wantPhase:     TxSwapped,
+			wantInstalled: "2.0.0",
+			wantProbation: true,
+		},
+		{
+			name:      "probation：再次被打断，回滚并加入黑名单",
+			tx:        &UpdateTransaction{Phase: TxProbation, Resumed: true},
+			installed: v2,
+			files:     map[string]string{"server": "v2", "server.old": "v1"},
+			wantFiles: map[string]string{"server": "v1"},
+
+			wantPhase:     TxRolledBack,
+			wantInstalled: "1.0.0",
+			wantBlacklist: []string{"2.0.0"},
+		},
+		{
+			name:      "回滚被打断：继续恢复旧版本",
+			tx:        &UpdateTransaction{Phase: TxProbation, RollingBack: true, Reason: "健康检查失败"},
+			installed: v1,
+			files:     map[string]string{"server": "v2", "server.old": "v1"},
+			wantFiles: map[string]string{"server": "v1"},
+
+			wantPhase:     TxRolledBack,
+			wantInstalled: "1.0.0",
+			wantBlacklist: []string{"2.0.0"},
+		},
+		{
+			name:      "回滚被打断：旧版本已恢复",
+			tx:        &UpdateTransaction{Phase: TxProbation, RollingBack: true, Reason: "健康检查失败"},
+			installed: v1,
+			files:     map[string]string{"server": "v1"},
+			wantFiles: map[string]string{"server": "v1"},
+
+			wantPhase:     TxRolledBack,
+			wantInstalled: "1.0.0",
+			wantBlacklist: []string{"2.0.0"},
+		},
+		{
+			name:      "committed：只清理残留文件",
+			tx:        &UpdateTransaction{Phase: TxCommitted},
+			installed: v2,
+			files:     map[string]string{"server": "v2", "server.old": "v1", "server.new": "v3"},
+			wantFiles: map[string]string{"server": "v2"},
+
+			wantPhase:     TxCommitted,
+			wantInstalled: "2.0.0",
+		},
+		{
+			name:      "目标程序配置已变化：忽略事务",
+			tx:        &UpdateTransaction{Phase: TxVerified, Target: "/elsewhere/server"},
+			installed: v1,
+			files:     map[string]string{"server": "v1", "server.new": "v2"},
+			wantFiles: map[string]string{"server": "v1"},
+
+			wantPhase:     TxRolledBack,
+			wantInstalled: "1.0.0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTestFiles(t, dir, tt.files)
+			state := &UpdaterState{Installed: tt.installed, MachineID: "test"}
+			if tt.tx != nil {
+				tx := *tt.tx
+				tx.Version = v2.Version
+				tx.Installed = v2
+				tx.Previous = v1
+				if tx.Target == "" {
+					tx.Target = filepath.Join(dir, "server")
+				}
+				state.Transaction = &tx
+			}
+			saveTestState(t, dir, state)
+
+			u := newTestUpdater(t, dir, &UpdaterConfig{})
+			u.Reconcile()
+
+			if got := readTestFiles(t, dir); !reflect.DeepEqual(got, tt.wantFiles) {
+				t.Errorf("文件 = %v，期望 %v", got, tt.wantFiles)
+			}
+			saved := loadTestState(t, dir)
+			if tt.wantPhase != "" && (saved.Transaction == nil || saved.Transaction.Phase != tt.wantPhase) {
+				t.Errorf("事务 = %+v，期望阶段 %s", saved.Transaction, tt.wantPhase)
+			}
+			if saved.Installed.Version != tt.wantInstalled {
+				t.Errorf("已安装版本 = %q，期望 %q", saved.Installed.Version, tt.wantInstalled)
+			}
+			if !reflect.DeepEqual(saved.Blacklist, tt.wantBlacklist) {
+				t.Errorf("黑名单 = %v，期望 %v", saved.Blacklist, tt.wantBlacklist)
+			}
+			if got := u.HasPendingUpdate(); got != tt.wantPending {
+				t.Errorf("HasPendingUpdate = %v，期望 %v", got, tt.wantPending)
+			}
+			if got := u.InProbation(); got != tt.wantProbation {
+				t.Errorf("InProbation = %v，期望 %v", got, tt.wantProbation)
+			}
+		})
+	}
+}
+
+func TestReconcileProbationResumedOnce(t *testing.T) {
+	// 试运行被打断后重新试运行，再次被打断时回滚
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"server": "v2", "server.old": "v1"})
+	saveTestState(t, dir, &UpdaterState{
+		Installed: InstalledRecord{Version: "2.0.0"},
+		Transaction: &UpdateTransaction{
+			Version:   "2.0.0",
+			Phase:     TxProbation,
+			Target:    filepath.Join(dir, "server"),
+			Installed: InstalledRecord{Version: "2.0.0"},
+			Previous:  InstalledRecord{Version: "1.0.0"},
+		},
+	})
+
+	u := newTestUpdater(t, dir, &UpdaterConfig{})
+	u.Reconcile()
+	if p := u.beginProbation(); p == nil {
+		t.Fatal("重新试运行时应返回试运行中的更新")
+	}
+	if tx := loadTestState(t, dir).Transaction; tx.Phase != TxProbation || !tx.Resumed {
+		t.Fatalf("事务 = %+v，期望已重新试运行", tx)
+	}
+
+	u = newTestUpdater(t, dir, &UpdaterConfig{})
+	u.Reconcile()
+	if got := readTestFiles(t, dir); !reflect.DeepEqual(got, map[string]string{"server": "v1"}) {
+		t.Errorf("文件 = %v", got)
+	}
+	if state := loadTestState(t, dir); state.Transaction.Phase != TxRolledBack || !state.isBlacklisted("2.0.0") {
+		t.Errorf("状态 = %+v，期望回滚并加入黑名单", state)
+	}
+}
+
+func TestTransactionPhases(t *testing.T) {
+	// 正常更新依次经过 staged → verified → swapped → probation → committed，每个阶段都先写入磁盘
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"server": "v1", "server.new": "v2"})
+	u := newTestUpdater(t, dir, &UpdaterConfig{})
+	u.RecordInstalled(InstalledRecord{Version: "1.0.0"})
+
+	expectPhase := func(phase string) {
+		t.Helper()
+		tx := loadTestState(t, dir).Transaction
+		if tx == nil || tx.Phase != phase {
+			t.Fatalf("磁盘上的事务 = %+v，期望阶段 %s", tx, phase)
+		}
+	}
+
+	u.beginTransaction(&UpdateInfo{Version: "2.0.0"})
+	expectPhase(TxStaged)
+
+	if err := u.verifyStaged(InstalledRecord{Version: "2.0.0", Source: "update"}); err != nil {
+		t.Fatal(err)
+	}
+	expectPhase(TxVerified)
+	if info, err := os.Stat(filepath.Join(dir, "server.new")); err != nil || info.Mode().Perm()&0100 == 0 {
+		t.Errorf("新版本应可执行: %v", err)
+	}
+
+	u.setPendingUpdate(true)
+	if err := u.applyPending(); err != nil {
+		t.Fatal(err)
+	}
+	expectPhase(TxSwapped)
+	if got := readTestFiles(t, dir); !reflect.DeepEqual(got, map[string]string{"server": "v2", "server.old": "v1"}) {
+		t.Errorf("替换后的文件 = %v", got)
+	}
+	if state := loadTestState(t, dir); state.Installed.Version != "2.0.0" || state.Transaction.Previous.Version != "1.0.0" {
+		t.Errorf("状态 = %+v", state)
+	}
+
+	p := u.beginProbation()
+	if p == nil {
+		t.Fatal("beginProbation 返回 nil")
+	}
+	expectPhase(TxProbation)
+
+	u.commitProbation(p)
+	expectPhase(TxCommitted)
+	if got := readTestFiles(t, dir); !reflect.DeepEqual(got, map[string]string{"server": "v2"}) {
+		t.Errorf("提交后的文件 = %v", got)
+	}
+}
+
+func TestTransactionRollback(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"server": "v1", "server.new": "v2"})
+	u := newTestUpdater(t, dir, &UpdaterConfig{})
+	u.RecordInstalled(InstalledRecord{Version: "1.0.0"})
+
+	u.beginTransaction(&UpdateInfo{Version: "2.0.0"})
+	if err := u.verifyStaged(InstalledRecord{Version: "2.0.0"}); err != nil {
+		t.Fatal(err)
+	}
+	u.setPendingUpdate(true)
+	if err := u.applyPending(); err != nil {
+		t.Fatal(err)
+	}
+	p := u.beginProbation()
+	if err := u.rollbackProbation(p, "健康检查失败"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readTestFiles(t, dir); !reflect.DeepEqual(got, map[string]string{"server": "v1"}) {
+		t.Errorf("回滚后的文件 = %v", got)
+	}
+	state := loadTestState(t, dir)
+	if state.Transaction.Phase != TxRolledBack || state.Transaction.Reason != "健康检查失败" || state.Transaction.RollingBack {
+		t.Errorf("事务 = %+v", state.Transaction)
+	}
+	if state.Installed.Version != "1.0.0" || !state.isBlacklisted("v2.0.0") {
+		t.Errorf("状态 = %+v", state)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+
+	for _, content := range []string{"first", "second, longer content", "3"} {
+		if err := writeFileAtomic(path, []byte(content), 0644); err != nil {
+			t.Fatalf("writeFileAtomic: %v", err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil || string(data) != content {
+			t.Fatalf("内容 = %q, %v，期望 %q", data, err, content)
+		}
+		if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+			t.Fatalf("临时文件没有删除: %v", err)
+		}
+	}
+
+	// 写入失败时保留原内容
+	os.Mkdir(path+".tmp", 0755)
+	if err := writeFileAtomic(path, []byte("lost"), 0644); err == nil {
+		t.Fatal("临时文件无法创建时应返回错误")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "3" {
+		t.Errorf("写入失败后内容 = %q", data)
+	}
+
+	if err := writeFileAtomic(filepath.Join(dir, "missing", "state.json"), []byte("x"), 0644); err == nil {
+		t.Error("目录不存在时应返回错误")
+	}
+}
+
+func TestStateSaveRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	expires := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	state := &UpdaterState{
+		Installed: InstalledRecord{Version: "1.2.0", Source: "update"},
+		Blacklist: []string{"1.1.0"},
+		Transaction: &UpdateTransaction{
+			Version:   "1.3.0",
+			Phase:     TxReady,
+			ExpiresAt: &expires,
+		},
+	}
+	saveTestState(t, dir, state)
+	loaded := loadTestState(t, dir)
+	if !reflect.DeepEqual(loaded, state) {
+		t.Errorf("读取的状态 = %+v，期望 %+v", loaded, state)
+	}
+
+	// 状态文件损坏时使用空状态
+	os.WriteFile(filepath.Join(dir, stateFileName), []byte("{broken"), 0644)
+	if s, err := loadState(filepath.Join(dir, stateFileName)); err == nil || s == nil || s.Transaction != nil {
+		t.Errorf("loadState = %+v, %v，期望空状态和错误", s, err)
+	} else if !strings.Contains(err.Error(), "解析状态文件失败") {
+		t.Errorf("错误 = %v", err)
+	}
+}
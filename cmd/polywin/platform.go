@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// defaultAssetTemplate 非 Windows amd64 平台默认的发布产物名称模板
+// 占位符：{name} 目标程序名（不含 .exe）、{os}、{arch}、{ext}（Windows 为 .exe，其他平台为空）
+const defaultAssetTemplate = "{name}_{os}_{arch}{ext}"
+
+// exeSuffix 当前平台可执行文件的扩展名
+func exeSuffix() string {
+	if runtime.GOOS == "windows" {
+		return ".exe"
+	}
+	return ""
+}
+
+// withExeSuffix 在 Windows 上为没有扩展名的目标程序补上 .exe
+func withExeSuffix(path string) string {
+	if filepath.Ext(path) == "" {
+		return path + exeSuffix()
+	}
+	return path
+}
+
+// platformKey 当前平台标识，如 linux/arm64
+func platformKey() string {
+	return runtime.GOOS + "/" + runtime.GOARCH
+}
+
+// assetName 返回当前平台的发布产物名称：展开 tmpl 中的占位符
+// tmpl 为空时，Windows amd64 沿用与目标程序同名的文件（兼容已有的 server.exe 发布），其他平台使用 defaultAssetTemplate
+func assetName(tmpl, target string) string {
+	if tmpl == "" {
+		if runtime.GOOS == "windows" && runtime.GOARCH == "amd64" {
+			return target
+		}
+		tmpl = defaultAssetTemplate
+	}
+	name := target
+	if strings.EqualFold(filepath.Ext(name), ".exe") {
+		name = name[:len(name)-len(".exe")]
+	}
+	return strings.NewReplacer(
+		"{name}", name,
+		"{os}", runtime.GOOS,
+		"{arch}", runtime.GOARCH,
+		"{ext}", exeSuffix(),
+	).Replace(tmpl)
+}
+
+// PlatformAsset 更新信息中某个平台的发布产物
+type PlatformAsset struct {
+	DownloadURL  string      `json:"download_url"`
+	Checksum     string      `json:"checksum"`
+	Size         int64       `json:"size"`
+	SignatureURL string      `json:"signature_url"`
+	Patches      []PatchInfo `json:"patches,omitempty"`
+}
+
+// selectPlatformAsset 更新信息中有 assets 时，用当前平台的条目替换下载地址、校验和等字段
+// assets 的键为 <os>/<arch>（也接受 <os>_<arch>），没有当前平台时返回错误
+func selectPlatformAsset(info *UpdateInfo) error {
+	if len(info.Assets) == 0 {
+		return nil
+	}
+	a, ok := info.Assets[platformKey()]
+	if !ok {
+		a, ok = info.Assets[runtime.GOOS+"_"+runtime.GOARCH]
+	}
+	if !ok {
+		keys := make([]string, 0, len(info.Assets))
+		for k := range info.Assets {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return fmt.Errorf("更新信息中没有 %s 平台的发布产物（assets 中只有 %s）", platformKey(), strings.Join(keys, "、"))
+	}
+	info.DownloadURL = a.DownloadURL
+	info.Checksum = a.Checksum
+	info.Size = a.Size
+	info.SignatureURL = a.SignatureURL
+	info.Patches = a.Patches
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ProbationSettings 更新后试运行参数
+type ProbationSettings struct {
+	Window         time.Duration // 试运行时长，期间退出即回滚
+	RequireHealthy bool          // 配置了健康检查时，窗口结束前必须通过检查
+	VersionURL     string        // 查询运行版本的地址，为空不校验
+	VersionField   string        // 版本字段路径，如 version 或 server.config.version
+}
+
+// watchProbation 在试运行窗口结束时检查新版本状态，不合格则停止进程触发回滚
+func (s *Supervisor) watchProbation(cmd *exec.Cmd, exited chan struct{}, p *installedUpdate) {
+	log.Printf("版本 %s 进入试运行，时长 %v", p.Version, s.config.Probation.Window)
+
+	timer := time.NewTimer(s.config.Probation.Window)
+	defer timer.Stop()
+
+	// 进程在窗口内退出时由 Run 负责回滚
+	select {
+	case <-exited:
+		return
+	case <-s.ctx.Done():
+		return
+	case <-timer.C:
+	}
+
+	if reason := s.probationVerdict(p); reason != "" {
+		s.mu.Lock()
+		if s.stopping {
+			s.mu.Unlock()
+			return
+		}
+		s.rollbackReason = reason
+		s.mu.Unlock()
+
+		s.terminate(cmd, exited)
+		return
+	}
+
+	s.updater.commitProbation(p)
+}
+
+// probationVerdict 检查试运行结果，返回失败原因，通过时返回空字符串
+func (s *Supervisor) probationVerdict(p *installedUpdate) string {
+	settings := s.config.Probation
+
+	if settings.RequireHealthy && s.config.HealthCheck != nil {
+		health := s.Status().Health
+		if health.Status != HealthHealthy {
+			if health.LastError != "" {
+				return fmt.Sprintf("未通过就绪检查: %s", health.LastError)
+			}
+			return "未通过就绪检查"
+		}
+	}
+
+	if settings.VersionURL != "" && p.Version != "" {
+		ctx, cancel := context.WithTimeout(s.ctx, 10*time.Second)
+		defer cancel()
+		reported, err := fetchReportedVersion(ctx, settings.VersionURL, settings.VersionField)
+		if err != nil {
+			return fmt.Sprintf("获取运行版本失败: %v", err)
+		}
+		if !sameVersion(reported, p.Version) {
+			return fmt.Sprintf("运行版本为 %s，期望 %s", reported, p.Version)
+		}
+	}
+
+	return ""
+}
+
+// takeRollbackReason 取出并清除试运行检查失败的原因
+func (s *Supervisor) takeRollbackReason() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reason := s.rollbackReason
+	s.rollbackReason = ""
+	return reason
+}
+
+// fetchReportedVersion 从目标程序的 HTTP 接口读取版本号，field 为点分 JSON 路径
+func fetchReportedVersion(ctx context.Context, url, field string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", fmt.Errorf("创建请求失败: %v", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("HTTP 状态码: %d", resp.StatusCode)
+	}
+
+	var body interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("解析响应失败: %v", err)
+	}
+
+	if field == "" {
+		field = "version"
+	}
+	value := body
+	for _, key := range strings.Split(field, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("响应中没有字段 %s", field)
+		}
+		if value, ok = obj[key]; !ok {
+			return "", fmt.Errorf("响应中没有字段 %s", field)
+		}
+	}
+
+	version, ok := value.(string)
+	if !ok || version == "" {
+		return "", fmt.Errorf("字段 %s 不是有效的版本号", field)
+	}
+	return version, nil
+}
+
+// sameVersion 比较版本号，忽略 v 前缀
+func sameVersion(a, b string) bool {
+	return strings.TrimPrefix(strings.TrimSpace(a), "v") == strings.TrimPrefix(strings.TrimSpace(b), "v")
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newInfoServer 返回模拟目标程序 /info 接口的服务器，version 为空时返回 503
+func newInfoServer(t *testing.T, version string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if version == "" {
+			http.Error(w, "starting", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, `{"server": {"config": {"version": %q}}}`, version)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// copyTestTarget 将测试程序本身复制为 dst，作为可以启动的目标程序
+func copyTestTarget(t *testing.T, dst string) {
+	t.Helper()
+	src, err := os.Open(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// stageSwapped 模拟刚替换完的更新：server 为新版本 2.0.0，server.old 为旧版本 1.0.0，下次启动进入试运行
+func stageSwapped(t *testing.T, dir string) *Updater {
+	t.Helper()
+	copyTestTarget(t, filepath.Join(dir, "server"))
+	copyTestTarget(t, filepath.Join(dir, "server.old"))
+	tx := &UpdateTransaction{
+		Version:   "2.0.0",
+		Phase:     TxSwapped,
+		Target:    filepath.Join(dir, "server"),
+		Installed: InstalledRecord{Version: "2.0.0"},
+		Previous:  InstalledRecord{Version: "1.0.0"},
+	}
+	saveTestState(t, dir, &UpdaterState{Installed: tx.Installed, MachineID: "test", Transaction: tx})
+	u := newTestUpdater(t, dir, &UpdaterConfig{})
+	u.Reconcile()
+	return u
+}
+
+func TestProbation(t *testing.T) {
+	failing := &HealthCheckSettings{
+		Checker:          checkFunc(func(ctx context.Context) error { return errors.New("未就绪") }),
+		Interval:         20 * time.Millisecond,
+		Timeout:          time.Second,
+		StartPeriod:      time.Hour,
+		FailureThreshold: 1,
+	}
+
+	tests := []struct {
+		name       string
+		mode       string
+		reported   string // /info 返回的版本，为空不校验
+		health     *HealthCheckSettings
+		probation  ProbationSettings
+		wantReason string // 为空表示通过试运行
+	}{
+		{"通过试运行", "run", "", nil, ProbationSettings{}, ""},
+		{"试运行期间退出", "crash-first", "", nil, ProbationSettings{}, "试运行期间退出"},
+		{"运行版本一致（忽略 v 前缀）", "run", "v2.0.0", nil, ProbationSettings{}, ""},
+		{"运行版本不符", "run", "1.0.0", nil, ProbationSettings{}, "运行版本为 1.0.0，期望 2.0.0"},
+		{"未通过就绪检查", "run", "", failing, ProbationSettings{RequireHealthy: true}, "未通过就绪检查: 未就绪"},
+		{"不要求就绪时忽略健康状态", "run", "", failing, ProbationSettings{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			u := stageSwapped(t, dir)
+
+			settings := tt.probation
+			settings.Window = 200 * time.Millisecond
+			if tt.reported != "" {
+				settings.VersionURL = newInfoServer(t, tt.reported).URL
+				settings.VersionField = "server.config.version"
+			}
+			s, target := newTestSupervisor(t, tt.mode, SupervisorConfig{
+				TargetPath:  filepath.Join(dir, "server"),
+				HealthCheck: tt.health,
+				Probation:   settings,
+			}, u)
+			runSupervisor(s)
+
+			waitFor(t, "试运行结束", func() bool {
+				phase := loadTestState(t, dir).Transaction.Phase
+				return phase == TxCommitted || phase == TxRolledBack
+			})
+			state := loadTestState(t, dir)
+			if tt.wantReason == "" {
+				if state.Transaction.Phase != TxCommitted || state.Installed.Version != "2.0.0" || len(state.Blacklist) != 0 {
+					t.Fatalf("状态 = %+v，期望通过试运行", state)
+				}
+				if n := target.starts(); n != 1 {
+					t.Errorf("启动了 %d 次，期望 1 次", n)
+				}
+			} else {
+				if state.Transaction.Phase != TxRolledBack || !strings.Contains(state.Transaction.Reason, tt.wantReason) {
+					t.Fatalf("事务 = %+v，期望回滚（%s）", state.Transaction, tt.wantReason)
+				}
+				if state.Installed.Version != "1.0.0" || !state.isBlacklisted("v2.0.0") {
+					t.Errorf("已安装 %s，黑名单 %v，期望恢复 1.0.0 并拉黑 2.0.0", state.Installed.Version, state.Blacklist)
+				}
+				// 回滚后立即启动旧版本
+				waitFor(t, "启动旧版本", func() bool { return target.starts() == 2 })
+			}
+			// 提交后才删除旧版本备份
+			waitFor(t, "删除或恢复 server.old", func() bool {
+				_, err := os.Stat(filepath.Join(dir, "server.old"))
+				return os.IsNotExist(err)
+			})
+			if _, err := os.Stat(filepath.Join(dir, "server")); err != nil {
+				t.Errorf("目标程序缺失: %v", err)
+			}
+		})
+	}
+}
+
+func TestProbationStartFailure(t *testing.T) {
+	// 新版本无法启动时直接回滚
+	dir := t.TempDir()
+	u := stageSwapped(t, dir)
+	writeTestFiles(t, dir, map[string]string{"server": "not an executable"})
+
+	s, target := newTestSupervisor(t, "run", SupervisorConfig{
+		TargetPath: filepath.Join(dir, "server"),
+		Probation:  ProbationSettings{Window: time.Hour},
+	}, u)
+	runSupervisor(s)
+
+	waitFor(t, "启动旧版本", func() bool { return target.starts() == 1 })
+	state := loadTestState(t, dir)
+	if state.Transaction.Phase != TxRolledBack || !strings.Contains(state.Transaction.Reason, "启动失败") {
+		t.Errorf("事务 = %+v，期望因启动失败回滚", state.Transaction)
+	}
+	if !state.isBlacklisted("2.0.0") {
+		t.Errorf("黑名单 = %v", state.Blacklist)
+	}
+}
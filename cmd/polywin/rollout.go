@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// rolloutBuckets 分组数量，分组精确到 0.01%
+const rolloutBuckets = 10000
+
+// RolloutInfo 分阶段发布：只有分组落在当前发布比例内的机器安装新版本
+// 设置 duration 时，发布比例从 start 开始在 duration 内由 percentage 线性增长到 100%
+type RolloutInfo struct {
+	Percentage float64 `json:"percentage"`         // 发布比例（0-100），0 表示暂停发布
+	Start      string  `json:"start,omitempty"`    // 开始增长的时间（RFC 3339），为空时使用 release_date
+	Duration   string  `json:"duration,omitempty"` // 增长到 100% 所需的时间（如 72h），为空时保持 percentage 不变
+}
+
+// validate 检查分阶段发布配置，releaseDate 在没有设置 start 时作为开始时间
+func (r *RolloutInfo) validate(releaseDate string) error {
+	if r.Percentage < 0 || r.Percentage > 100 {
+		return fmt.Errorf("rollout.percentage 必须在 0-100 之间: %v", r.Percentage)
+	}
+	if r.Duration != "" {
+		_, err := r.current(releaseDate, time.Now())
+		return err
+	}
+	if r.Start != "" {
+		if _, err := time.Parse(time.RFC3339, r.Start); err != nil {
+			return fmt.Errorf("rollout.start 无效（需要 RFC 3339 格式）: %s", r.Start)
+		}
+	}
+	return nil
+}
+
+// current 返回 now 时刻的发布比例，releaseDate 在没有设置 start 时作为开始时间
+func (r *RolloutInfo) current(releaseDate string, now time.Time) (float64, error) {
+	if r.Duration == "" {
+		return r.Percentage, nil
+	}
+	duration, err := time.ParseDuration(r.Duration)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("rollout.duration 无效: %s", r.Duration)
+	}
+
+	start, err := rolloutStart(r.Start, releaseDate)
+	if err != nil {
+		return 0, err
+	}
+	elapsed := now.Sub(start)
+	switch {
+	case elapsed <= 0:
+		return r.Percentage, nil
+	case elapsed >= duration:
+		return 100, nil
+	}
+	return r.Percentage + (100-r.Percentage)*float64(elapsed)/float64(duration), nil
+}
+
+// rolloutStart 返回发布比例开始增长的时间：优先使用 start，其次使用 release_date（RFC 3339 或日期）
+func rolloutStart(start, releaseDate string) (time.Time, error) {
+	if start != "" {
+		t, err := time.Parse(time.RFC3339, start)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("rollout.start 无效（需要 RFC 3339 格式）: %s", start)
+		}
+		return t, nil
+	}
+	releaseDate = strings.TrimSpace(releaseDate)
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, releaseDate); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("rollout 设置了 duration，但没有 start，release_date 也不是有效的时间: %q", releaseDate)
+}
+
+// newMachineID 生成随机的机器 ID
+func newMachineID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成机器 ID 失败: %v", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// machineBucket 根据机器 ID 计算分组（0 到 100 之间，精确到 0.01），同一台机器始终落在同一分组
+func machineBucket(machineID string) float64 {
+	sum := sha256.Sum256([]byte(machineID))
+	return float64(binary.BigEndian.Uint64(sum[:8])%rolloutBuckets) / (rolloutBuckets / 100)
+}
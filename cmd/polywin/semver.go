@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version 语义化版本（semver 2.0），允许 v 前缀，允许省略 minor/patch
+type Version struct {
+	Major, Minor, Patch int
+	Prerelease          []string
+	Build               string
+}
+
+// ParseVersion 解析版本号，如 v1.2.3、1.2.3-beta.1+build.5
+func ParseVersion(s string) (Version, error) {
+	var v Version
+	orig := s
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if s == "" {
+		return v, fmt.Errorf("版本号为空")
+	}
+
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		v.Build = s[i+1:]
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		pre := s[i+1:]
+		s = s[:i]
+		if pre == "" {
+			return v, fmt.Errorf("无效的版本号: %s", orig)
+		}
+		v.Prerelease = strings.Split(pre, ".")
+		for _, id := range v.Prerelease {
+			if id == "" {
+				return v, fmt.Errorf("无效的版本号: %s", orig)
+			}
+		}
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return v, fmt.Errorf("无效的版本号: %s", orig)
+	}
+	nums := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("无效的版本号: %s", orig)
+		}
+		*nums[i] = n
+	}
+	return v, nil
+}
+
+// String 返回不带 v 前缀的版本号
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if len(v.Prerelease) > 0 {
+		s += "-" + strings.Join(v.Prerelease, ".")
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// IsPrerelease 是否为预发布版本
+func (v Version) IsPrerelease() bool {
+	return len(v.Prerelease) > 0
+}
+
+// Compare 比较版本，返回 -1、0、1（忽略 build 元数据）
+func (v Version) Compare(o Version) int {
+	if c := compareInt(v.Major, o.Major); c != 0 {
+		return c
+	}
+	if c := compareInt(v.Minor, o.Minor); c != 0 {
+		return c
+	}
+	if c := compareInt(v.Patch, o.Patch); c != 0 {
+		return c
+	}
+
+	// 有预发布标识的版本低于正式版本
+	switch {
+	case len(v.Prerelease) == 0 && len(o.Prerelease) == 0:
+		return 0
+	case len(v.Prerelease) == 0:
+		return 1
+	case len(o.Prerelease) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(v.Prerelease) && i < len(o.Prerelease); i++ {
+		a, b := v.Prerelease[i], o.Prerelease[i]
+		an, aErr := strconv.Atoi(a)
+		bn, bErr := strconv.Atoi(b)
+		switch {
+		case aErr == nil && bErr == nil:
+			if c := compareInt(an, bn); c != 0 {
+				return c
+			}
+		case aErr == nil:
+			return -1 // 数字标识低于字母标识
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(a, b); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareInt(len(v.Prerelease), len(o.Prerelease))
+}
+
+// compareInt 比较整数
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// isNewerVersion 判断 candidate 是否比 installed 新
+// 两者都是语义化版本时按 semver 比较，否则只要不同就视为新版本（如提交哈希）
+func isNewerVersion(candidate, installed string) bool {
+	if installed == "" {
+		return true
+	}
+	c, cErr := ParseVersion(candidate)
+	i, iErr := ParseVersion(installed)
+	if cErr == nil && iErr == nil {
+		return c.Compare(i) > 0
+	}
+	return !sameVersion(candidate, installed)
+}
+
+// versionGreater 两者都是语义化版本且 a 高于 b 时返回 true，无法比较时返回 false
+func versionGreater(a, b string) bool {
+	av, aErr := ParseVersion(a)
+	bv, bErr := ParseVersion(b)
+	return aErr == nil && bErr == nil && av.Compare(bv) > 0
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Version
+		ok   bool
+	}{
+		{"1.2.3", Version{Major: 1, Minor: 2, Patch: 3}, true},
+		{"v1.2.3", Version{Major: 1, Minor: 2, Patch: 3}, true},
+		{" v10.20.30 ", Version{Major: 10, Minor: 20, Patch: 30}, true},
+		{"1.2", Version{Major: 1, Minor: 2}, true},
+		{"v2", Version{Major: 2}, true},
+		{"1.2.3-beta.1", Version{Major: 1, Minor: 2, Patch: 3, Prerelease: []string{"beta", "1"}}, true},
+		{"1.2.3-rc-1", Version{Major: 1, Minor: 2, Patch: 3, Prerelease: []string{"rc-1"}}, true},
+		{"1.2.3+build.5", Version{Major: 1, Minor: 2, Patch: 3, Build: "build.5"}, true},
+		{"1.2.3-beta.1+exp.sha.5114f85", Version{Major: 1, Minor: 2, Patch: 3, Prerelease: []string{"beta", "1"}, Build: "exp.sha.5114f85"}, true},
+		{"", Version{}, false},
+		{"v", Version{}, false},
+		{"1.2.3.4", Version{}, false},
+		{"1..3", Version{}, false},
+		{"1.2.x", Version{}, false},
+		{"1.2.3-", Version{}, false},
+		{"1.2.3-beta..1", Version{}, false},
+		{"-1.2.3", Version{}, false},
+		{"1.-2.3", Version{}, false},
+		{"latest", Version{}, false},
+		{"3effef0", Version{}, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseVersion(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseVersion(%q) 错误 = %v，期望成功: %v", tt.in, err, tt.ok)
+			continue
+		}
+		if tt.ok && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseVersion(%q) = %+v，期望 %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestVersionCompareOrdering(t *testing.T) {
+	// semver 2.0 规范中的优先级示例，从低到高
+	ordered := []string{
+		"0.9.9",
+		"1.0.0-0",
+		"1.0.0-2",
+		"1.0.0-10",
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.0.1",
+		"1.1.0",
+		"1.10.0",
+		"2.0.0",
+	}
+	for i, a := range ordered {
+		av, err := ParseVersion(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j, b := range ordered {
+			bv, _ := ParseVersion(b)
+			want := compareInt(i, j)
+			if got := av.Compare(bv); got != want {
+				t.Errorf("Compare(%s, %s) = %d，期望 %d", a, b, got, want)
+			}
+		}
+	}
+}
+
+func TestVersionCompareEqual(t *testing.T) {
+	tests := [][2]string{
+		{"1.2.3", "v1.2.3"},
+		{"1.2", "1.2.0"},
+		{"1", "1.0.0"},
+		{"1.2.3+build.1", "1.2.3+build.2"},
+		{"1.2.3-rc.1+a", "1.2.3-rc.1"},
+	}
+	for _, tt := range tests {
+		a, _ := ParseVersion(tt[0])
+		b, _ := ParseVersion(tt[1])
+		if c := a.Compare(b); c != 0 {
+			t.Errorf("Compare(%s, %s) = %d，期望 0", tt[0], tt[1], c)
+		}
+	}
+}
+
+func TestIsNewerVersion(t *testing.T) {
+	tests := []struct {
+		candidate, installed string
+		want                 bool
+	}{
+		{"v1.2.0", "", true},
+		{"v1.2.0", "v1.1.9", true},
+		{"v1.2.0", "1.2.0", false},
+		{"v1.1.9", "v1.2.0", false},
+		{"v1.2.0", "v1.2.0-rc.1", true},
+		{"v1.2.0-rc.2", "v1.2.0", false},
+		{"v1.10.0", "v1.9.0", true},
+		{"v1.2.0+build.2", "v1.2.0+build.1", false},
+		// 不是语义化版本时只比较是否相同
+		{"3effef0", "1b9e48a", true},
+		{"3effef0", "3effef0", false},
+		{"v1.2.0", "3effef0", true},
+	}
+	for _, tt := range tests {
+		if got := isNewerVersion(tt.candidate, tt.installed); got != tt.want {
+			t.Errorf("isNewerVersion(%q, %q) = %v，期望 %v", tt.candidate, tt.installed, got, tt.want)
+		}
+	}
+}
+
+func TestVersionString(t *testing.T) {
+	tests := map[string]string{
+		"v1.2.3":           "1.2.3",
+		"1.2":              "1.2.0",
+		"1.2.3-beta.1":     "1.2.3-beta.1",
+		"1.2.3-rc.1+build": "1.2.3-rc.1+build",
+	}
+	for in, want := range tests {
+		v, err := ParseVersion(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := v.String(); got != want {
+			t.Errorf("ParseVersion(%q).String() = %q，期望 %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// 签名格式兼容 minisign 和 signify：
+//   公钥:   base64("Ed" + 8 字节 key id + 32 字节公钥)
+//   签名:   base64(算法 + 8 字节 key id + 64 字节签名)
+// 算法 "Ed" 对原始内容签名（signify、旧版 minisign），"ED" 对 BLAKE2b-512 摘要签名（minisign 默认）
+// minisign 签名文件还包含 trusted comment 及其全局签名，一并校验
+
+// trustedKeys 编译时嵌入的公钥，多个公钥用逗号分隔
+// go build -ldflags "-X main.trustedKeys=RWQ...,RWR..."
+var trustedKeys = ""
+
+// 签名文件后缀，按顺序尝试
+var signatureSuffixes = []string{".minisig", ".sig"}
+
+const (
+	sigAlgLegacy    = "Ed" // 对原始内容签名
+	sigAlgPrehashed = "ED" // 对 BLAKE2b-512 摘要签名
+)
+
+// PublicKey ed25519 公钥
+type PublicKey struct {
+	KeyID [8]byte
+	Key   ed25519.PublicKey
+}
+
+// ID 返回十六进制 key id（与 minisign 显示的一致）
+func (k *PublicKey) ID() string {
+	id := k.KeyID
+	// minisign 以小端整数显示 key id
+	for i, j := 0, len(id)-1; i < j; i, j = i+1, j-1 {
+		id[i], id[j] = id[j], id[i]
+	}
+	return strings.ToUpper(hex.EncodeToString(id[:]))
+}
+
+// Signature 解析后的签名文件
+type Signature struct {
+	Algorithm       string
+	KeyID           [8]byte
+	Sig             []byte
+	TrustedComment  string
+	GlobalSignature []byte // 为 nil 表示 signify 格式，没有 trusted comment
+}
+
+// ParsePublicKey 解析公钥，接受完整的公钥文件内容或单行 base64
+func ParsePublicKey(s string) (*PublicKey, error) {
+	line := lastDataLine(s)
+	raw, err := base64.StdEncoding.DecodeString(line)
+	if err != nil {
+		return nil, fmt.Errorf("公钥不是有效的 base64: %v", err)
+	}
+	if len(raw) != 2+8+ed25519.PublicKeySize || string(raw[:2]) != sigAlgLegacy {
+		return nil, fmt.Errorf("不支持的公钥格式")
+	}
+	k := &PublicKey{Key: ed25519.PublicKey(raw[10:])}
+	copy(k.KeyID[:], raw[2:10])
+	return k, nil
+}
+
+// ParsePublicKeys 解析多个公钥（用于密钥轮换）
+func ParsePublicKeys(keys []string) ([]*PublicKey, error) {
+	var result []*PublicKey
+	for _, s := range keys {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		k, err := ParsePublicKey(s)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, k)
+	}
+	return result, nil
+}
+
+// ParseSignature 解析 minisign 或 signify 签名文件
+func ParseSignature(data []byte) (*Signature, error) {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) < 2 || !strings.HasPrefix(lines[0], "untrusted comment:") {
+		return nil, fmt.Errorf("签名文件格式错误")
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil {
+		return nil, fmt.Errorf("签名不是有效的 base64: %v", err)
+	}
+	if len(raw) != 2+8+ed25519.SignatureSize {
+		return nil, fmt.Errorf("签名长度错误")
+	}
+	sig := &Signature{Algorithm: string(raw[:2]), Sig: raw[10:]}
+	copy(sig.KeyID[:], raw[2:10])
+	if sig.Algorithm != sigAlgLegacy && sig.Algorithm != sigAlgPrehashed {
+		return nil, fmt.Errorf("不支持的签名算法: %q", sig.Algorithm)
+	}
+
+	// minisign: trusted comment 和全局签名
+	if len(lines) >= 4 {
+		const prefix = "trusted comment: "
+		if !strings.HasPrefix(lines[2], prefix) {
+			return nil, fmt.Errorf("签名文件格式错误: 缺少 trusted comment")
+		}
+		sig.TrustedComment = strings.TrimPrefix(lines[2], prefix)
+		if sig.GlobalSignature, err = base64.StdEncoding.DecodeString(lines[3]); err != nil {
+			return nil, fmt.Errorf("全局签名不是有效的 base64: %v", err)
+		}
+		if len(sig.GlobalSignature) != ed25519.SignatureSize {
+			return nil, fmt.Errorf("全局签名长度错误")
+		}
+	} else if sig.Algorithm == sigAlgPrehashed {
+		return nil, fmt.Errorf("签名文件格式错误: 缺少 trusted comment")
+	}
+	return sig, nil
+}
+
+// VerifySignature 使用受信任公钥中 key id 匹配的那一个校验内容
+func VerifySignature(keys []*PublicKey, r io.Reader, sig *Signature) (*PublicKey, error) {
+	var key *PublicKey
+	for _, k := range keys {
+		if k.KeyID == sig.KeyID {
+			key = k
+			break
+		}
+	}
+	if key == nil {
+		return nil, fmt.Errorf("签名使用的密钥不受信任")
+	}
+
+	var message []byte
+	if sig.Algorithm == sigAlgPrehashed {
+		h, _ := blake2b.New512(nil)
+		if _, err := io.Copy(h, r); err != nil {
+			return nil, fmt.Errorf("读取内容失败: %v", err)
+		}
+		message = h.Sum(nil)
+	} else {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("读取内容失败: %v", err)
+		}
+		message = data
+	}
+
+	if !ed25519.Verify(key.Key, message, sig.Sig) {
+		return nil, fmt.Errorf("签名与内容不匹配")
+	}
+
+	if sig.GlobalSignature != nil {
+		global := append(append([]byte{}, sig.Sig...), sig.TrustedComment...)
+		if !ed25519.Verify(key.Key, global, sig.GlobalSignature) {
+			return nil, fmt.Errorf("trusted comment 签名校验失败")
+		}
+	}
+	return key, nil
+}
+
+// verifyFileSignature 校验文件签名
+func verifyFileSignature(keys []*PublicKey, path string, sigData []byte) (*PublicKey, error) {
+	sig, err := ParseSignature(sigData)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return VerifySignature(keys, f, sig)
+}
+
+// embeddedPublicKeys 返回编译时嵌入的公钥
+func embeddedPublicKeys() []string {
+	if trustedKeys == "" {
+		return nil
+	}
+	return strings.Split(trustedKeys, ",")
+}
+
+// lastDataLine 返回最后一个非注释行（公钥文件第一行是 untrusted comment）
+func lastDataLine(s string) string {
+	var last string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "untrusted comment:") {
+			continue
+		}
+		last = line
+	}
+	return last
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// testSigner 测试用的签名密钥
+type testSigner struct {
+	keyID [8]byte
+	priv  ed25519.PrivateKey
+}
+
+// newTestSigner 由固定种子生成签名密钥
+func newTestSigner(seed byte, keyID string) *testSigner {
+	s := &testSigner{priv: ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize))}
+	copy(s.keyID[:], keyID)
+	return s
+}
+
+// publicKeyFile 返回 minisign 格式的公钥文件内容
+func (s *testSigner) publicKeyFile() string {
+	raw := append(append([]byte(sigAlgLegacy), s.keyID[:]...), s.priv.Public().(ed25519.PublicKey)...)
+	return "untrusted comment: minisign public key\n" + base64.StdEncoding.EncodeToString(raw) + "\n"
+}
+
+// sign 生成签名文件：prehashed 为 true 时对 BLAKE2b-512 摘要签名，comment 为空时生成 signify 格式
+func (s *testSigner) sign(data []byte, prehashed bool, comment string) []byte {
+	alg, message := sigAlgLegacy, data
+	if prehashed {
+		sum := blake2b.Sum512(data)
+		alg, message = sigAlgPrehashed, sum[:]
+	}
+	sig := ed25519.Sign(s.priv, message)
+	raw := append(append([]byte(alg), s.keyID[:]...), sig...)
+
+	var buf strings.Builder
+	buf.WriteString("untrusted comment: signature from test key\n")
+	buf.WriteString(base64.StdEncoding.EncodeToString(raw) + "\n")
+	if comment != "" {
+		global := ed25519.Sign(s.priv, append(append([]byte{}, sig...), comment...))
+		buf.WriteString("trusted comment: " + comment + "\n")
+		buf.WriteString(base64.StdEncoding.EncodeToString(global) + "\n")
+	}
+	return []byte(buf.String())
+}
+
+// mustPublicKey 解析测试公钥
+func mustPublicKey(t *testing.T, s *testSigner) *PublicKey {
+	t.Helper()
+	k, err := ParsePublicKey(s.publicKeyFile())
+	if err != nil {
+		t.Fatalf("ParsePublicKey: %v", err)
+	}
+	return k
+}
+
+func TestVerifySignature(t *testing.T) {
+	data := []byte("server binary v1.2.0")
+	signer := newTestSigner(1, "key-0001")
+	other := newTestSigner(2, "key-0002")
+	impostor := newTestSigner(3, "key-0001") // key id 相同但密钥不同
+
+	key := mustPublicKey(t, signer)
+	otherKey := mustPublicKey(t, other)
+
+	tamperedComment := bytes.Replace(signer.sign(data, true, "timestamp:1 file:server"), []byte("file:server"), []byte("file:evil"), 1)
+
+	tests := []struct {
+		name    string
+		keys    []*PublicKey
+		content []byte
+		sig     []byte
+		wantErr string // 为空表示校验通过
+	}{
+		{"minisign 摘要签名", []*PublicKey{key}, data, signer.sign(data, true, "timestamp:1 file:server"), ""},
+		{"minisign 原始内容签名", []*PublicKey{key}, data, signer.sign(data, false, "timestamp:1 file:server"), ""},
+		{"signify", []*PublicKey{key}, data, signer.sign(data, false, ""), ""},
+		{"密钥轮换时按 key id 选择", []*PublicKey{otherKey, key}, data, signer.sign(data, true, "c"), ""},
+		{"内容被修改", []*PublicKey{key}, []byte("server binary v6.6.6"), signer.sign(data, true, "c"), "签名与内容不匹配"},
+		{"signify 内容被修改", []*PublicKey{key}, append(data, 0), signer.sign(data, false, ""), "签名与内容不匹配"},
+		{"trusted comment 被修改", []*PublicKey{key}, data, tamperedComment, "trusted comment"},
+		{"不受信任的密钥", []*PublicKey{otherKey}, data, signer.sign(data, true, "c"), "不受信任"},
+		{"没有受信任的密钥", nil, data, signer.sign(data, true, "c"), "不受信任"},
+		{"key id 相同的其他密钥", []*PublicKey{key}, data, impostor.sign(data, true, "c"), "签名与内容不匹配"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sig, err := ParseSignature(tt.sig)
+			if err != nil {
+				t.Fatalf("ParseSignature: %v", err)
+			}
+			got, err := VerifySignature(tt.keys, bytes.NewReader(tt.content), sig)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("VerifySignature: %v", err)
+				}
+				if got.KeyID != signer.keyID {
+					t.Errorf("返回的公钥 %s，期望 %s", got.ID(), key.ID())
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("VerifySignature = %v，期望包含 %q 的错误", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseSignature(t *testing.T) {
+	signer := newTestSigner(1, "key-0001")
+	valid := string(signer.sign([]byte("x"), true, "c"))
+	lines := strings.Split(valid, "\n")
+	raw, _ := base64.StdEncoding.DecodeString(lines[1])
+
+	withAlg := func(alg string) string {
+		r := append([]byte(alg), raw[2:]...)
+		return lines[0] + "\n" + base64.StdEncoding.EncodeToString(r) + "\n"
+	}
+
+	tests := []struct {
+		name string
+		data string
+		ok   bool
+	}{
+		{"minisign", valid, true},
+		{"CRLF 换行", strings.ReplaceAll(valid, "\n", "\r\n"), true},
+		{"signify", string(signer.sign([]byte("x"), false, "")), true},
+		{"空文件", "", false},
+		{"缺少 untrusted comment", strings.Join(lines[1:], "\n"), false},
+		{"签名不是 base64", lines[0] + "\n!!!\n", false},
+		{"签名长度错误", lines[0] + "\n" + base64.StdEncoding.EncodeToString(raw[:40]) + "\n", false},
+		{"不支持的算法", withAlg("XX"), false},
+		{"摘要签名缺少 trusted comment", withAlg(sigAlgPrehashed), false},
+		{"trusted comment 前缀错误", lines[0] + "\n" + lines[1] + "\ncomment: c\n" + lines[3] + "\n", false},
+		{"全局签名长度错误", lines[0] + "\n" + lines[1] + "\n" + lines[2] + "\nAAAA\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSignature([]byte(tt.data))
+			if (err == nil) != tt.ok {
+				t.Errorf("ParseSignature = %v，期望成功: %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	signer := newTestSigner(1, "key-0001")
+	file := signer.publicKeyFile()
+	line := strings.Split(file, "\n")[1]
+	raw, _ := base64.StdEncoding.DecodeString(line)
+
+	tests := []struct {
+		name string
+		key  string
+		ok   bool
+	}{
+		{"公钥文件", file, true},
+		{"单行 base64", line, true},
+		{"不是 base64", "not a key", false},
+		{"长度错误", base64.StdEncoding.EncodeToString(raw[:20]), false},
+		{"算法错误", base64.StdEncoding.EncodeToString(append([]byte("XX"), raw[2:]...)), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := ParsePublicKey(tt.key)
+			if (err == nil) != tt.ok {
+				t.Fatalf("ParsePublicKey = %v，期望成功: %v", err, tt.ok)
+			}
+			if tt.ok && (k.KeyID != signer.keyID || !k.Key.Equal(signer.priv.Public())) {
+				t.Errorf("解析出的公钥不一致")
+			}
+		})
+	}
+
+	// minisign 以小端整数显示 key id
+	k := &PublicKey{KeyID: [8]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}}
+	if id := k.ID(); id != "0807060504030201" {
+		t.Errorf("ID() = %s", id)
+	}
+}
+
+func TestSigningKeyRequired(t *testing.T) {
+	key := newTestSigner(1, "key-0001").publicKeyFile()
+	tests := []struct {
+		name string
+		keys []string
+		skip bool
+		ok   bool
+	}{
+		{"没有公钥时拒绝启动", nil, false, false},
+		{"配置了公钥", []string{key}, false, true},
+		{"明确跳过签名校验", nil, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Signing.PublicKeys = tt.keys
+			cfg.Signing.InsecureSkipVerify = tt.skip
+			err := cfg.Validate()
+			if (err == nil) != tt.ok {
+				t.Fatalf("Validate = %v，期望成功: %v", err, tt.ok)
+			}
+			if skip := cfg.UpdaterConfig().SkipSignature; tt.ok && skip != tt.skip {
+				t.Errorf("SkipSignature = %v", skip)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// 更新源类型
+const (
+	SourceAuto      = "auto"       // 配置了 update_url 时使用 manifest，配置了 github.token 时使用 github-api，否则使用 github
+	SourceGitHub    = "github"     // GitHub Releases 下载地址
+	SourceGitHubAPI = "github-api" // GitHub Releases API
+	SourceManifest  = "manifest"   // HTTPS 版本信息（JSON 格式的 UpdateInfo）
+	SourceDirectory = "directory"  // 本地目录或网络共享
+)
+
+// UpdateSource 更新源：提供最新版本信息、发布产物和相关元数据（校验和、签名）
+// 发布产物和元数据用引用（ref）表示，可以是完整 URL，也可以是相对更新源位置的路径
+type UpdateSource interface {
+	// Latest 返回最新版本信息，installed 用于条件请求；没有发布或没有变化时返回 nil
+	Latest(ctx context.Context, installed InstalledRecord) (*UpdateInfo, error)
+	// FetchArtifact 下载发布产物到 outputPath，并按 expect 校验大小和校验和
+	FetchArtifact(ctx context.Context, ref, outputPath string, expect artifactExpectation) error
+	// FetchMetadata 读取小文件（checksums.txt、签名），不存在时返回 nil
+	FetchMetadata(ctx context.Context, ref string) ([]byte, error)
+	// String 返回更新源描述，用于日志
+	String() string
+}
+
+// siblingRef 返回与 ref 位于同一目录的文件引用
+func siblingRef(ref, name string) string {
+	if u, err := url.Parse(ref); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		return u.ResolveReference(&url.URL{Path: name}).String()
+	}
+	return path.Join(path.Dir(filepath.ToSlash(ref)), name)
+}
+
+// artifactName 返回引用指向的文件名（用于在 checksums.txt 中查找）
+func artifactName(ref string) string {
+	if u, err := url.Parse(ref); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		return path.Base(u.Path)
+	}
+	return path.Base(filepath.ToSlash(ref))
+}
+
+// parseManifest 解析版本信息，选择 channel 通道可以接收的最高版本和当前平台的发布产物，保留原始内容用于签名校验
+// 顶层版本的通道为 channel 字段或按版本号判断，channels 中的版本属于对应的通道；
+// 没有 channel 通道可以接收的版本时返回 nil
+func parseManifest(data []byte, ref, channel string) (*UpdateInfo, error) {
+	var manifest UpdateInfo
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("解析更新信息失败: %v", err)
+	}
+
+	var candidates []*UpdateInfo
+	if strings.TrimSpace(manifest.Version) != "" {
+		top := manifest
+		top.Channels = nil
+		if top.Channel == "" {
+			top.Channel = versionChannel(top.Version)
+		}
+		candidates = append(candidates, &top)
+	}
+	for name := range manifest.Channels {
+		if err := validateChannel(name); err != nil {
+			return nil, fmt.Errorf("更新信息的 channels 无效: %v", err)
+		}
+	}
+	for _, name := range channelOrder {
+		info, ok := manifest.Channels[name]
+		if !ok {
+			continue
+		}
+		if info == nil || strings.TrimSpace(info.Version) == "" {
+			return nil, fmt.Errorf("更新信息中 %s 通道没有 version", name)
+		}
+		info.Channel = name
+		candidates = append(candidates, info)
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("更新信息中没有 version")
+	}
+
+	var best *UpdateInfo
+	for _, c := range candidates {
+		if err := validateChannel(c.Channel); err != nil {
+			return nil, err
+		}
+		if channelAllows(channel, c.Channel) && (best == nil || versionGreater(c.Version, best.Version)) {
+			best = c
+		}
+	}
+	if best == nil {
+		return nil, nil
+	}
+	if best.Rollout != nil {
+		if err := best.Rollout.validate(best.ReleaseDate); err != nil {
+			return nil, fmt.Errorf("更新信息中版本 %s 的 %v", best.Version, err)
+		}
+	}
+
+	if err := selectPlatformAsset(best); err != nil {
+		return nil, err
+	}
+	best.ManifestRef = ref
+	best.manifest = data
+	return best, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// directorySource 从本地目录或网络共享（如 \\fileserver\releases）读取发布产物
+// 目录中有版本信息文件（默认 latest.json，格式同 UpdateInfo）时按版本号判断更新，
+// 否则按发布产物的修改时间和大小判断是否变化
+type directorySource struct {
+	dir      string
+	manifest string
+	asset    string
+	channel  string // 订阅的发布通道，只用于版本信息文件
+}
+
+// newDirectorySource 创建目录更新源
+func newDirectorySource(dir, manifest, asset, channel string) (*directorySource, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("没有配置发布目录")
+	}
+	return &directorySource{dir: dir, manifest: manifest, asset: asset, channel: channel}, nil
+}
+
+// Latest 读取版本信息，没有版本信息文件时根据发布产物生成 revision
+func (s *directorySource) Latest(ctx context.Context, installed InstalledRecord) (*UpdateInfo, error) {
+	if s.manifest != "" {
+		data, err := s.FetchMetadata(ctx, s.manifest)
+		if err != nil {
+			return nil, err
+		}
+		if data != nil {
+			info, err := parseManifest(data, s.manifest, s.channel)
+			if err != nil || info == nil {
+				return nil, err
+			}
+			if info.DownloadURL == "" {
+				info.DownloadURL = s.asset
+			}
+			return info, nil
+		}
+	}
+
+	fi, err := os.Stat(s.path(s.asset))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取发布产物失败: %v", err)
+	}
+	return &UpdateInfo{
+		DownloadURL: s.asset,
+		Size:        fi.Size(),
+		Revision:    fmt.Sprintf("%d-%d", fi.ModTime().Unix(), fi.Size()),
+	}, nil
+}
+
+// FetchArtifact 复制发布产物
+func (s *directorySource) FetchArtifact(ctx context.Context, ref, outputPath string, expect artifactExpectation) error {
+	f, err := os.Open(s.path(ref))
+	if err != nil {
+		return fmt.Errorf("打开发布产物失败: %v", err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("读取发布产物失败: %v", err)
+	}
+	return saveArtifact(&contextReader{ctx: ctx, r: f}, fi.Size(), outputPath, expect)
+}
+
+// FetchMetadata 读取校验和、签名等小文件
+func (s *directorySource) FetchMetadata(ctx context.Context, ref string) ([]byte, error) {
+	f, err := os.Open(s.path(ref))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(io.LimitReader(f, metadataSizeLimit))
+}
+
+// String 返回更新源描述
+func (s *directorySource) String() string {
+	return "directory " + s.dir
+}
+
+// path 返回引用对应的文件路径，相对路径基于发布目录
+func (s *directorySource) path(ref string) string {
+	p := filepath.FromSlash(ref)
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(s.dir, p)
+}
+
+// contextReader 在 context 取消后停止读取，避免网络共享上的大文件复制无法中断
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
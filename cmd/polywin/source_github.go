@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// githubDownloadSource 通过 GitHub Releases 下载地址检查和下载更新
+// 不依赖 GitHub API，避免 403 频率限制问题：releases/latest/download 会重定向到
+// /releases/download/<tag>/，从最终地址中取得 release tag
+type githubDownloadSource struct {
+	owner  string
+	repo   string
+	branch string // raw.githubusercontent.com 备用地址使用的分支
+	asset  string
+
+	downloader *Downloader
+}
+
+// githubRepoPattern 匹配 https://github.com/owner/repo(.git) 和 git@github.com:owner/repo(.git)
+var githubRepoPattern = regexp.MustCompile(`^(?:https?://github\.com/|git@github\.com:)([^/]+)/([^/]+?)(?:\.git)?/?$`)
+
+// releaseTagPattern 匹配 GitHub release 下载地址中的 tag
+var releaseTagPattern = regexp.MustCompile(`/releases/download/([^/]+)/`)
+
+// releasePagePattern 匹配 GitHub release 页面地址中的 tag
+var releasePagePattern = regexp.MustCompile(`/releases/tag/([^/]+)$`)
+
+// parseGitHubRepo 从仓库地址中解析 owner 和 repo
+func parseGitHubRepo(repoURL string) (string, string, error) {
+	m := githubRepoPattern.FindStringSubmatch(strings.TrimSpace(repoURL))
+	if m == nil {
+		return "", "", fmt.Errorf("不是 GitHub 仓库地址: %s", repoURL)
+	}
+	return m[1], m[2], nil
+}
+
+// newGitHubDownloadSource 创建 GitHub Releases 更新源
+func newGitHubDownloadSource(repoURL, asset string, downloader *Downloader) (*githubDownloadSource, error) {
+	owner, repo, err := parseGitHubRepo(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	if downloader == nil {
+		downloader = NewDownloader()
+	}
+	return &githubDownloadSource{owner: owner, repo: repo, branch: "main", asset: asset, downloader: downloader}, nil
+}
+
+// Latest 通过 HEAD 请求最新 release 的下载地址判断版本
+// 优先使用 release tag，取不到 tag 时使用 ETag / Last-Modified
+func (s *githubDownloadSource) Latest(ctx context.Context, installed InstalledRecord) (*UpdateInfo, error) {
+	// 创建带超时的 HTTP 客户端（10秒超时，只检查 HEAD 请求）
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "HEAD", s.latestURL(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建下载检查请求失败: %v", err)
+	}
+	req.Header.Set("User-Agent", "PolyWin-Updater/1.0")
+	if strings.HasPrefix(installed.Revision, "\"") || strings.HasPrefix(installed.Revision, "W/") {
+		req.Header.Set("If-None-Match", installed.Revision)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("检查下载链接失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// 304 说明文件没有变化；404 说明还没有发布，或者最新 release 中没有当前平台的发布产物
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, nil
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		if tag := s.latestTag(ctx, client); tag != "" {
+			return nil, fmt.Errorf("release %s 中没有 %s（当前平台 %s）", tag, s.asset, platformKey())
+		}
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("检查下载链接返回错误状态码: %d", resp.StatusCode)
+	}
+
+	latest := releaseRecord(resp)
+	if latest.Version == "" && latest.Revision == "" {
+		return nil, fmt.Errorf("无法确定最新版本（没有 release tag、ETag 或 Last-Modified）")
+	}
+
+	info := &UpdateInfo{Version: latest.Version, Revision: latest.Revision, DownloadURL: s.latestURL()}
+	if latest.Version != "" {
+		// 固定到具体 tag，避免检查和下载之间发布了新版本
+		info.DownloadURL = s.releaseURL(latest.Version)
+	}
+	return info, nil
+}
+
+// FetchArtifact 下载发布产物，release 下载失败时尝试仓库中 releases 目录的备用地址
+func (s *githubDownloadSource) FetchArtifact(ctx context.Context, ref, outputPath string, expect artifactExpectation) error {
+	err := s.downloader.Download(ctx, ref, outputPath, expect, nil)
+	if err == nil {
+		return nil
+	}
+	// 完整性校验失败直接终止，不再尝试备用地址；备用地址只有发布产物本身，没有补丁等其他文件
+	if _, ok := err.(*integrityError); ok || ctx.Err() != nil || artifactName(ref) != s.asset {
+		return err
+	}
+
+	log.Printf("从 GitHub Releases 下载失败: %v，尝试备用地址 %s", err, s.rawURL())
+	return s.downloader.Download(ctx, s.rawURL(), outputPath, expect, nil)
+}
+
+// FetchMetadata 下载校验和、签名等小文件
+func (s *githubDownloadSource) FetchMetadata(ctx context.Context, ref string) ([]byte, error) {
+	return fetchSmall(ctx, ref)
+}
+
+// String 返回更新源描述
+func (s *githubDownloadSource) String() string {
+	return fmt.Sprintf("GitHub Releases %s/%s", s.owner, s.repo)
+}
+
+// latestTag 返回最新 release 的 tag，没有发布或无法访问时返回空字符串
+// releases/latest 重定向到 releases/tag/<tag>，没有发布时重定向到 releases 列表
+func (s *githubDownloadSource) latestTag(ctx context.Context, client *http.Client) string {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", fmt.Sprintf("https://github.com/%s/%s/releases/latest", s.owner, s.repo), nil)
+	if err != nil {
+		return ""
+	}
+	req.Header.Set("User-Agent", "PolyWin-Updater/1.0")
+	resp, err := client.Do(req)
+	if err != nil {
+		return ""
+	}
+	resp.Body.Close()
+	if m := releasePagePattern.FindStringSubmatch(resp.Request.URL.Path); m != nil {
+		if tag, err := url.PathUnescape(m[1]); err == nil {
+			return tag
+		}
+	}
+	return ""
+}
+
+// latestURL 最新 release 的下载地址
+func (s *githubDownloadSource) latestURL() string {
+	return fmt.Sprintf("https://github.com/%s/%s/releases/latest/download/%s", s.owner, s.repo, url.PathEscape(s.asset))
+}
+
+// releaseURL 指定 release 的下载地址
+func (s *githubDownloadSource) releaseURL(tag string) string {
+	return fmt.Sprintf("https://github.com/%s/%s/releases/download/%s/%s", s.owner, s.repo, url.PathEscape(tag), url.PathEscape(s.asset))
+}
+
+// rawURL 仓库 releases 目录中的备用地址
+func (s *githubDownloadSource) rawURL() string {
+	return fmt.Sprintf("https://raw.githubusercontent.com/%s/%s/%s/releases/%s", s.owner, s.repo, s.branch, url.PathEscape(s.asset))
+}
+
+// releaseRecord 根据下载响应生成版本记录
+// 从重定向后的最终地址中取得 release tag，同时记录 ETag（没有时用 Last-Modified）
+func releaseRecord(resp *http.Response) InstalledRecord {
+	var record InstalledRecord
+	if resp.Request != nil && resp.Request.URL != nil {
+		if m := releaseTagPattern.FindStringSubmatch(resp.Request.URL.Path); m != nil {
+			if tag, err := url.PathUnescape(m[1]); err == nil {
+				record.Version = tag
+			}
+		}
+	}
+	record.Revision = resp.Header.Get("ETag")
+	if record.Revision == "" {
+		record.Revision = resp.Header.Get("Last-Modified")
+	}
+	return record
+}
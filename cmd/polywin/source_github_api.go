@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultGitHubAPIURL GitHub REST API 地址
+const defaultGitHubAPIURL = "https://api.github.com"
+
+// maxRateLimitWait 频率限制等待时间不超过该值时原地等待后重试，否则跳过检查直到限制解除
+const maxRateLimitWait = time.Minute
+
+// githubReleaseSource 通过 GitHub Releases API 检查和下载更新
+// stable 通道使用 releases/latest，beta / canary 通道或配置了版本约束时从最近的 release 列表中选择；
+// 使用 If-None-Match 条件请求（304 不计入频率限制），支持访问私有仓库的令牌，
+// 按名称模式选择发布产物，并遵守 Retry-After / X-RateLimit-Reset
+type githubReleaseSource struct {
+	apiURL  string
+	owner   string
+	repo    string
+	token   string
+	pattern string // 发布产物名称模式（path.Match 语法）
+	channel string // 订阅的发布通道
+	client  *http.Client
+
+	constraint *VersionConstraint // 版本约束，非空时从 release 列表中选择满足约束的最高版本
+
+	downloader *Downloader
+
+	mu       sync.Mutex
+	etag     string                 // 最近一次响应的 ETag
+	releases []githubRelease        // 最近一次获取的 release
+	assets   map[string]githubAsset // 最近一次获取的 release 中的产物，按下载地址索引
+	retryAt  time.Time              // 频率限制解除时间
+}
+
+// githubRelease GitHub API 返回的 release
+type githubRelease struct {
+	TagName     string        `json:"tag_name"`
+	Name        string        `json:"name"`
+	Body        string        `json:"body"`
+	Draft       bool          `json:"draft"`
+	Prerelease  bool          `json:"prerelease"`
+	PublishedAt string        `json:"published_at"`
+	Assets      []githubAsset `json:"assets"`
+}
+
+// githubAsset release 中的发布产物
+type githubAsset struct {
+	Name               string `json:"name"`
+	URL                string `json:"url"` // API 地址，配合 Accept: application/octet-stream 下载（私有仓库需要）
+	BrowserDownloadURL string `json:"browser_download_url"`
+	Size               int64  `json:"size"`
+	Digest             string `json:"digest"` // 如 sha256:<hex>，旧的 release 没有
+}
+
+// rateLimitError 触发 GitHub 频率限制
+type rateLimitError struct {
+	until time.Time
+}
+
+func (e *rateLimitError) Error() string {
+	return fmt.Sprintf("触发 GitHub API 频率限制，%s 后重试", e.until.Format("15:04:05"))
+}
+
+// newGitHubReleaseSource 创建 GitHub Releases API 更新源
+// apiURL 为空时使用 api.github.com，client 为空时使用默认客户端（测试时可替换为 httptest 的地址和客户端），
+// downloader 为空时使用 client 创建默认下载器
+func newGitHubReleaseSource(apiURL, repoURL, token, pattern, channel string, constraint *VersionConstraint, client *http.Client, downloader *Downloader) (*githubReleaseSource, error) {
+	owner, repo, err := parseGitHubRepo(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	if apiURL == "" {
+		apiURL = defaultGitHubAPIURL
+	}
+	if err := validateHTTPURL(apiURL); err != nil {
+		return nil, fmt.Errorf("API 地址无效: %v", err)
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("发布产物名称模式无效: %v", err)
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 60 * time.Second}
+	}
+	if downloader == nil {
+		downloader = NewDownloader()
+		downloader.Client = client
+	}
+	return &githubReleaseSource{
+		apiURL:     strings.TrimRight(apiURL, "/"),
+		owner:      owner,
+		repo:       repo,
+		token:      strings.TrimSpace(token),
+		pattern:    pattern,
+		channel:    channel,
+		client:     client,
+		constraint: constraint,
+		downloader: downloader,
+	}, nil
+}
+
+// githubReleaseListSize beta / canary 通道或配置了版本约束时检查的最近 release 数量
+const githubReleaseListSize = 20
+
+// Latest 获取订阅通道的最新 release，没有变化时使用缓存的结果
+func (s *githubReleaseSource) Latest(ctx context.Context, installed InstalledRecord) (*UpdateInfo, error) {
+	s.mu.Lock()
+	retryAt, etag := s.retryAt, s.etag
+	s.mu.Unlock()
+	if time.Now().Before(retryAt) {
+		return nil, &rateLimitError{until: retryAt}
+	}
+
+	url := fmt.Sprintf("%s/repos/%s/%s/releases/latest", s.apiURL, s.owner, s.repo)
+	if s.listReleases() {
+		// releases/latest 不包括预发布版本，也不能按版本约束选择
+		url = fmt.Sprintf("%s/repos/%s/%s/releases?per_page=%d", s.apiURL, s.owner, s.repo, githubReleaseListSize)
+	}
+	resp, err := s.do(ctx, url, "application/vnd.github+json", etag)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		s.mu.Lock()
+		releases := s.releases
+		s.mu.Unlock()
+		if releases == nil {
+			return nil, fmt.Errorf("GitHub 返回 304，但没有缓存的 release")
+		}
+		return s.updateInfo(releases)
+	case http.StatusNotFound:
+		// 没有发布，或令牌无权访问私有仓库
+		return nil, nil
+	case http.StatusOK:
+	default:
+		return nil, fmt.Errorf("GitHub API 返回错误状态码: %d", resp.StatusCode)
+	}
+
+	body := io.LimitReader(resp.Body, metadataSizeLimit)
+	releases := []githubRelease{{}}
+	if !s.listReleases() {
+		err = json.NewDecoder(body).Decode(&releases[0])
+	} else {
+		err = json.NewDecoder(body).Decode(&releases)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析 release 失败: %v", err)
+	}
+
+	assets := make(map[string]githubAsset)
+	for _, release := range releases {
+		for _, a := range release.Assets {
+			assets[a.BrowserDownloadURL] = a
+		}
+	}
+	s.mu.Lock()
+	s.etag = resp.Header.Get("ETag")
+	s.releases = releases
+	s.assets = assets
+	s.mu.Unlock()
+
+	return s.updateInfo(releases)
+}
+
+// listReleases 是否需要获取 release 列表，而不是只获取 releases/latest
+func (s *githubReleaseSource) listReleases() bool {
+	return s.channel != ChannelStable || s.constraint != nil
+}
+
+// releaseChannel 返回 release 所属的通道：按 tag 判断，标记为预发布的正式版本号归入 beta
+func releaseChannel(release *githubRelease) string {
+	channel := versionChannel(release.TagName)
+	if release.Prerelease && channel == ChannelStable {
+		return ChannelBeta
+	}
+	return channel
+}
+
+// updateInfo 选择订阅通道可以接收、满足版本约束的最高版本 release，从中选择发布产物生成更新信息
+func (s *githubReleaseSource) updateInfo(releases []githubRelease) (*UpdateInfo, error) {
+	var release *githubRelease
+	for i := range releases {
+		r := &releases[i]
+		if r.Draft || !channelAllows(s.channel, releaseChannel(r)) || !s.constraint.Check(r.TagName) {
+			continue
+		}
+		// 列表按发布时间从新到旧排列，无法按版本号比较时保留较新的 release
+		if release == nil || versionGreater(r.TagName, release.TagName) {
+			release = r
+		}
+	}
+	if release == nil {
+		return nil, nil
+	}
+
+	for _, a := range release.Assets {
+		if ok, _ := path.Match(s.pattern, a.Name); !ok {
+			continue
+		}
+		info := &UpdateInfo{
+			Version:      release.TagName,
+			DownloadURL:  a.BrowserDownloadURL,
+			Size:         a.Size,
+			ReleaseDate:  release.PublishedAt,
+			ReleaseNotes: release.Body,
+			Channel:      releaseChannel(release),
+		}
+		if c, err := ParseChecksum(a.Digest); err == nil && c != nil {
+			info.Checksum = c.String()
+		}
+		return info, nil
+	}
+	return nil, fmt.Errorf("release %s 中没有与 %s 匹配的发布产物（当前平台 %s）", release.TagName, s.pattern, platformKey())
+}
+
+// FetchArtifact 下载发布产物：配置了令牌时通过 API 地址下载（支持私有仓库），否则使用公开下载地址
+func (s *githubReleaseSource) FetchArtifact(ctx context.Context, ref, outputPath string, expect artifactExpectation) error {
+	s.mu.Lock()
+	asset, ok := s.assets[ref]
+	s.mu.Unlock()
+	if !ok || s.token == "" || asset.URL == "" {
+		return s.downloader.Download(ctx, ref, outputPath, expect, nil)
+	}
+
+	// 令牌只发送给 API 地址，重定向到存储地址时 http.Client 会去掉 Authorization
+	return s.downloader.Download(ctx, asset.URL, outputPath, expect, func(req *http.Request) {
+		req.Header.Set("Accept", "application/octet-stream")
+		req.Header.Set("Authorization", "Bearer "+s.token)
+		req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	})
+}
+
+// FetchMetadata 下载 release 中的校验和、签名等小文件，release 中没有该文件时返回 nil
+func (s *githubReleaseSource) FetchMetadata(ctx context.Context, ref string) ([]byte, error) {
+	s.mu.Lock()
+	_, ok := s.assets[ref]
+	s.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+
+	resp, err := s.fetchAsset(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP 状态码: %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, metadataSizeLimit))
+}
+
+// String 返回更新源描述
+func (s *githubReleaseSource) String() string {
+	return fmt.Sprintf("GitHub Releases API %s/%s", s.owner, s.repo)
+}
+
+// fetchAsset 下载 release 中的文件：配置了令牌时通过 API 地址下载（支持私有仓库），否则使用公开下载地址
+func (s *githubReleaseSource) fetchAsset(ctx context.Context, ref string) (*http.Response, error) {
+	s.mu.Lock()
+	asset, ok := s.assets[ref]
+	s.mu.Unlock()
+	if ok && s.token != "" && asset.URL != "" {
+		return s.do(ctx, asset.URL, "application/octet-stream", "")
+	}
+	return s.do(ctx, ref, "", "")
+}
+
+// do 发送 GET 请求，遇到频率限制时在等待时间较短的情况下等待后重试一次
+func (s *githubReleaseSource) do(ctx context.Context, url, accept, etag string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("创建请求失败: %v", err)
+		}
+		req.Header.Set("User-Agent", "PolyWin-Updater/1.0")
+		req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		// 只向 API 地址发送令牌，下载重定向到的存储地址不需要
+		if s.token != "" && strings.HasPrefix(url, s.apiURL+"/") {
+			req.Header.Set("Authorization", "Bearer "+s.token)
+		}
+
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("请求失败: %v", err)
+		}
+
+		until, limited := rateLimitUntil(resp, time.Now())
+		if !limited {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		wait := time.Until(until)
+		if attempt > 0 || wait > maxRateLimitWait {
+			s.mu.Lock()
+			s.retryAt = until
+			s.mu.Unlock()
+			return nil, &rateLimitError{until: until}
+		}
+
+		log.Printf("触发 GitHub API 频率限制，等待 %v 后重试", wait.Round(time.Second))
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// rateLimitUntil 判断响应是否为频率限制，返回限制解除时间
+// 优先使用 Retry-After（秒数或 HTTP 日期），其次使用 X-RateLimit-Reset（Unix 时间戳）
+func rateLimitUntil(resp *http.Response, now time.Time) (time.Time, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return time.Time{}, false
+	}
+
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil {
+			return now.Add(time.Duration(secs) * time.Second), true
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			return t, true
+		}
+	}
+
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			return time.Unix(reset, 0), true
+		}
+	}
+
+	// 没有提示的 429 按次级频率限制处理，至少等待一分钟
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return now.Add(time.Minute), true
+	}
+	return time.Time{}, false
+}
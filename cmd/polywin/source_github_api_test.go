@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testRelease 返回包含多个平台产物的 release，产物下载地址指向 storage
+func testRelease(tag, api, storage string) githubRelease {
+	var assets []githubAsset
+	for i, name := range []string{
+		"server.exe",
+		"server_linux_amd64",
+		"server_linux_arm64",
+		"server_windows_amd64.exe",
+		"server_windows_arm64.exe",
+		"server_1.2.0_darwin_arm64.tar.gz",
+		"SHA256SUMS",
+	} {
+		assets = append(assets, githubAsset{
+			Name:               name,
+			URL:                api + "/repos/acme/server/releases/assets/" + strconv.Itoa(i+1),
+			BrowserDownloadURL: storage + "/acme/server/releases/download/" + tag + "/" + name,
+			Size:               int64(len(name)),
+			Digest:             "sha256:" + strings.Repeat("ab", 32),
+		})
+	}
+	return githubRelease{TagName: tag, PublishedAt: "2024-05-01T10:00:00Z", Assets: assets}
+}
+
+// newTestGitHubSource 创建指向测试服务器的 GitHub Releases API 更新源
+func newTestGitHubSource(t *testing.T, apiURL, token, pattern string) *githubReleaseSource {
+	t.Helper()
+	s, err := newGitHubReleaseSource(apiURL, "https://github.com/acme/server", token, pattern, ChannelStable, nil, &http.Client{Timeout: 10 * time.Second}, nil)
+	if err != nil {
+		t.Fatalf("newGitHubReleaseSource: %v", err)
+	}
+	s.downloader.Retries = 0
+	return s
+}
+
+func TestGitHubReleaseSourceETag(t *testing.T) {
+	var mu sync.Mutex
+	var requests, notModified int
+	var api *httptest.Server
+	api = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/acme/server/releases/latest" {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		if r.Header.Get("If-None-Match") == `"r1"` {
+			mu.Lock()
+			notModified++
+			mu.Unlock()
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"r1"`)
+		json.NewEncoder(w).Encode(testRelease("v1.2.0", api.URL, "https://github.com"))
+	}))
+	defer api.Close()
+
+	s := newTestGitHubSource(t, api.URL, "", "server_linux_amd64")
+	for i := 0; i < 3; i++ {
+		info, err := s.Latest(context.Background(), InstalledRecord{})
+		if err != nil {
+			t.Fatalf("第 %d 次检查: %v", i+1, err)
+		}
+		if info == nil || info.Version != "v1.2.0" || !strings.HasSuffix(info.DownloadURL, "/server_linux_amd64") {
+			t.Fatalf("第 %d 次检查返回 %+v", i+1, info)
+		}
+	}
+	if requests != 3 || notModified != 2 {
+		t.Errorf("请求 %d 次，其中 304 %d 次，期望 3 次和 2 次", requests, notModified)
+	}
+}
+
+func TestGitHubReleaseSourceNotModifiedWithoutCache(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer api.Close()
+
+	s := newTestGitHubSource(t, api.URL, "", "*")
+	if _, err := s.Latest(context.Background(), InstalledRecord{}); err == nil {
+		t.Fatal("没有缓存时收到 304 应返回错误")
+	}
+}
+
+func TestRateLimitUntil(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		status  int
+		header  map[string]string
+		until   time.Time
+		limited bool
+	}{
+		{"正常响应", 200, nil, time.Time{}, false},
+		{"没有提示的 403", 403, nil, time.Time{}, false},
+		{"Retry-After 秒数", 403, map[string]string{"Retry-After": "30"}, now.Add(30 * time.Second), true},
+		{"Retry-After HTTP 日期", 429, map[string]string{"Retry-After": "Wed, 01 May 2024 10:05:00 GMT"}, now.Add(5 * time.Minute), true},
+		{"X-RateLimit-Reset", 403, map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "1714557900"}, time.Unix(1714557900, 0), true},
+		{"还有剩余次数时忽略 X-RateLimit-Reset", 403, map[string]string{"X-RateLimit-Remaining": "10", "X-RateLimit-Reset": "1714557900"}, time.Time{}, false},
+		{"Retry-After 优先", 403, map[string]string{"Retry-After": "5", "X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "1714557900"}, now.Add(5 * time.Second), true},
+		{"没有提示的 429", 429, nil, now.Add(time.Minute), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			for k, v := range tt.header {
+				resp.Header.Set(k, v)
+			}
+			until, limited := rateLimitUntil(resp, now)
+			if limited != tt.limited || !until.Equal(tt.until) {
+				t.Errorf("rateLimitUntil = %v, %v，期望 %v, %v", until, limited, tt.until, tt.limited)
+			}
+		})
+	}
+}
+
+func TestGitHubReleaseSourceRateLimit(t *testing.T) {
+	var mu sync.Mutex
+	var requests int
+	reset := time.Now().Add(time.Hour).Unix()
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer api.Close()
+
+	s := newTestGitHubSource(t, api.URL, "", "*")
+	for i := 0; i < 2; i++ {
+		_, err := s.Latest(context.Background(), InstalledRecord{})
+		var limited *rateLimitError
+		if !errors.As(err, &limited) {
+			t.Fatalf("第 %d 次检查返回 %v，期望频率限制错误", i+1, err)
+		}
+		if limited.until.Unix() != reset {
+			t.Errorf("限制解除时间 %v，期望 %v", limited.until, time.Unix(reset, 0))
+		}
+	}
+	// 等待时间超过 maxRateLimitWait 时不重试，解除前也不再请求
+	if requests != 1 {
+		t.Errorf("请求 %d 次，期望 1 次", requests)
+	}
+}
+
+func TestGitHubReleaseSourceRetryAfter(t *testing.T) {
+	var mu sync.Mutex
+	var requests int
+	var api *httptest.Server
+	api = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		first := requests == 1
+		mu.Unlock()
+		if first {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		json.NewEncoder(w).Encode(testRelease("v1.2.0", api.URL, "https://github.com"))
+	}))
+	defer api.Close()
+
+	// 等待时间较短时原地等待后重试一次
+	s := newTestGitHubSource(t, api.URL, "", "server.exe")
+	info, err := s.Latest(context.Background(), InstalledRecord{})
+	if err != nil || info == nil || info.Version != "v1.2.0" {
+		t.Fatalf("Latest = %+v, %v", info, err)
+	}
+	if requests != 2 {
+		t.Errorf("请求 %d 次，期望 2 次", requests)
+	}
+}
+
+func TestGitHubReleaseSourceAssetSelection(t *testing.T) {
+	release := testRelease("v1.2.0", "https://api.github.com", "https://github.com")
+	tests := []struct {
+		name    string
+		pattern string
+		want    string // 为空表示没有匹配的产物
+	}{
+		{"当前平台默认模板", assetName("", "server.exe"), assetName("", "server.exe")},
+		{"linux/amd64", "server_linux_amd64", "server_linux_amd64"},
+		{"linux/arm64", "server_linux_arm64", "server_linux_arm64"},
+		{"windows/amd64", "server_windows_amd64.exe", "server_windows_amd64.exe"},
+		{"windows/arm64", "server_windows_arm64.exe", "server_windows_arm64.exe"},
+		{"darwin/arm64 通配", "server_*_darwin_arm64.tar.gz", "server_1.2.0_darwin_arm64.tar.gz"},
+		{"没有该平台", "server_freebsd_amd64", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &githubReleaseSource{pattern: tt.pattern, channel: ChannelStable}
+			info, err := s.updateInfo([]githubRelease{release})
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("期望没有匹配的产物，实际选择了 %s", info.DownloadURL)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("updateInfo: %v", err)
+			}
+			if !strings.HasSuffix(info.DownloadURL, "/"+tt.want) {
+				t.Errorf("选择了 %s，期望 %s", info.DownloadURL, tt.want)
+			}
+			if info.Size != int64(len(tt.want)) || info.Checksum != "sha256:"+strings.Repeat("ab", 32) {
+				t.Errorf("大小或校验和不是来自选择的产物: %d %s", info.Size, info.Checksum)
+			}
+		})
+	}
+}
+
+func TestGitHubReleaseSourceTokenOnlyToAPI(t *testing.T) {
+	const token = "ghp_secret"
+	var mu sync.Mutex
+	var leaked []string
+
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			mu.Lock()
+			leaked = append(leaked, r.URL.Path)
+			mu.Unlock()
+		}
+		w.Write([]byte("binary"))
+	}))
+	defer storage.Close()
+	// 存储地址使用不同的主机名，http.Client 只在同一主机的重定向中保留 Authorization
+	storageURL := strings.Replace(storage.URL, "127.0.0.1", "localhost", 1)
+
+	var api *httptest.Server
+	api = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			t.Errorf("API 请求 %s 没有携带令牌", r.URL.Path)
+		}
+		switch {
+		case r.URL.Path == "/repos/acme/server/releases/latest":
+			json.NewEncoder(w).Encode(testRelease("v1.2.0", api.URL, storageURL))
+		case strings.HasPrefix(r.URL.Path, "/repos/acme/server/releases/assets/"):
+			if r.Header.Get("Accept") != "application/octet-stream" {
+				t.Errorf("下载产物时 Accept 为 %q", r.Header.Get("Accept"))
+			}
+			http.Redirect(w, r, storageURL+"/blob"+r.URL.Path, http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer api.Close()
+
+	s := newTestGitHubSource(t, api.URL, token, "server_linux_amd64")
+	info, err := s.Latest(context.Background(), InstalledRecord{})
+	if err != nil || info == nil {
+		t.Fatalf("Latest = %+v, %v", info, err)
+	}
+
+	out := filepath.Join(t.TempDir(), "server")
+	if err := s.FetchArtifact(context.Background(), info.DownloadURL, out, artifactExpectation{}); err != nil {
+		t.Fatalf("FetchArtifact: %v", err)
+	}
+	if data, _ := os.ReadFile(out); string(data) != "binary" {
+		t.Errorf("下载内容为 %q", data)
+	}
+	sums := strings.TrimSuffix(info.DownloadURL, "server_linux_amd64") + "SHA256SUMS"
+	if _, err := s.FetchMetadata(context.Background(), sums); err != nil {
+		t.Fatalf("FetchMetadata: %v", err)
+	}
+	if len(leaked) > 0 {
+		t.Errorf("令牌被发送到存储地址: %v", leaked)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// manifestSource 从 HTTPS 地址读取 JSON 格式的版本信息（UpdateInfo）
+// download_url、signature_url、补丁地址可以是相对版本信息地址的路径，
+// 没有 download_url 时使用版本信息所在目录下与 asset 同名的文件
+type manifestSource struct {
+	url        string
+	asset      string
+	channel    string // 订阅的发布通道
+	downloader *Downloader
+}
+
+// newManifestSource 创建 HTTPS 版本信息更新源
+func newManifestSource(manifestURL, asset, channel string, downloader *Downloader) (*manifestSource, error) {
+	if err := validateHTTPURL(manifestURL); err != nil {
+		return nil, err
+	}
+	if downloader == nil {
+		downloader = NewDownloader()
+	}
+	return &manifestSource{url: manifestURL, asset: asset, channel: channel, downloader: downloader}, nil
+}
+
+// Latest 读取版本信息
+func (s *manifestSource) Latest(ctx context.Context, installed InstalledRecord) (*UpdateInfo, error) {
+	data, err := fetchSmall(ctx, s.url)
+	if err != nil {
+		return nil, fmt.Errorf("获取更新信息失败: %v", err)
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	info, err := parseManifest(data, s.url, s.channel)
+	if err != nil || info == nil {
+		return nil, err
+	}
+	if info.DownloadURL == "" {
+		info.DownloadURL = s.asset
+	}
+	if info.DownloadURL, err = s.resolve(info.DownloadURL); err != nil {
+		return nil, fmt.Errorf("download_url 无效: %v", err)
+	}
+	if info.SignatureURL != "" {
+		if info.SignatureURL, err = s.resolve(info.SignatureURL); err != nil {
+			return nil, fmt.Errorf("signature_url 无效: %v", err)
+		}
+	}
+	for i := range info.Patches {
+		if info.Patches[i].URL, err = s.resolve(info.Patches[i].URL); err != nil {
+			return nil, fmt.Errorf("patches[%d].url 无效: %v", i, err)
+		}
+	}
+	return info, nil
+}
+
+// FetchArtifact 下载发布产物
+func (s *manifestSource) FetchArtifact(ctx context.Context, ref, outputPath string, expect artifactExpectation) error {
+	return s.downloader.Download(ctx, ref, outputPath, expect, nil)
+}
+
+// FetchMetadata 下载校验和、签名等小文件
+func (s *manifestSource) FetchMetadata(ctx context.Context, ref string) ([]byte, error) {
+	return fetchSmall(ctx, ref)
+}
+
+// String 返回更新源描述
+func (s *manifestSource) String() string {
+	return "manifest " + s.url
+}
+
+// resolve 将相对路径解析为基于版本信息地址的完整 URL
+func (s *manifestSource) resolve(ref string) (string, error) {
+	base, err := url.Parse(s.url)
+	if err != nil {
+		return "", err
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	resolved := base.ResolveReference(r)
+	if resolved.Scheme != "http" && resolved.Scheme != "https" {
+		return "", fmt.Errorf("仅支持 http/https 地址: %s", ref)
+	}
+	return resolved.String(), nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// stateFileName 更新器状态文件名（与目标程序位于同一目录）
+const stateFileName = "polywin.state.json"
+
+// UpdaterState 需要跨守护程序重启保留的更新器状态
+type UpdaterState struct {
+	Installed InstalledRecord `json:"installed"`            // 当前安装的目标程序版本
+	Blacklist []string        `json:"blacklist,omitempty"`  // 回滚过的版本，不再安装
+	MachineID string          `json:"machine_id,omitempty"` // 随机生成的机器 ID，用于计算分阶段发布的分组
+	Hold      *UpdateHold     `json:"hold,omitempty"`       // 暂停更新，通过控制接口设置和解除
+	Expired   string          `json:"expired,omitempty"`    // 等待批准超时的版本，出现更新的版本前不再下载
+
+	Transaction *UpdateTransaction `json:"transaction,omitempty"` // 最近一次更新事务
+}
+
+// UpdateHold 暂停更新记录
+type UpdateHold struct {
+	Reason string    `json:"reason,omitempty"`
+	Since  time.Time `json:"since"`
+}
+
+// String 返回暂停原因和时间
+func (h *UpdateHold) String() string {
+	s := "自 " + h.Since.Format("2006-01-02 15:04:05")
+	if h.Reason != "" {
+		s += "，原因: " + h.Reason
+	}
+	return s
+}
+
+// InstalledRecord 已安装版本记录
+type InstalledRecord struct {
+	Version     string    `json:"version,omitempty"`      // 发布版本（release tag 或更新信息中的版本）
+	Revision    string    `json:"revision,omitempty"`     // 下载地址的 ETag / Last-Modified，没有版本号时用于判断变化
+	InstalledAt time.Time `json:"installed_at,omitempty"` // 安装时间
+	Source      string    `json:"source,omitempty"`       // 记录来源：update / bootstrap / buildinfo / info
+	Commit      string    `json:"commit,omitempty"`       // 构建目标程序的 VCS 提交（来自 Go 构建信息）
+	Channel     string    `json:"channel,omitempty"`      // 安装时版本所属的发布通道
+	Checksum    string    `json:"checksum,omitempty"`     // 文件的 sha256，对应版本库中的条目
+}
+
+// String 返回版本描述
+func (r InstalledRecord) String() string {
+	switch {
+	case r.Version != "":
+		return r.Version
+	case r.Revision != "":
+		return "revision " + r.Revision
+	}
+	return "未知"
+}
+
+// ID 返回版本标识：有版本号时为版本号，否则为 revision
+func (r InstalledRecord) ID() string {
+	if r.Version != "" {
+		return r.Version
+	}
+	return r.Revision
+}
+
+// loadState 读取状态文件，文件不存在时返回空状态
+func loadState(path string) (*UpdaterState, error) {
+	state := &UpdaterState{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("读取状态文件失败: %v", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return &UpdaterState{}, fmt.Errorf("解析状态文件失败: %v", err)
+	}
+	return state, nil
+}
+
+// save 写入状态文件（先写临时文件并刷新到磁盘再重命名，避免写入中断或断电导致文件损坏）
+func (s *UpdaterState) save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, data, 0644); err != nil {
+		return fmt.Errorf("保存状态文件失败: %v", err)
+	}
+	return nil
+}
+
+// isBlacklisted 版本是否已被加入黑名单（忽略 v 前缀，v1.2.0 与 1.2.0 视为同一版本）
+func (s *UpdaterState) isBlacklisted(version string) bool {
+	for _, v := range s.Blacklist {
+		if sameVersion(v, version) {
+			return true
+		}
+	}
+	return false
+}
+
+// addBlacklist 将版本加入黑名单
+func (s *UpdaterState) addBlacklist(version string) {
+	if version == "" || s.isBlacklisted(version) {
+		return
+	}
+	s.Blacklist = append(s.Blacklist, version)
+}
+
+// removeBlacklist 将版本移出黑名单
+func (s *UpdaterState) removeBlacklist(version string) {
+	kept := s.Blacklist[:0]
+	for _, v := range s.Blacklist {
+		if !sameVersion(v, version) {
+			kept = append(kept, v)
+		}
+	}
+	s.Blacklist = kept
+}
+
+// setExpired 记录等待批准超时的版本
+func (s *UpdaterState) setExpired(version string) {
+	s.Expired = version
+}
+
+// defaultStatePath 返回目标程序目录下的状态文件路径
+func defaultStatePath(targetPath string) string {
+	return filepath.Join(filepath.Dir(targetPath), stateFileName)
+}
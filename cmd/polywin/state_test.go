@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestFiles 在 dir 中写入文件（文件名 → 内容）
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readTestFiles 读取 dir 中除状态文件以外的全部文件
+func readTestFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, e := range entries {
+		if e.IsDir() || e.Name() == stateFileName {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[e.Name()] = string(data)
+	}
+	return files
+}
+
+// newTestUpdater 创建目标程序为 dir/server 的更新器，启动前已有的状态文件会被加载
+func newTestUpdater(t *testing.T, dir string, config *UpdaterConfig) *Updater {
+	t.Helper()
+	config.TargetPath = filepath.Join(dir, "server")
+	config.StatePath = filepath.Join(dir, stateFileName)
+	u := NewUpdater(config)
+	t.Cleanup(u.Stop)
+	return u
+}
+
+// saveTestState 写入状态文件，模拟守护程序中断时磁盘上的状态
+func saveTestState(t *testing.T, dir string, state *UpdaterState) {
+	t.Helper()
+	if err := state.save(filepath.Join(dir, stateFileName)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// loadTestState 读取磁盘上的状态文件
+func loadTestState(t *testing.T, dir string) *UpdaterState {
+	t.Helper()
+	state, err := loadState(filepath.Join(dir, stateFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+func TestBlacklist(t *testing.T) {
+	var s UpdaterState
+	s.addBlacklist("v1.2.0")
+	s.addBlacklist("1.2.0")
+	s.addBlacklist("")
+	if len(s.Blacklist) != 1 {
+		t.Fatalf("黑名单 = %v，同一版本只记录一次", s.Blacklist)
+	}
+	for _, v := range []string{"1.2.0", "v1.2.0", " v1.2.0 "} {
+		if !s.isBlacklisted(v) {
+			t.Errorf("%q 应在黑名单中", v)
+		}
+	}
+	if s.isBlacklisted("1.2.1") {
+		t.Error("1.2.1 不在黑名单中")
+	}
+	s.removeBlacklist("1.2.0")
+	if s.isBlacklisted("v1.2.0") {
+		t.Errorf("移出后黑名单 = %v", s.Blacklist)
+	}
+}
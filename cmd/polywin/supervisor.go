@@ -0,0 +1,647 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// RestartPolicy 目标程序退出后的重启策略
+type RestartPolicy string
+
+const (
+	RestartAlways    RestartPolicy = "always"     // 无论如何退出都重启
+	RestartOnFailure RestartPolicy = "on-failure" // 仅在异常退出时重启
+	RestartNever     RestartPolicy = "never"      // 从不重启
+)
+
+// TargetState 目标程序状态
+type TargetState string
+
+const (
+	StateStarting TargetState = "starting" // 正在启动
+	StateRunning  TargetState = "running"  // 运行中
+	StateBackoff  TargetState = "backoff"  // 等待重启
+	StateExited   TargetState = "exited"   // 已退出，按策略不再重启
+	StateFailed   TargetState = "failed"   // 崩溃循环，已停止重启
+	StateStopping TargetState = "stopping" // 正在停止
+	StateStopped  TargetState = "stopped"  // 已被守护程序停止
+)
+
+// errSupervisorStopping 守护程序正在关闭，不再启动目标程序
+var errSupervisorStopping = errors.New("守护程序正在关闭")
+
+// stopSignals 支持的停止信号（仅包含所有平台都定义的信号）
+var stopSignals = map[string]syscall.Signal{
+	"SIGTERM": syscall.SIGTERM,
+	"SIGINT":  syscall.SIGINT,
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGKILL": syscall.SIGKILL,
+}
+
+// parseStopSignal 解析停止信号名称，支持省略 SIG 前缀
+func parseStopSignal(name string) (syscall.Signal, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	sig, ok := stopSignals[name]
+	if !ok {
+		return 0, fmt.Errorf("不支持的停止信号: %s（可选: SIGTERM、SIGINT、SIGHUP、SIGQUIT、SIGKILL）", name)
+	}
+	return sig, nil
+}
+
+// SupervisorConfig 进程监督配置
+type SupervisorConfig struct {
+	TargetPath    string
+	RestartPolicy RestartPolicy
+	InitialDelay  time.Duration // 首次重启等待时间
+	MaxDelay      time.Duration // 指数退避上限
+	Multiplier    float64       // 退避倍数
+	Jitter        float64       // 随机抖动比例
+	MaxRestarts   int           // RestartWindow 内允许的最大重启次数，0 表示不限制
+	RestartWindow time.Duration // 崩溃循环检测窗口
+	HealthyUptime time.Duration // 运行超过该时间视为健康，重置退避
+	StopSignal    syscall.Signal
+	StopTimeout   time.Duration        // 发送停止信号后等待退出的时间，超时强制结束
+	HealthCheck   *HealthCheckSettings // 为 nil 时不做健康检查
+	Probation     ProbationSettings
+}
+
+// SupervisorStatus 目标程序运行状态快照
+type SupervisorStatus struct {
+	Target    string      `json:"target"`
+	State     TargetState `json:"state"`
+	PID       int         `json:"pid,omitempty"`
+	StartedAt *time.Time  `json:"started_at,omitempty"`
+	Restarts  int         `json:"restarts"`
+	LastExit  string      `json:"last_exit,omitempty"`
+	Health    HealthState `json:"health"`
+
+	Supervising bool `json:"supervising"` // 是否仍在监控目标程序；按重启策略不再重启或崩溃循环后为 false，直到守护程序重启
+}
+
+// Supervisor 负责启动、监控和重启目标程序
+type Supervisor struct {
+	config  *SupervisorConfig
+	updater *Updater
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    chan struct{} // Run 返回后关闭
+
+	mu        sync.Mutex
+	cmd       *exec.Cmd
+	exited    chan struct{} // 当前进程被回收后关闭
+	stopping  bool
+	state     TargetState
+	startedAt time.Time
+	failures  int         // 连续未达到健康运行时长的退出次数
+	restarts  []time.Time // 崩溃循环检测窗口内的重启时间
+	total     int         // 累计重启次数
+	lastExit  string
+	health    HealthState
+	unhealthy error // 因健康检查失败被停止时记录原因
+
+	rollbackReason string // 试运行检查失败的原因
+	updating       bool   // 为应用更新而停止目标程序，下次启动时替换文件
+}
+
+// NewSupervisor 创建进程监督器
+func NewSupervisor(config *SupervisorConfig, updater *Updater) *Supervisor {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Supervisor{
+		config:  config,
+		updater: updater,
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		state:   StateStopped,
+		health:  HealthState{Status: HealthUnknown},
+	}
+}
+
+// Run 启动目标程序并按重启策略监控，直到 Stop 被调用或不再重启
+func (s *Supervisor) Run() {
+	defer close(s.done)
+
+	if s.updater != nil {
+		go s.watchUpdates()
+	}
+
+	for {
+		var exitErr error
+		var uptime time.Duration
+
+		cmd, exited, err := s.start()
+		if err == errSupervisorStopping {
+			return
+		}
+		if err != nil {
+			log.Printf("启动服务器程序失败: %v", err)
+			exitErr = err
+			s.recordExit(exitErr)
+
+			// 新版本无法启动，直接回滚
+			if p := s.beginProbation(); p != nil {
+				if s.rollback(p, fmt.Sprintf("启动失败: %v", err)) {
+					continue
+				}
+			}
+		} else {
+			if s.config.HealthCheck != nil {
+				go s.watchHealth(cmd, exited)
+			}
+			probation := s.beginProbation()
+			if probation != nil {
+				if s.config.Probation.Window > 0 {
+					go s.watchProbation(cmd, exited, probation)
+				} else {
+					s.updater.commitProbation(probation)
+					probation = nil
+				}
+			}
+			exitErr = cmd.Wait()
+			uptime = time.Since(s.startedAtTime())
+			close(exited)
+
+			// 因健康检查失败被停止时，无论退出码如何都视为异常退出
+			if err := s.takeUnhealthy(); err != nil {
+				exitErr = err
+			}
+
+			if s.isStopping() {
+				s.recordExit(exitErr)
+				return
+			}
+
+			// 为应用更新而停止，替换文件后立即启动新版本，不计入重启次数
+			if s.isUpdating() {
+				log.Printf("服务器程序已停止（运行时长 %v），启动新版本", uptime.Round(time.Second))
+				s.recordExit(exitErr)
+				continue
+			}
+
+			if exitErr != nil {
+				log.Printf("服务器程序异常退出: %v（运行时长 %v）", exitErr, uptime.Round(time.Second))
+			} else {
+				log.Printf("服务器程序正常退出（运行时长 %v）", uptime.Round(time.Second))
+			}
+			s.recordExit(exitErr)
+
+			// 试运行期间退出或未通过试运行检查，回滚后立即启动旧版本
+			if s.updater != nil && s.updater.isProbation(probation) {
+				reason := s.takeRollbackReason()
+				if reason == "" {
+					reason = fmt.Sprintf("试运行期间退出: %s", s.Status().LastExit)
+				}
+				if s.rollback(probation, reason) {
+					continue
+				}
+			}
+		}
+
+		if s.isStopping() {
+			return
+		}
+
+		// 有可以应用的更新时，无论策略如何都需要重启以应用新版本
+		var restart bool
+		if s.updater != nil && s.updater.HasPendingUpdate() && s.updater.applyAllowed(time.Now()) {
+			restart = true
+		} else {
+			restart = s.shouldRestart(exitErr)
+		}
+
+		if !restart {
+			log.Printf("重启策略为 %s，不再重启服务器程序", s.config.RestartPolicy)
+			s.setState(StateExited)
+			s.noteUnsupervised()
+			return
+		}
+
+		delay, ok := s.nextDelay(uptime)
+		if !ok {
+			log.Printf("服务器程序在 %v 内重启超过 %d 次，判定为崩溃循环，停止重启", s.config.RestartWindow, s.config.MaxRestarts)
+			s.setState(StateFailed)
+			s.noteUnsupervised()
+			return
+		}
+
+		s.setState(StateBackoff)
+		log.Printf("等待 %v 后重启服务器程序...", delay.Round(time.Millisecond))
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// start 启动目标程序；守护程序正在关闭时返回 errSupervisorStopping
+func (s *Supervisor) start() (*exec.Cmd, chan struct{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 在锁内检查，保证 Stop 之后不会再启动新进程
+	if s.stopping {
+		return nil, nil, errSupervisorStopping
+	}
+
+	// 在锁内替换文件，watchUpdates 在新版本就绪后看到的要么是尚未启动（启动前替换），要么是正在运行的进程
+	// 为应用更新而重启时总是替换，其他原因的启动（如崩溃后重启）按应用策略决定
+	s.state = StateStarting
+	if s.updater != nil && s.updater.HasPendingUpdate() && (s.updating || s.updater.applyAllowed(time.Now())) {
+		if err := s.updater.applyPending(); err != nil {
+			log.Printf("应用更新失败，继续使用当前版本: %v", err)
+		}
+	}
+	s.updating = false
+
+	serverPath := s.config.TargetPath
+	log.Printf("启动服务器程序: %s", serverPath)
+
+	cmd := exec.Command(serverPath)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Dir = filepath.Dir(serverPath)
+	cmd.Env = os.Environ()
+
+	if err := cmd.Start(); err != nil {
+		return nil, nil, err
+	}
+
+	s.cmd = cmd
+	s.exited = make(chan struct{})
+	s.state = StateRunning
+	s.startedAt = time.Now()
+	s.unhealthy = nil
+	if s.config.HealthCheck != nil {
+		s.health = HealthState{Status: HealthStarting}
+	}
+
+	log.Printf("服务器程序已启动，PID: %d", cmd.Process.Pid)
+	return cmd, s.exited, nil
+}
+
+// Stop 停止监控并优雅停止目标程序：先发送停止信号，超时后强制结束，
+// 返回时目标程序已确认退出且不会再被重启
+func (s *Supervisor) Stop() {
+	s.mu.Lock()
+	s.stopping = true
+	cmd, exited := s.cmd, s.exited
+	if cmd != nil {
+		s.state = StateStopping
+	}
+	s.mu.Unlock()
+
+	// 中断退避等待
+	s.cancel()
+
+	if cmd != nil && cmd.Process != nil {
+		s.terminate(cmd, exited)
+	}
+
+	<-s.done
+	s.setState(StateStopped)
+}
+
+// terminate 向进程发送停止信号，等待宽限期后强制结束，并等待进程被回收
+func (s *Supervisor) terminate(cmd *exec.Cmd, exited chan struct{}) {
+	pid := cmd.Process.Pid
+	log.Printf("正在停止服务器程序 (PID: %d)...", pid)
+
+	if s.config.StopSignal != syscall.SIGKILL {
+		if err := cmd.Process.Signal(s.config.StopSignal); err != nil {
+			// Windows 不支持向子进程发送 SIGTERM 等信号，直接强制结束
+			log.Printf("发送 %v 失败: %v，改为强制结束", s.config.StopSignal, err)
+		} else {
+			select {
+			case <-exited:
+				log.Println("服务器程序已停止")
+				return
+			case <-time.After(s.config.StopTimeout):
+				log.Printf("服务器程序在 %v 内未退出，强制结束", s.config.StopTimeout)
+			}
+		}
+	}
+
+	if err := cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		log.Printf("强制结束服务器程序失败: %v", err)
+	}
+	<-exited
+	log.Println("服务器程序已停止")
+}
+
+// watchHealth 周期性执行健康检查，连续失败达到阈值时停止进程，由 Run 按重启策略重启
+func (s *Supervisor) watchHealth(cmd *exec.Cmd, exited chan struct{}) {
+	hc := s.config.HealthCheck
+	startDeadline := time.Now().Add(hc.StartPeriod)
+	passed := false
+	failures := 0
+
+	ticker := time.NewTicker(hc.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-exited:
+			return
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(s.ctx, hc.Timeout)
+		err := hc.Checker.Check(ctx)
+		cancel()
+
+		// 进程已退出或守护程序正在关闭时，丢弃本次结果
+		select {
+		case <-exited:
+			return
+		default:
+		}
+		if s.ctx.Err() != nil {
+			return
+		}
+
+		now := time.Now()
+		if err == nil {
+			if !passed || failures > 0 {
+				log.Printf("健康检查通过 (%s)", hc.Checker)
+			}
+			passed = true
+			failures = 0
+			s.setHealth(HealthState{Status: HealthHealthy, LastCheck: &now})
+			continue
+		}
+
+		// 启动宽限期内且尚未通过过检查，失败不计数
+		if !passed && now.Before(startDeadline) {
+			s.setHealth(HealthState{Status: HealthStarting, LastCheck: &now, LastError: err.Error()})
+			continue
+		}
+
+		failures++
+		log.Printf("健康检查失败 (%d/%d): %v", failures, hc.FailureThreshold, err)
+		if failures < hc.FailureThreshold {
+			status := HealthHealthy
+			if !passed {
+				status = HealthStarting
+			}
+			s.setHealth(HealthState{Status: status, ConsecutiveFailures: failures, LastCheck: &now, LastError: err.Error()})
+			continue
+		}
+
+		s.setHealth(HealthState{Status: HealthUnhealthy, ConsecutiveFailures: failures, LastCheck: &now, LastError: err.Error()})
+		log.Printf("健康检查连续失败 %d 次，重启服务器程序", failures)
+
+		s.mu.Lock()
+		if s.stopping {
+			s.mu.Unlock()
+			return
+		}
+		s.unhealthy = fmt.Errorf("健康检查失败: %v", err)
+		s.mu.Unlock()
+
+		s.terminate(cmd, exited)
+		return
+	}
+}
+
+// setHealth 更新健康状态
+func (s *Supervisor) setHealth(state HealthState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.health = state
+}
+
+// takeUnhealthy 取出并清除因健康检查失败停止进程的原因
+func (s *Supervisor) takeUnhealthy() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.unhealthy
+	s.unhealthy = nil
+	return err
+}
+
+// Status 返回目标程序运行状态快照
+func (s *Supervisor) Status() SupervisorStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := SupervisorStatus{
+		Target:   s.config.TargetPath,
+		State:    s.state,
+		Restarts: s.total,
+		LastExit: s.lastExit,
+		Health:   s.health,
+	}
+	select {
+	case <-s.done:
+	default:
+		status.Supervising = true
+	}
+	if s.cmd != nil && s.cmd.Process != nil {
+		status.PID = s.cmd.Process.Pid
+		startedAt := s.startedAt
+		status.StartedAt = &startedAt
+	}
+	return status
+}
+
+// beginProbation 返回本次启动需要试运行验证的更新
+func (s *Supervisor) beginProbation() *installedUpdate {
+	if s.updater == nil {
+		return nil
+	}
+	return s.updater.beginProbation()
+}
+
+// rollback 恢复旧版本，成功时返回 true
+func (s *Supervisor) rollback(p *installedUpdate, reason string) bool {
+	if err := s.updater.rollbackProbation(p, reason); err != nil {
+		log.Printf("回滚失败: %v", err)
+		return false
+	}
+	return true
+}
+
+// isStopping 是否正在关闭
+func (s *Supervisor) isStopping() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopping
+}
+
+// State 返回目标程序当前状态
+func (s *Supervisor) State() TargetState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// setState 设置目标程序状态
+func (s *Supervisor) setState(state TargetState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = state
+}
+
+// startedAtTime 返回目标程序最近一次启动时间
+func (s *Supervisor) startedAtTime() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.startedAt
+}
+
+// recordExit 记录最近一次退出原因
+func (s *Supervisor) recordExit(exitErr error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cmd = nil
+	if s.config.HealthCheck != nil {
+		s.health = HealthState{Status: HealthUnknown}
+	}
+	if exitErr != nil {
+		s.lastExit = exitErr.Error()
+	} else {
+		s.lastExit = "exit status 0"
+	}
+}
+
+// shouldRestart 根据重启策略判断是否需要重启
+func (s *Supervisor) shouldRestart(exitErr error) bool {
+	switch s.config.RestartPolicy {
+	case RestartNever:
+		return false
+	case RestartOnFailure:
+		return exitErr != nil
+	default:
+		return true
+	}
+}
+
+// nextDelay 计算下一次重启前的等待时间；触发崩溃循环保护时返回 false
+func (s *Supervisor) nextDelay(uptime time.Duration) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	// 运行足够久之后退出，视为一次新的故障，重置退避
+	if s.config.HealthyUptime > 0 && uptime >= s.config.HealthyUptime {
+		s.failures = 0
+	}
+
+	if s.config.MaxRestarts > 0 {
+		recent := s.restarts[:0]
+		for _, t := range s.restarts {
+			if now.Sub(t) < s.config.RestartWindow {
+				recent = append(recent, t)
+			}
+		}
+		s.restarts = recent
+		if len(s.restarts) >= s.config.MaxRestarts {
+			return 0, false
+		}
+		s.restarts = append(s.restarts, now)
+	}
+	s.total++
+
+	delay := float64(s.config.InitialDelay) * math.Pow(s.config.Multiplier, float64(s.failures))
+	if delay > float64(s.config.MaxDelay) {
+		delay = float64(s.config.MaxDelay)
+	}
+	if s.config.Jitter > 0 {
+		delay += delay * s.config.Jitter * (rand.Float64()*2 - 1)
+	}
+	s.failures++
+
+	return time.Duration(delay), true
+}
+
+// watchUpdates 等待更新器通知新版本已就绪，按应用策略在合适的时间优雅停止正在运行的目标程序，
+// 由 Run 在重新启动前替换文件；Run 返回（不再启动目标程序）后退出
+func (s *Supervisor) watchUpdates() {
+	var timer <-chan time.Time
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-s.done:
+			return
+		case <-s.updater.UpdateReady():
+		case <-timer:
+		}
+		timer = nil
+
+		if !s.updater.HasPendingUpdate() {
+			continue
+		}
+		at, ok := s.updater.restartAt(time.Now())
+		if !ok {
+			continue
+		}
+		if wait := time.Until(at); wait > 0 {
+			// 最多等待 1 小时后重新计算，避免系统休眠或时钟调整导致错过维护窗口
+			if wait > time.Hour {
+				wait = time.Hour
+			}
+			timer = time.After(wait)
+			continue
+		}
+		s.restartForUpdate()
+	}
+}
+
+// restartForUpdate 停止目标程序以应用更新；目标程序未运行时由下一次启动应用
+func (s *Supervisor) restartForUpdate() {
+	if !s.updater.HasPendingUpdate() {
+		return
+	}
+
+	s.mu.Lock()
+	cmd, exited := s.cmd, s.exited
+	if s.stopping || cmd == nil {
+		s.mu.Unlock()
+		return
+	}
+	s.updating = true
+	s.state = StateStopping
+	s.mu.Unlock()
+
+	log.Println("新版本已就绪，重启服务器程序以应用更新")
+	s.terminate(cmd, exited)
+}
+
+// noteUnsupervised 不再启动目标程序时提示：之后就绪的新版本只会在守护程序下次启动时应用
+func (s *Supervisor) noteUnsupervised() {
+	if s.updater == nil {
+		return
+	}
+	if version := s.updater.pendingVersion(); version != "" {
+		log.Printf("新版本 %s 已就绪，服务器程序不再启动，将在守护程序下次启动时应用", version)
+	} else {
+		log.Printf("不再监控服务器程序，之后下载的新版本将在守护程序下次启动时应用")
+	}
+}
+
+// isUpdating 目标程序是否为应用更新而停止
+func (s *Supervisor) isUpdating() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.updating
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const (
+	testTargetEnv    = "POLYWIN_TEST_TARGET"     // 设置时测试程序作为被监控的目标程序运行，取值为运行方式
+	testTargetLogEnv = "POLYWIN_TEST_TARGET_LOG" // 目标程序每次启动时向该文件追加一行
+)
+
+func TestMain(m *testing.M) {
+	if mode := os.Getenv(testTargetEnv); mode != "" {
+		os.Exit(runTestTarget(mode))
+	}
+	os.Exit(m.Run())
+}
+
+// runTestTarget 模拟目标程序：exit0 / exit1 立即退出，run 运行到收到停止信号，
+// ignore-term 忽略 SIGTERM，crash-first 第一次启动时异常退出、之后正常运行
+func runTestTarget(mode string) int {
+	if mode == "ignore-term" {
+		signal.Ignore(syscall.SIGTERM)
+	}
+	starts := 0
+	if path := os.Getenv(testTargetLogEnv); path != "" {
+		data, _ := os.ReadFile(path)
+		starts = strings.Count(string(data), "\n")
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err == nil {
+			fmt.Fprintln(f, os.Getpid())
+			f.Close()
+		}
+	}
+
+	switch mode {
+	case "exit0":
+		return 0
+	case "exit1":
+		return 1
+	case "crash-first":
+		if starts == 0 {
+			return 1
+		}
+	}
+	time.Sleep(time.Minute)
+	return 0
+}
+
+// newTestSupervisor 创建监督器，目标程序为以 mode 方式运行的测试程序本身（config.TargetPath 为空时）
+func newTestSupervisor(t *testing.T, mode string, config SupervisorConfig, updater *Updater) (*Supervisor, *testTarget) {
+	t.Helper()
+	target := &testTarget{log: filepath.Join(t.TempDir(), "starts.log")}
+	t.Setenv(testTargetEnv, mode)
+	t.Setenv(testTargetLogEnv, target.log)
+
+	if config.TargetPath == "" {
+		config.TargetPath = os.Args[0]
+	}
+	if config.RestartPolicy == "" {
+		config.RestartPolicy = RestartAlways
+	}
+	if config.InitialDelay == 0 {
+		config.InitialDelay = time.Millisecond
+		config.MaxDelay = 10 * time.Millisecond
+		config.Multiplier = 2
+	}
+	if config.StopSignal == 0 {
+		config.StopSignal = syscall.SIGTERM
+	}
+	if config.StopTimeout == 0 {
+		config.StopTimeout = 5 * time.Second
+	}
+	s := NewSupervisor(&config, updater)
+	t.Cleanup(s.Stop)
+	return s, target
+}
+
+// testTarget 记录测试目标程序的启动次数
+type testTarget struct {
+	log string
+}
+
+// starts 返回目标程序启动的次数
+func (tt *testTarget) starts() int {
+	data, _ := os.ReadFile(tt.log)
+	return strings.Count(string(data), "\n")
+}
+
+// runSupervisor 在后台运行监督器，返回 Run 结束时关闭的通道
+func runSupervisor(s *Supervisor) chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		s.Run()
+		close(done)
+	}()
+	return done
+}
+
+// waitFor 等待 cond 成立
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待%s超时", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitDone 等待 Run 结束
+func waitDone(t *testing.T, done chan struct{}) {
+	t.Helper()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run 没有结束")
+	}
+}
+
+func TestRestartPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     RestartPolicy
+		mode       string
+		wantStarts int
+		wantState  TargetState
+	}{
+		{"always 正常退出也重启", RestartAlways, "exit0", 3, StateFailed},
+		{"on-failure 正常退出不重启", RestartOnFailure, "exit0", 1, StateExited},
+		{"on-failure 异常退出重启", RestartOnFailure, "exit1", 3, StateFailed},
+		{"never 异常退出不重启", RestartNever, "exit1", 1, StateExited},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, target := newTestSupervisor(t, tt.mode, SupervisorConfig{
+				RestartPolicy: tt.policy,
+				MaxRestarts:   2,
+				RestartWindow: time.Hour,
+			}, nil)
+			waitDone(t, runSupervisor(s))
+
+			if n := target.starts(); n != tt.wantStarts {
+				t.Errorf("启动了 %d 次，期望 %d 次", n, tt.wantStarts)
+			}
+			status := s.Status()
+			if status.State != tt.wantState || status.Restarts != tt.wantStarts-1 || status.Supervising {
+				t.Errorf("状态 = %+v，期望 %s、重启 %d 次、不再监控", status, tt.wantState, tt.wantStarts-1)
+			}
+		})
+	}
+}
+
+func TestNextDelay(t *testing.T) {
+	s := NewSupervisor(&SupervisorConfig{
+		InitialDelay:  100 * time.Millisecond,
+		MaxDelay:      time.Second,
+		Multiplier:    2,
+		HealthyUptime: time.Minute,
+	}, nil)
+
+	// 连续故障按倍数退避，不超过上限
+	for _, want := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		delay, ok := s.nextDelay(time.Second)
+		if !ok || delay != want*time.Millisecond {
+			t.Fatalf("nextDelay = %v, %v，期望 %v", delay, ok, want*time.Millisecond)
+		}
+	}
+
+	// 健康运行后退出，重新从初始等待时间开始
+	if delay, _ := s.nextDelay(time.Minute); delay != 100*time.Millisecond {
+		t.Errorf("健康运行后 nextDelay = %v，期望重置为 100ms", delay)
+	}
+	if delay, _ := s.nextDelay(time.Second); delay != 200*time.Millisecond {
+		t.Errorf("nextDelay = %v，期望 200ms", delay)
+	}
+}
+
+func TestNextDelayJitter(t *testing.T) {
+	s := NewSupervisor(&SupervisorConfig{
+		InitialDelay: 100 * time.Millisecond,
+		MaxDelay:     100 * time.Millisecond,
+		Multiplier:   2,
+		Jitter:       0.2,
+	}, nil)
+
+	seen := map[time.Duration]bool{}
+	for i := 0; i < 200; i++ {
+		delay, _ := s.nextDelay(0)
+		if delay < 80*time.Millisecond || delay > 120*time.Millisecond {
+			t.Fatalf("nextDelay = %v，超出 100ms ± 20%%", delay)
+		}
+		seen[delay] = true
+	}
+	if len(seen) < 10 {
+		t.Errorf("抖动后只有 %d 种等待时间", len(seen))
+	}
+}
+
+func TestCrashLoopWindow(t *testing.T) {
+	s := NewSupervisor(&SupervisorConfig{
+		InitialDelay:  time.Millisecond,
+		MaxDelay:      time.Millisecond,
+		Multiplier:    2,
+		MaxRestarts:   3,
+		RestartWindow: time.Minute,
+	}, nil)
+
+	for i := 0; i < 3; i++ {
+		if _, ok := s.nextDelay(0); !ok {
+			t.Fatalf("第 %d 次重启不应触发崩溃循环保护", i+1)
+		}
+	}
+	if _, ok := s.nextDelay(0); ok {
+		t.Fatal("窗口内第 4 次重启应触发崩溃循环保护")
+	}
+
+	// 窗口之前的重启不再计数
+	s.mu.Lock()
+	for i := range s.restarts {
+		s.restarts[i] = s.restarts[i].Add(-2 * time.Minute)
+	}
+	s.mu.Unlock()
+	if _, ok := s.nextDelay(0); !ok {
+		t.Error("窗口外的重启不应计入崩溃循环")
+	}
+	if s.Status().Restarts != 4 {
+		t.Errorf("重启次数 = %d，期望 4", s.Status().Restarts)
+	}
+}
+
+func TestStop(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		wantExit string
+		forced   bool // 是否在宽限期后强制结束
+	}{
+		{"收到停止信号后退出", "run", "terminated", false},
+		{"忽略停止信号时强制结束", "ignore-term", "killed", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const timeout = 300 * time.Millisecond
+			s, target := newTestSupervisor(t, tt.mode, SupervisorConfig{StopTimeout: timeout}, nil)
+			done := runSupervisor(s)
+			waitFor(t, "目标程序启动", func() bool { return target.starts() == 1 && s.State() == StateRunning })
+
+			start := time.Now()
+			s.Stop()
+			elapsed := time.Since(start)
+			waitDone(t, done)
+
+			if tt.forced != (elapsed >= timeout) {
+				t.Errorf("停止用时 %v，宽限期 %v，期望强制结束: %v", elapsed, timeout, tt.forced)
+			}
+			status := s.Status()
+			if status.State != StateStopped || !strings.Contains(status.LastExit, tt.wantExit) {
+				t.Errorf("状态 = %+v，期望已停止、退出原因包含 %q", status, tt.wantExit)
+			}
+			time.Sleep(50 * time.Millisecond)
+			if n := target.starts(); n != 1 {
+				t.Errorf("停止后又启动了目标程序（共 %d 次）", n)
+			}
+		})
+	}
+}
+
+func TestStopDuringBackoff(t *testing.T) {
+	s, target := newTestSupervisor(t, "exit1", SupervisorConfig{
+		InitialDelay: time.Hour,
+		MaxDelay:     time.Hour,
+		Multiplier:   2,
+	}, nil)
+	done := runSupervisor(s)
+	waitFor(t, "进入退避等待", func() bool { return s.State() == StateBackoff })
+
+	start := time.Now()
+	s.Stop()
+	waitDone(t, done)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("退避等待中停止用时 %v", elapsed)
+	}
+	if n := target.starts(); n != 1 {
+		t.Errorf("停止后又启动了目标程序（共 %d 次）", n)
+	}
+	if s.State() != StateStopped {
+		t.Errorf("状态 = %s", s.State())
+	}
+}
+
+func TestParseStopSignal(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    syscall.Signal
+		wantErr bool
+	}{
+		{"SIGTERM", syscall.SIGTERM, false},
+		{"term", syscall.SIGTERM, false},
+		{" sigint ", syscall.SIGINT, false},
+		{"KILL", syscall.SIGKILL, false},
+		{"SIGUSR1", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseStopSignal(tt.name)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("parseStopSignal(%q) = %v, %v", tt.name, got, err)
+		}
+	}
+}
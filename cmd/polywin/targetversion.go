@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// targetVersionTimeout 识别目标程序版本的超时时间
+const targetVersionTimeout = 5 * time.Second
+
+// targetVersion 返回目标程序的已安装版本，所有版本比较都以此为准
+// 优先使用状态文件中的安装记录；没有版本号时依次读取 Go 构建信息和查询运行中的目标程序，
+// 识别成功后写入安装记录。不执行目标程序（如 --version），避免与进程监督器启动的实例同时运行
+func (u *Updater) targetVersion() string {
+	record := u.installedRecord()
+	if record.Version != "" {
+		return record.Version
+	}
+
+	stamp, _ := readBuildStamp(u.config.TargetPath, u.versionVar())
+	version, source := u.detectTargetVersion(stamp)
+	if version == "" {
+		return ""
+	}
+
+	log.Printf("识别到目标程序版本: %s（来源: %s）", version, source)
+	record.Version = version
+	record.Source = source
+	record.Commit = stamp.Commit()
+	u.RecordInstalled(record)
+	return version
+}
+
+// detectTargetVersion 识别目标程序版本，返回版本号和来源；stamp 为目标程序的 Go 构建信息，可以为 nil
+func (u *Updater) detectTargetVersion(stamp *BuildStamp) (string, string) {
+	if stamp != nil && stamp.Version != "" {
+		if _, err := ParseVersion(stamp.Version); err == nil {
+			return stamp.Version, "buildinfo"
+		}
+	}
+
+	if u.config.VersionURL != "" {
+		ctx, cancel := context.WithTimeout(u.ctx, targetVersionTimeout)
+		version, err := fetchReportedVersion(ctx, u.config.VersionURL, u.config.VersionField)
+		cancel()
+		if err == nil {
+			return version, "info"
+		}
+		log.Printf("查询目标程序版本失败: %v", err)
+	}
+	return "", ""
+}
+
+// versionVar 返回 -ldflags -X 写入版本号的变量
+func (u *Updater) versionVar() string {
+	if u.config.BuildPolicy == nil {
+		return ""
+	}
+	return u.config.BuildPolicy.VersionVar
+}
@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestDetectTargetVersion(t *testing.T) {
+	info := newInfoServer(t, "v1.3.0")
+	broken := newInfoServer(t, "")
+
+	tests := []struct {
+		name       string
+		stamp      *BuildStamp
+		url        string
+		want       string
+		wantSource string
+	}{
+		{"构建信息优先", &BuildStamp{Version: "v1.4.0"}, info.URL, "v1.4.0", "buildinfo"},
+		{"构建信息中的版本号无效", &BuildStamp{Version: "dev"}, info.URL, "v1.3.0", "info"},
+		{"查询运行中的目标程序", nil, info.URL, "v1.3.0", "info"},
+		{"查询失败", nil, broken.URL, "", ""},
+		{"无法识别", nil, "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := newTestUpdater(t, t.TempDir(), &UpdaterConfig{VersionURL: tt.url, VersionField: "server.config.version"})
+			got, source := u.detectTargetVersion(tt.stamp)
+			if got != tt.want || source != tt.wantSource {
+				t.Errorf("版本 = %q（来源 %q），期望 %q（来源 %q）", got, source, tt.want, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestTargetVersionRecorded(t *testing.T) {
+	dir := t.TempDir()
+	info := newInfoServer(t, "v1.3.0")
+	u := newTestUpdater(t, dir, &UpdaterConfig{VersionURL: info.URL, VersionField: "server.config.version"})
+
+	if got := u.targetVersion(); got != "v1.3.0" {
+		t.Fatalf("targetVersion = %q", got)
+	}
+	if rec := loadTestState(t, dir).Installed; rec.Version != "v1.3.0" || rec.Source != "info" {
+		t.Errorf("安装记录 = %+v", rec)
+	}
+
+	// 已有安装记录时不再查询
+	info.Close()
+	if got := u.targetVersion(); got != "v1.3.0" {
+		t.Errorf("targetVersion = %q，期望使用安装记录", got)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseTOML 解析配置文件所需的 TOML 子集：
+// [table] / [a.b] 表头、key = value、字符串、整数、浮点数、布尔值和单行数组
+// 结果转换为 JSON 后复用 JSON 配置的解析逻辑
+func parseTOML(data []byte) (map[string]interface{}, error) {
+	root := make(map[string]interface{})
+	current := root
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(stripTOMLComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		// 表头
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") || strings.HasPrefix(line, "[[") {
+				return nil, fmt.Errorf("第 %d 行: 不支持的表头: %s", lineNo, line)
+			}
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			table, err := tomlTable(root, name)
+			if err != nil {
+				return nil, fmt.Errorf("第 %d 行: %v", lineNo, err)
+			}
+			current = table
+			continue
+		}
+
+		eq := strings.Index(line, "=")
+		if eq <= 0 {
+			return nil, fmt.Errorf("第 %d 行: 缺少 '='", lineNo)
+		}
+		key := unquoteTOMLKey(strings.TrimSpace(line[:eq]))
+		if key == "" {
+			return nil, fmt.Errorf("第 %d 行: 键名为空", lineNo)
+		}
+		if _, exists := current[key]; exists {
+			return nil, fmt.Errorf("第 %d 行: 重复的键 %s", lineNo, key)
+		}
+		value, err := parseTOMLValue(strings.TrimSpace(line[eq+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行: %v", lineNo, err)
+		}
+		current[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// tomlTable 按点分路径查找或创建表
+func tomlTable(root map[string]interface{}, name string) (map[string]interface{}, error) {
+	if name == "" {
+		return nil, fmt.Errorf("表名为空")
+	}
+	table := root
+	for _, part := range strings.Split(name, ".") {
+		part = unquoteTOMLKey(strings.TrimSpace(part))
+		if part == "" {
+			return nil, fmt.Errorf("无效的表名: %s", name)
+		}
+		next, ok := table[part]
+		if !ok {
+			child := make(map[string]interface{})
+			table[part] = child
+			table = child
+			continue
+		}
+		child, ok := next.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s 不是表", part)
+		}
+		table = child
+	}
+	return table, nil
+}
+
+// parseTOMLValue 解析标量或单行数组
+func parseTOMLValue(s string) (interface{}, error) {
+	switch {
+	case s == "":
+		return nil, fmt.Errorf("值为空")
+	case s == "true":
+		return true, nil
+	case s == "false":
+		return false, nil
+	case strings.HasPrefix(s, `"`):
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("无效的字符串: %s", s)
+		}
+		return v, nil
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return nil, fmt.Errorf("无效的字符串: %s", s)
+		}
+		return s[1 : len(s)-1], nil
+	case strings.HasPrefix(s, "["):
+		if !strings.HasSuffix(s, "]") {
+			return nil, fmt.Errorf("数组必须写在一行内: %s", s)
+		}
+		items := make([]interface{}, 0)
+		for _, part := range splitTOMLArray(s[1 : len(s)-1]) {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			v, err := parseTOMLValue(part)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		return items, nil
+	}
+
+	num := strings.ReplaceAll(s, "_", "")
+	if n, err := strconv.ParseInt(num, 10, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(num, 64); err == nil {
+		return f, nil
+	}
+	return nil, fmt.Errorf("无法识别的值: %s", s)
+}
+
+// splitTOMLArray 按逗号拆分数组元素，忽略字符串内的逗号
+func splitTOMLArray(s string) []string {
+	var parts []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// stripTOMLComment 去掉行尾注释（字符串内的 # 保留）
+func stripTOMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// unquoteTOMLKey 去掉键名两侧的引号
+func unquoteTOMLKey(key string) string {
+	if len(key) >= 2 && (key[0] == '"' || key[0] == '\'') && key[len(key)-1] == key[0] {
+		return key[1 : len(key)-1]
+	}
+	return key
+}
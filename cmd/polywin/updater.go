@@ -1,58 +1,174 @@
 package main
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"runtime"
+	"strings"
 	"sync"
 	"time"
 )
 
 // UpdaterConfig 更新器配置
 type UpdaterConfig struct {
-	RepoURL          string
-	UpdateURL        string
+	Source           UpdateSource // 更新源，为 nil 时不检查更新
+	Downloader       *Downloader  // 更新源使用的下载器，用于报告下载进度
 	CheckInterval    time.Duration
 	EnableAutoUpdate bool
-	CurrentVersion   string
-	TargetExecutable string // 目标可执行文件名
-	TargetPath       string // 目标可执行文件完整路径
+	Channel          string       // 订阅的发布通道：stable / beta / canary
+	AllowDowngrade   bool         // 已安装版本不属于订阅通道时（如从 beta 切换回 stable），允许降级
+	TargetExecutable string       // 目标可执行文件名
+	TargetPath       string       // 目标可执行文件完整路径
+	StatePath        string       // 状态文件路径
+	MaxDownloadSize  int64        // 下载文件大小上限（字节），0 表示不限制
+	RequireChecksum  bool         // 没有可用校验和时拒绝更新
+	Delta            bool         // 优先下载增量补丁，应用到当前版本生成新版本
+	ArchiveEntry     string       // 压缩包中目标程序的文件名，默认与目标程序同名
+	Companions       []string     // 随目标程序一起从压缩包中提取并替换的附带文件
+	MaxExtractSize   int64        // 压缩包解压后的总大小上限（字节）
+	PublicKeys       []*PublicKey // 受信任的签名公钥，拒绝未签名或签名错误的更新
+	SkipSignature    bool         // 不校验签名（不安全）
+	BuildPolicy      *BuildPolicy // 安装前检查候选程序的 Go 构建信息
+	VersionURL       string       // 没有安装记录时查询目标程序版本的地址
+	VersionField     string       // 版本字段路径
+
+	Constraint   *VersionConstraint // 只安装满足约束的版本，为 nil 时不限制
+	SkipVersions []string           // 不安装的版本
+
+	Versions *VersionStore // 保存最近安装的版本，为 nil 时不保存
+
+	ApplyStrategy ApplyStrategy      // 新版本就绪后替换目标程序的时机，为空时立即替换
+	ApplyWindow   *MaintenanceWindow // ApplyStrategy 为 window 时的维护窗口
+
+	RequireApproval bool          // 自动更新下载并校验新版本后等待批准，不自动替换
+	ApprovalTTL     time.Duration // 等待批准的有效期，过期后丢弃，0 表示不过期
 }
 
 // UpdateInfo 更新信息
 type UpdateInfo struct {
-	Version     string `json:"version"`
-	DownloadURL string `json:"download_url"`
-	Checksum    string `json:"checksum"`
-	ReleaseDate string `json:"release_date"`
+	Version      string      `json:"version"`
+	DownloadURL  string      `json:"download_url"`
+	Checksum     string      `json:"checksum"`      // sha256:<hex>、sha512:<hex> 或纯十六进制
+	Size         int64       `json:"size"`          // 文件大小（字节），0 表示不校验
+	SignatureURL string      `json:"signature_url"` // 签名文件地址，为空时使用下载地址 + .minisig / .sig
+	ReleaseDate  string      `json:"release_date"`
+	ReleaseNotes string      `json:"release_notes,omitempty"`
+	Patches      []PatchInfo `json:"patches,omitempty"` // 从旧版本升级的增量补丁
+
+	Channel  string                 `json:"channel,omitempty"`  // 所属发布通道，为空时按版本号判断
+	Channels map[string]*UpdateInfo `json:"channels,omitempty"` // 其他通道的版本（如 beta、canary）
+
+	Assets map[string]PlatformAsset `json:"assets,omitempty"` // 按平台（如 linux/arm64）区分的发布产物，非空时使用当前平台的条目
+
+	Rollout *RolloutInfo `json:"rollout,omitempty"` // 分阶段发布，为空时所有机器都安装
+
+	Revision    string `json:"-"` // 下载地址的 ETag / Last-Modified，没有版本号时用于判断变化
+	ManifestRef string `json:"-"` // 版本信息文件的引用，非空时需要校验其签名
+	manifest    []byte // 版本信息原始内容
+}
+
+// ReleaseChannel 返回版本所属的发布通道，没有指定时按版本号判断
+func (info *UpdateInfo) ReleaseChannel() string {
+	if info.Channel != "" {
+		return info.Channel
+	}
+	return versionChannel(info.Version)
+}
+
+// PatchInfo 增量补丁信息
+type PatchInfo struct {
+	From     string `json:"from"`     // 补丁适用的已安装版本
+	URL      string `json:"url"`      // 补丁地址，可以是相对路径
+	Checksum string `json:"checksum"` // 补丁文件本身的校验和，为空时只校验生成的新版本
+	Size     int64  `json:"size"`     // 补丁文件大小（字节），0 表示不校验
+}
+
+// ID 返回更新的标识：有版本号时为版本号，否则为 revision
+func (info *UpdateInfo) ID() string {
+	if info.Version != "" {
+		return info.Version
+	}
+	return info.Revision
 }
 
 // Updater 更新器
 type Updater struct {
-	config         *UpdaterConfig
-	ctx            context.Context
-	cancel         context.CancelFunc
-	lastReleaseTag string // 记录最后检查的 release tag
-	pendingUpdate  bool
-	updateMutex    sync.Mutex
+	config          *UpdaterConfig
+	ctx             context.Context
+	cancel          context.CancelFunc
+	pendingUpdate   bool
+	download        *DownloadProgress // 正在进行的下载
+	lastFailure     *UpdateFailure    // 最近一次更新失败的原因，更新成功后清除
+	bucket          float64           // 本机的分阶段发布分组（0-100），由持久化的机器 ID 计算
+	rolloutNotice   string            // 已提示过不在发布范围内的版本和比例，避免每次检查都输出
+	downgradeNotice string            // 已提示过不降级的版本，避免每次检查都输出
+	probation       *installedUpdate  // 已替换、等待试运行验证的更新
+	state           *UpdaterState
+	updateMutex     sync.Mutex
+	installMutex    sync.Mutex    // 同一时间只安装一个版本（自动更新或切换版本）
+	ready           chan struct{} // 新版本已就绪时通知守护程序重启目标程序
+}
+
+// installedUpdate 已替换文件但尚未通过试运行的更新
+type installedUpdate struct {
+	Version     string
+	BackupPath  string // 旧版本备份（.old）
+	InstalledAt time.Time
+	Previous    InstalledRecord // 更新前的版本记录，回滚时恢复
+	started     bool            // 新版本进程是否已启动
 }
 
 // NewUpdater 创建新的更新器
 func NewUpdater(config *UpdaterConfig) *Updater {
 	ctx, cancel := context.WithCancel(context.Background())
-	return &Updater{
+	if config.StatePath == "" {
+		config.StatePath = defaultStatePath(config.TargetPath)
+	}
+	state, err := loadState(config.StatePath)
+	if err != nil {
+		log.Printf("加载更新器状态失败，使用空状态: %v", err)
+	}
+	if state.MachineID == "" {
+		if state.MachineID, err = newMachineID(); err != nil {
+			log.Printf("%v", err)
+		} else if err := state.save(config.StatePath); err != nil {
+			log.Printf("保存机器 ID 失败: %v", err)
+		}
+	}
+	u := &Updater{
 		config:        config,
 		ctx:           ctx,
 		cancel:        cancel,
 		pendingUpdate: false,
+		bucket:        machineBucket(state.MachineID),
+		state:         state,
+		ready:         make(chan struct{}, 1),
 	}
+	if config.Downloader != nil {
+		config.Downloader.OnProgress = u.setDownloadProgress
+	}
+	return u
+}
+
+// setDownloadProgress 记录下载进度，供状态接口查询
+func (u *Updater) setDownloadProgress(p DownloadProgress) {
+	u.updateMutex.Lock()
+	defer u.updateMutex.Unlock()
+	u.download = &p
+}
+
+// setLastFailure 记录更新结果，err 为 nil 时清除失败记录
+func (u *Updater) setLastFailure(info *UpdateInfo, err error) {
+	u.updateMutex.Lock()
+	defer u.updateMutex.Unlock()
+	if err == nil {
+		u.lastFailure = nil
+		return
+	}
+	u.lastFailure = &UpdateFailure{Version: info.ID(), Reason: err.Error(), Time: time.Now()}
 }
 
 // HasPendingUpdate 检查是否有待处理的更新
@@ -69,6 +185,11 @@ func (u *Updater) setPendingUpdate(value bool) {
 	u.pendingUpdate = value
 }
 
+// UpdateReady 新版本校验完成、等待替换时收到通知，守护程序据此停止目标程序并调用 applyPending
+func (u *Updater) UpdateReady() <-chan struct{} {
+	return u.ready
+}
+
 // StartUpdateChecker 启动更新检查器
 func (u *Updater) StartUpdateChecker() {
 	ticker := time.NewTicker(u.config.CheckInterval)
@@ -102,135 +223,215 @@ func (u *Updater) checkForUpdates() {
 	default:
 	}
 
-	log.Println("正在检查更新...")
-
-	var hasUpdate bool
-	var newVersion string
-
-	if u.config.RepoURL != "" {
-		// 直接尝试下载新版本，通过下载是否成功来判断是否有更新
-		// 不再使用 GitHub API（避免 403 频率限制问题）
-		hasUpdate, newVersion = u.checkUpdateByDownload()
-	} else if u.config.UpdateURL != "" {
-		// 从更新 URL 检查更新
-		hasUpdate, newVersion = u.checkURLUpdates()
-	} else {
+	if u.config.Source == nil {
 		log.Println("未配置更新源，跳过检查")
 		return
 	}
 
-	if hasUpdate {
-		log.Printf("发现新版本: %s，当前版本: %s", newVersion, u.config.CurrentVersion)
-		log.Printf("开始执行更新流程...")
-		u.setPendingUpdate(true)
-		if err := u.performUpdate(newVersion); err != nil {
-			log.Printf("更新失败: %v", err)
-			u.setPendingUpdate(false)
-		} else {
-			log.Println("更新完成，等待服务器程序重启以应用更新")
-		}
-	} else {
-		log.Println("当前已是最新版本")
-	}
-}
+	u.expireReady(time.Now())
 
-// checkUpdateByDownload 通过尝试下载来判断是否有更新
-// 不依赖 GitHub API，避免 403 频率限制问题
-func (u *Updater) checkUpdateByDownload() (bool, string) {
-	// 创建带超时的 HTTP 客户端（10秒超时，只检查 HEAD 请求）
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
+	log.Printf("正在检查更新（%s）...", u.config.Source)
 
-	// 尝试检查下载链接是否存在（使用 HEAD 请求，不下载完整文件）
-	downloadURL := "https://github.com/0xachong/polywin/releases/latest/download/server.exe"
-	req, err := http.NewRequestWithContext(u.ctx, "HEAD", downloadURL, nil)
+	info, err := u.latest()
 	if err != nil {
-		log.Printf("创建下载检查请求失败: %v", err)
-		return false, ""
+		log.Printf("检查更新失败: %v", err)
+		return
+	}
+	if info != nil && !channelAllows(u.config.Channel, info.ReleaseChannel()) {
+		log.Printf("版本 %s 属于 %s 通道，当前订阅 %s 通道，跳过", info.ID(), info.ReleaseChannel(), u.config.Channel)
+		info = nil
+	}
+	if info != nil && !u.isNewer(info) && !u.isChannelDowngrade(info) {
+		info = nil
 	}
 
-	req.Header.Set("User-Agent", "PolyWin-Updater/1.0")
+	if info != nil && u.isBlacklisted(info.ID()) {
+		log.Printf("版本 %s 曾回滚，已在黑名单中，跳过更新", info.ID())
+		return
+	}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("检查下载链接失败: %v", err)
-		return false, ""
+	if info != nil && u.isExpired(info.ID()) {
+		log.Printf("版本 %s 等待批准超时，出现更新的版本前不再下载", info.ID())
+		return
 	}
-	defer resp.Body.Close()
 
-	// 如果返回 404，说明没有新版本
-	if resp.StatusCode == http.StatusNotFound {
-		return false, ""
+	if info != nil {
+		if err := u.checkVersionPolicy(info); err != nil {
+			log.Printf("%v，跳过更新", err)
+			return
+		}
+		if hold := u.Hold(); hold != nil {
+			log.Printf("发现版本 %s，但更新已暂停（%s），跳过更新", info.ID(), hold)
+			return
+		}
 	}
 
-	// 如果返回 200 或其他成功状态，说明文件存在
-	// 检查文件大小（通过 Content-Length）
-	contentLength := resp.ContentLength
+	if info != nil && u.InProbation() {
+		log.Println("上一次更新仍在试运行中，暂不应用新版本")
+		return
+	}
 
-	// 如果是第一次检查，保存当前文件大小
-	if u.lastReleaseTag == "" {
-		if contentLength > 0 {
-			u.lastReleaseTag = fmt.Sprintf("%d", contentLength)
-			log.Printf("初始化文件大小: %d 字节", contentLength)
+	if ready := u.readyVersion(); info != nil && ready != "" {
+		if sameVersion(ready, info.ID()) {
+			log.Printf("版本 %s 已就绪，等待批准", ready)
+			return
 		}
-		return false, ""
+		if _, ok := u.discardReady(fmt.Sprintf("被版本 %s 取代", info.ID()), nil); !ok {
+			return
+		}
+		log.Printf("版本 %s 尚未批准，改为下载版本 %s", ready, info.ID())
 	}
 
-	// 比较文件大小，如果不同说明有新版本
-	currentSize := u.lastReleaseTag
-	newSize := fmt.Sprintf("%d", contentLength)
+	if info != nil && u.HasPendingUpdate() {
+		pending := u.pendingVersion()
+		if sameVersion(pending, info.ID()) {
+			log.Printf("版本 %s 已就绪，等待应用（%s）", pending, u.applySchedule(time.Now()))
+			return
+		}
+		if !u.discardPending(fmt.Sprintf("被版本 %s 取代", info.ID())) {
+			return
+		}
+		log.Printf("版本 %s 尚未应用，改为更新到版本 %s", pending, info.ID())
+	}
 
-	if newSize != currentSize && contentLength > 0 {
-		log.Printf("检测到新版本（文件大小变化: %s -> %s 字节）", currentSize, newSize)
-		u.lastReleaseTag = newSize
-		return true, newSize
+	if info != nil && !u.inRollout(info) {
+		return
 	}
 
-	return false, ""
+	if info != nil {
+		log.Printf("发现新版本: %s，已安装版本: %s", info.ID(), u.installedRecord())
+		if notes := strings.TrimSpace(info.ReleaseNotes); notes != "" {
+			log.Printf("更新说明: %s", strings.SplitN(notes, "\n", 2)[0])
+		}
+		log.Printf("开始执行更新流程...")
+		u.installMutex.Lock()
+		err := u.performUpdate(info)
+		u.installMutex.Unlock()
+		u.setLastFailure(info, err)
+		if err != nil {
+			log.Printf("更新失败: %v", err)
+		} else if u.config.RequireApproval {
+			log.Println("新版本已就绪，等待批准后应用更新")
+		} else {
+			log.Println("新版本已就绪，等待守护程序重启服务器程序以应用更新")
+		}
+	} else {
+		log.Println("当前已是最新版本")
+	}
 }
 
-// checkURLUpdates 从更新 URL 检查更新
-func (u *Updater) checkURLUpdates() (bool, string) {
-	// 创建带超时的 HTTP 客户端（10秒超时）
-	client := &http.Client{
-		Timeout: 10 * time.Second,
+// latest 从更新源获取最新版本信息并校验版本信息的签名
+func (u *Updater) latest() (*UpdateInfo, error) {
+	info, err := u.config.Source.Latest(u.ctx, u.installedRecord())
+	if err != nil || info == nil {
+		return nil, err
 	}
 
-	req, err := http.NewRequestWithContext(u.ctx, "GET", u.config.UpdateURL, nil)
-	if err != nil {
-		log.Printf("创建请求失败: %v", err)
-		return false, ""
+	// 更新信息本身也必须有有效签名
+	if info.ManifestRef != "" && !u.config.SkipSignature {
+		if err := u.verifySignature(info.ManifestRef, "", func(sig []byte) (*PublicKey, error) {
+			parsed, err := ParseSignature(sig)
+			if err != nil {
+				return nil, err
+			}
+			return VerifySignature(u.config.PublicKeys, bytes.NewReader(info.manifest), parsed)
+		}); err != nil {
+			return nil, fmt.Errorf("更新信息签名校验失败: %v", err)
+		}
 	}
+	return info, nil
+}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("获取更新信息失败: %v", err)
-		return false, ""
+// isNewer 判断更新源中的版本是否比目标程序的已安装版本新
+// 有版本号时按语义化版本比较，否则比较 revision
+func (u *Updater) isNewer(info *UpdateInfo) bool {
+	if info.Version != "" {
+		return isNewerVersion(info.Version, u.targetVersion())
+	}
+	installed := u.installedRecord()
+	if info.Revision == "" || info.Revision == installed.Revision {
+		return false
 	}
-	defer resp.Body.Close()
+	log.Printf("检测到新版本（revision: %s -> %s）", installed.Revision, info.Revision)
+	return true
+}
 
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("更新服务器返回错误状态码: %d", resp.StatusCode)
-		return false, ""
+// isChannelDowngrade 判断是否需要降级：已安装版本不属于订阅的通道（如从 beta 切换回 stable），
+// 更新源提供的是订阅通道中更低的版本。只有 AllowDowngrade 时才降级，否则保留当前版本直到订阅通道发布更高的版本
+func (u *Updater) isChannelDowngrade(info *UpdateInfo) bool {
+	installed := u.installedRecord()
+	if info.Version == "" || installed.Version == "" || sameVersion(info.Version, installed.Version) {
+		return false
+	}
+	installedChannel := installed.Channel
+	if installedChannel == "" {
+		installedChannel = versionChannel(installed.Version)
+	}
+	if channelAllows(u.config.Channel, installedChannel) {
+		return false
 	}
 
-	var updateInfo UpdateInfo
-	if err := json.NewDecoder(resp.Body).Decode(&updateInfo); err != nil {
-		log.Printf("解析更新信息失败: %v", err)
-		return false, ""
+	if !u.config.AllowDowngrade {
+		u.updateMutex.Lock()
+		notify := u.downgradeNotice != info.Version
+		u.downgradeNotice = info.Version
+		u.updateMutex.Unlock()
+		if notify {
+			log.Printf("已安装版本 %s 属于 %s 通道，%s 通道的最新版本 %s 更低；保留当前版本（设置 allow_downgrade 可降级）",
+				installed.Version, installedChannel, u.config.Channel, info.Version)
+		}
+		return false
 	}
+	log.Printf("已安装版本 %s 属于 %s 通道，降级到 %s 通道的 %s", installed.Version, installedChannel, u.config.Channel, info.Version)
+	return true
+}
 
-	// 比较版本
-	if updateInfo.Version != u.config.CurrentVersion {
-		return true, updateInfo.Version
+// checkVersionPolicy 检查版本是否在跳过列表中、是否满足版本约束
+func (u *Updater) checkVersionPolicy(info *UpdateInfo) error {
+	for _, v := range u.config.SkipVersions {
+		if info.Version != "" && sameVersion(v, info.Version) {
+			return fmt.Errorf("版本 %s 在 skip_versions 中", info.Version)
+		}
 	}
+	if c := u.config.Constraint; c != nil {
+		if info.Version == "" {
+			return fmt.Errorf("更新源没有提供版本号（revision %s），无法判断是否满足版本约束 %s", info.Revision, c)
+		}
+		if !c.Check(info.Version) {
+			return fmt.Errorf("版本 %s 不满足版本约束 %s", info.Version, c)
+		}
+	}
+	return nil
+}
 
-	return false, ""
+// inRollout 判断本机是否在版本的分阶段发布范围内，不在范围内时只在比例变化后输出一次日志
+func (u *Updater) inRollout(info *UpdateInfo) bool {
+	if info.Rollout == nil {
+		return true
+	}
+	percentage, err := info.Rollout.current(info.ReleaseDate, time.Now())
+	if err != nil {
+		log.Printf("版本 %s 的分阶段发布配置无效，跳过: %v", info.ID(), err)
+		return false
+	}
+	if u.bucket < percentage {
+		return true
+	}
+
+	notice := fmt.Sprintf("%s@%.0f", info.ID(), percentage)
+	u.updateMutex.Lock()
+	notify := u.rolloutNotice != notice
+	u.rolloutNotice = notice
+	u.updateMutex.Unlock()
+	if notify {
+		log.Printf("版本 %s 正在分阶段发布（当前 %.2f%%），本机分组 %.2f 不在范围内，暂不更新", info.ID(), percentage, u.bucket)
+	}
+	return false
 }
 
 // performUpdate 执行更新
-func (u *Updater) performUpdate(newVersion string) error {
+func (u *Updater) performUpdate(info *UpdateInfo) error {
+	newVersion := info.ID()
 	log.Printf("开始执行更新到版本: %s", newVersion)
 
 	// 使用配置的目标程序路径
@@ -242,212 +443,693 @@ func (u *Updater) performUpdate(newVersion string) error {
 	execDir := filepath.Dir(targetPath)
 	execName := filepath.Base(targetPath)
 
-	log.Printf("准备从 GitHub Releases 下载新版本到: %s", execDir)
+	outputPath := filepath.Join(execDir, execName+".new")
+	log.Printf("准备从 %s 下载新版本到: %s", u.config.Source, outputPath)
 
-	// 直接从 GitHub Releases 下载新版本（不再构建）
-	if err := u.downloadServerFromGitHubReleases(execDir, execName); err != nil {
+	// 从更新源下载新版本（不再构建）
+	if err := u.downloadArtifact(info, outputPath); err != nil {
 		log.Printf("下载失败，错误详情: %v", err)
 		return fmt.Errorf("下载新版本失败: %v", err)
 	}
 
-	log.Printf("下载成功，准备替换文件...")
+	// 开始更新事务，之后每个阶段都先写入状态文件，守护程序中断后启动时据此完成或回滚
+	u.beginTransaction(info)
 
-	// 执行更新（不重启，由守护程序监控重启）
-	if err := u.updateTarget(targetPath); err != nil {
-		log.Printf("文件替换失败，错误详情: %v", err)
-		return fmt.Errorf("文件替换失败: %v", err)
+	// 替换前确认是当前平台的可执行文件，并且构建信息符合策略
+	stamp, err := u.checkCandidate(outputPath, info)
+	if err != nil {
+		u.discardStaged(err.Error())
+		log.Printf("新版本校验失败，错误详情: %v", err)
+		return err
+	}
+
+	log.Printf("下载成功，新版本通过校验")
+
+	record := InstalledRecord{Version: info.Version, Revision: info.Revision, InstalledAt: time.Now(), Source: "update", Commit: stamp.Commit(), Channel: info.ReleaseChannel()}
+	if err := u.stageUpdate(record, u.config.RequireApproval); err != nil {
+		return err
 	}
 
 	log.Printf("更新流程完成")
 	return nil
 }
 
-// downloadServerFromGitHubReleases 从 GitHub Releases 下载 server.exe
-func (u *Updater) downloadServerFromGitHubReleases(targetDir, execName string) error {
-	log.Println("开始从 GitHub Releases 下载新版本...")
-
-	// 尝试多个下载源（不再使用 GitHub API，避免 403 问题）
-	downloadSources := []struct {
-		name string
-		url  string
-	}{
-		{
-			name: "GitHub Releases (latest tag)",
-			url:  "https://github.com/0xachong/polywin/releases/latest/download/server.exe",
-		},
-		{
-			name: "GitHub raw (releases 目录)",
-			url:  "https://raw.githubusercontent.com/0xachong/polywin/main/releases/server.exe",
-		},
-	}
-
-	// 尝试每个下载源
-	outputPath := filepath.Join(targetDir, execName+".new")
-	log.Printf("目标下载路径: %s", outputPath)
-
-	var lastErr error
-	for i, source := range downloadSources {
-		if source.url == "" {
-			log.Printf("跳过下载源 %d (%s): URL 为空", i+1, source.name)
-			continue
+// stageUpdate 新版本通过校验后保存到版本库并写入磁盘，然后通知守护程序：
+// 目标程序停止后由 applyPending 替换文件，新版本启动后进入试运行；approval 为 true 时先等待批准
+func (u *Updater) stageUpdate(record InstalledRecord, approval bool) error {
+	record = u.storeVersion(u.config.TargetPath+".new", record)
+	if err := u.verifyStaged(record); err != nil {
+		u.discardStaged(err.Error())
+		return err
+	}
+	if approval {
+		err := u.awaitApproval()
+		u.gcVersions()
+		return err
+	}
+	u.setPendingUpdate(true)
+	u.gcVersions()
+	log.Printf("新版本 %s 已就绪，%s", record, u.applySchedule(time.Now()))
+	u.notifyReady()
+	return nil
+}
+
+// notifyReady 通知守护程序有新版本等待应用
+func (u *Updater) notifyReady() {
+	select {
+	case u.ready <- struct{}{}:
+	default:
+	}
+}
+
+// applyPending 用已就绪的新版本替换目标程序，调用时目标程序必须已停止；
+// 记录已安装版本，保留旧版本，新版本启动后进入试运行，失败时回滚
+func (u *Updater) applyPending() error {
+	u.updateMutex.Lock()
+	tx := u.state.Transaction
+	// 先取走待应用标记，避免与 discardPending 同时处理 .new
+	pending := u.pendingUpdate
+	u.pendingUpdate = false
+	u.updateMutex.Unlock()
+	if !pending || tx == nil || tx.Phase != TxVerified {
+		return nil
+	}
+
+	log.Printf("替换目标程序为版本 %s...", tx.Version)
+	if err := u.swapFiles(); err != nil {
+		err = fmt.Errorf("替换目标程序失败: %v", err)
+		u.discardStaged(err.Error())
+		u.setLastFailure(&UpdateInfo{Version: tx.Version}, err)
+		return err
+	}
+
+	u.updateMutex.Lock()
+	u.probation = &installedUpdate{
+		Version:     tx.Version,
+		BackupPath:  u.config.TargetPath + ".old",
+		InstalledAt: time.Now(),
+		Previous:    tx.Previous,
+	}
+	u.state.Installed = tx.Installed
+	err := u.transition(TxSwapped, "")
+	u.updateMutex.Unlock()
+	if err != nil {
+		log.Printf("保存已安装版本失败: %v", err)
+	}
+	log.Printf("目标程序已替换为版本 %s，启动后进入试运行", tx.Version)
+	return nil
+}
+
+// discardPending 放弃尚未应用的新版本，已开始替换时返回 false
+func (u *Updater) discardPending(reason string) bool {
+	u.updateMutex.Lock()
+	pending := u.pendingUpdate
+	u.pendingUpdate = false
+	u.updateMutex.Unlock()
+	if !pending {
+		return false
+	}
+	u.discardStaged(reason)
+	return true
+}
+
+// pendingVersion 返回已就绪、等待应用的版本
+func (u *Updater) pendingVersion() string {
+	u.updateMutex.Lock()
+	defer u.updateMutex.Unlock()
+	if !u.pendingUpdate || u.state.Transaction == nil {
+		return ""
+	}
+	return u.state.Transaction.Version
+}
+
+// applyAllowed 目标程序（重新）启动时是否可以替换为已就绪的新版本
+func (u *Updater) applyAllowed(now time.Time) bool {
+	if u.config.ApplyStrategy == ApplyWindow && u.config.ApplyWindow != nil {
+		return u.config.ApplyWindow.Contains(now)
+	}
+	return true
+}
+
+// restartAt 返回为应用新版本而重启运行中的目标程序的时间；on-next-exit 不主动重启，返回 false
+func (u *Updater) restartAt(now time.Time) (time.Time, bool) {
+	switch u.config.ApplyStrategy {
+	case ApplyOnNextExit:
+		return time.Time{}, false
+	case ApplyWindow:
+		if u.config.ApplyWindow != nil {
+			next := u.config.ApplyWindow.Next(now)
+			return next, !next.IsZero()
 		}
+	}
+	return now, true
+}
 
-		log.Printf("尝试从 %s 下载 (URL: %s)...", source.name, source.url)
-		if err := u.downloadFileToPath(source.url, outputPath); err != nil {
-			log.Printf("从 %s 下载失败: %v", source.name, err)
-			lastErr = err
-			continue
+// applySchedule 描述新版本何时应用
+func (u *Updater) applySchedule(now time.Time) string {
+	at, ok := u.restartAt(now)
+	switch {
+	case !ok:
+		return "将在服务器程序下次退出后应用"
+	case at.After(now):
+		return fmt.Sprintf("将在维护窗口 %s 应用", at.Format("2006-01-02 15:04"))
+	}
+	return "立即重启服务器程序以应用"
+}
+
+// downloadArtifact 从更新源下载发布产物到 outputPath，并校验校验和、大小和签名
+func (u *Updater) downloadArtifact(info *UpdateInfo, outputPath string) error {
+	if info.DownloadURL == "" {
+		return fmt.Errorf("更新信息中没有下载地址")
+	}
+
+	// 压缩包先下载到 <输出文件>.<格式>，校验通过后再解压到输出文件
+	fetchPath := outputPath
+	kind := archiveKind(artifactName(info.DownloadURL))
+	if kind != "" {
+		fetchPath = outputPath + "." + kind
+	}
+
+	// 校验和优先使用更新信息中的值，否则从同目录的 checksums.txt 中查找
+	checksum, err := ParseChecksum(info.Checksum)
+	if err != nil {
+		return fmt.Errorf("更新信息中的校验和无效: %v", err)
+	}
+	if checksum == nil {
+		if checksum, err = u.fetchChecksum(siblingRef(info.DownloadURL, checksumsFileName), artifactName(info.DownloadURL)); err != nil {
+			log.Printf("获取校验和失败: %v", err)
 		}
+	}
+	if checksum == nil {
+		if u.config.RequireChecksum {
+			return fmt.Errorf("没有可用的校验和")
+		}
+		log.Println("警告: 没有可用的校验和，下载的文件将不做完整性校验")
+	}
 
-		// 验证文件是否存在且大小大于0
-		if info, err := os.Stat(outputPath); err != nil {
-			log.Printf("下载的文件不存在: %v", err)
-			lastErr = fmt.Errorf("下载的文件不存在: %v", err)
-			continue
-		} else if info.Size() == 0 {
-			log.Printf("下载的文件大小为0，删除并尝试下一个源")
-			os.Remove(outputPath)
-			lastErr = fmt.Errorf("下载的文件大小为0")
-			continue
+	expect := artifactExpectation{
+		Checksum: checksum,
+		Size:     info.Size,
+		MaxSize:  u.config.MaxDownloadSize,
+	}
+
+	// 增量补丁只用于未压缩的发布产物，生成的文件必须与完整产物的校验和一致
+	if kind != "" || checksum == nil || !u.downloadPatched(info, outputPath, expect) {
+		if err := u.fetchArtifact(info.DownloadURL, fetchPath, expect); err != nil {
+			return err
 		}
+	}
 
-		// 再次获取文件信息以确认
-		fileInfo, _ := os.Stat(outputPath)
-		log.Printf("从 %s 下载成功！文件大小: %d 字节", source.name, fileInfo.Size())
-		return nil
+	// 校验签名，没有受信任的公钥时校验失败
+	if !u.config.SkipSignature {
+		if err := u.verifySignature(info.DownloadURL, info.SignatureURL, func(sig []byte) (*PublicKey, error) {
+			return verifyFileSignature(u.config.PublicKeys, fetchPath, sig)
+		}); err != nil {
+			os.Remove(fetchPath)
+			return &integrityError{fmt.Sprintf("签名校验失败: %v", err)}
+		}
 	}
 
-	return fmt.Errorf("所有下载源都失败，最后一个错误: %v", lastErr)
+	if kind != "" {
+		err := extractArchive(kind, fetchPath, u.extraction(outputPath))
+		os.Remove(fetchPath)
+		if err != nil {
+			return &integrityError{fmt.Sprintf("解压失败: %v", err)}
+		}
+	}
+	return nil
 }
 
-// downloadFileToPath 下载文件到指定路径
-func (u *Updater) downloadFileToPath(url, outputPath string) error {
-	// 创建带超时的 HTTP 客户端（60秒超时，下载文件需要更长时间）
-	client := &http.Client{
-		Timeout: 60 * time.Second,
+// fetchArtifact 从更新源下载文件，完成后清除下载进度
+func (u *Updater) fetchArtifact(ref, outputPath string, expect artifactExpectation) error {
+	log.Printf("开始下载 %s ...", ref)
+	err := u.config.Source.FetchArtifact(u.ctx, ref, outputPath, expect)
+	u.updateMutex.Lock()
+	u.download = nil
+	u.updateMutex.Unlock()
+	return err
+}
+
+// downloadPatched 下载从已安装版本到 info 的增量补丁并应用到当前目标程序，结果写入 outputPath
+// 生成的文件按完整产物的 expect 校验；没有补丁或任何一步失败时返回 false，由调用方下载完整产物
+func (u *Updater) downloadPatched(info *UpdateInfo, outputPath string, expect artifactExpectation) bool {
+	from := u.installedRecord().Version
+	if !u.config.Delta || from == "" {
+		return false
+	}
+	if _, err := os.Stat(u.config.TargetPath); err != nil {
+		return false
+	}
+	patch := u.findPatch(info, from)
+	if patch == nil {
+		return false
 	}
 
-	req, err := http.NewRequestWithContext(u.ctx, "GET", url, nil)
+	patchChecksum, err := ParseChecksum(patch.Checksum)
+	if err != nil {
+		log.Printf("补丁校验和无效，下载完整文件: %v", err)
+		return false
+	}
+	patchPath := outputPath + ".patch"
+	err = u.fetchArtifact(patch.URL, patchPath, artifactExpectation{
+		Checksum: patchChecksum,
+		Size:     patch.Size,
+		MaxSize:  u.config.MaxDownloadSize,
+	})
 	if err != nil {
-		return fmt.Errorf("创建请求失败: %v", err)
+		log.Printf("下载补丁失败，下载完整文件: %v", err)
+		return false
 	}
+	defer os.Remove(patchPath)
 
-	resp, err := client.Do(req)
+	maxSize := expect.Size
+	if maxSize == 0 {
+		maxSize = expect.MaxSize
+	}
+	if err := applyPatchFile(u.config.TargetPath, patchPath, outputPath, maxSize); err != nil {
+		log.Printf("应用补丁失败，下载完整文件: %v", err)
+		return false
+	}
+	fi, err := os.Stat(outputPath)
+	if err == nil {
+		err = verifyArtifact(outputPath, fi.Size(), expect)
+	}
 	if err != nil {
-		return fmt.Errorf("请求失败: %v", err)
+		log.Printf("补丁生成的文件校验失败，下载完整文件: %v", err)
+		os.Remove(outputPath)
+		return false
+	}
+	log.Printf("已通过增量补丁生成版本 %s（%s -> %s）", info.ID(), from, info.ID())
+	return true
+}
+
+// findPatch 查找从 from 版本升级的补丁：优先使用更新信息中的 patches，
+// 否则在 checksums.txt 中查找 <发布产物文件名>.<from>.patch
+func (u *Updater) findPatch(info *UpdateInfo, from string) *PatchInfo {
+	for i := range info.Patches {
+		if sameVersion(info.Patches[i].From, from) {
+			return &info.Patches[i]
+		}
+	}
+	if len(info.Patches) > 0 {
+		return nil
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP 状态码: %d", resp.StatusCode)
+	name := patchFileName(artifactName(info.DownloadURL), from)
+	checksum, err := u.fetchChecksum(siblingRef(info.DownloadURL, checksumsFileName), name)
+	if err != nil || checksum == nil {
+		return nil
 	}
+	return &PatchInfo{From: from, URL: siblingRef(info.DownloadURL, name), Checksum: checksum.String()}
+}
 
-	outFile, err := os.Create(outputPath)
-	if err != nil {
-		return fmt.Errorf("创建文件失败: %v", err)
+// extraction 返回从压缩包中提取的文件：目标程序写入 outputPath，附带文件写入同目录的 <文件名>.new
+func (u *Updater) extraction(outputPath string) archiveExtraction {
+	entry := u.config.ArchiveEntry
+	if entry == "" {
+		entry = filepath.Base(u.config.TargetPath)
+	}
+	x := archiveExtraction{
+		Entry:      entry,
+		Output:     outputPath,
+		Companions: make(map[string]string, len(u.config.Companions)),
+		MaxSize:    u.config.MaxExtractSize,
+	}
+	for _, name := range u.config.Companions {
+		x.Companions[name] = filepath.Join(filepath.Dir(u.config.TargetPath), name+".new")
 	}
-	defer outFile.Close()
+	return x
+}
+
+// swapCompanions 用提取出的 <文件名>.new 替换附带文件，原文件保留为 .old
+func (u *Updater) swapCompanions() {
+	dir := filepath.Dir(u.config.TargetPath)
+	for _, name := range u.config.Companions {
+		current := filepath.Join(dir, name)
+		newPath := current + ".new"
+		if _, err := os.Stat(newPath); err != nil {
+			continue
+		}
+		os.Remove(current + ".old")
+		if err := os.Rename(current, current+".old"); err != nil && !os.IsNotExist(err) {
+			log.Printf("备份附带文件 %s 失败: %v", name, err)
+			continue
+		}
+		if err := os.Rename(newPath, current); err != nil {
+			log.Printf("替换附带文件 %s 失败: %v", name, err)
+			os.Rename(current+".old", current)
+		}
+	}
+}
 
-	written, err := io.Copy(outFile, resp.Body)
+// InstallInitial 目标程序不存在时从更新源下载最新版本并记录已安装版本
+func (u *Updater) InstallInitial() error {
+	if u.config.Source == nil {
+		return fmt.Errorf("未配置更新源")
+	}
+
+	info, err := u.latest()
 	if err != nil {
-		os.Remove(outputPath)
-		return fmt.Errorf("写入文件失败: %v", err)
+		return err
+	}
+	if info == nil {
+		return fmt.Errorf("%s 中没有可用的发布（当前平台 %s）", u.config.Source, platformKey())
+	}
+	u.installMutex.Lock()
+	defer u.installMutex.Unlock()
+	if err := u.checkVersionPolicy(info); err != nil {
+		return err
 	}
 
-	if written == 0 {
-		os.Remove(outputPath)
-		return fmt.Errorf("下载的文件为空")
+	targetPath := u.config.TargetPath
+	newPath := targetPath + ".new"
+	if err := u.downloadArtifact(info, newPath); err != nil {
+		return err
+	}
+	stamp, err := u.checkCandidate(newPath, info)
+	if err != nil {
+		os.Remove(newPath)
+		return err
 	}
+	if err := os.Chmod(newPath, 0755); err != nil {
+		os.Remove(newPath)
+		return fmt.Errorf("设置可执行权限失败: %v", err)
+	}
+	if err := syncFile(newPath); err != nil {
+		os.Remove(newPath)
+		return fmt.Errorf("写入目标程序失败: %v", err)
+	}
+	if err := os.Rename(newPath, targetPath); err != nil {
+		os.Remove(newPath)
+		return fmt.Errorf("移动文件失败: %v", err)
+	}
+	u.swapCompanions()
+	syncDir(filepath.Dir(targetPath))
 
-	log.Printf("下载完成，文件大小: %d 字节", written)
+	record := InstalledRecord{Version: info.Version, Revision: info.Revision, InstalledAt: time.Now(), Source: "bootstrap", Commit: stamp.Commit(), Channel: info.ReleaseChannel()}
+	u.RecordInstalled(u.storeVersion(targetPath, record))
+	u.gcVersions()
+	log.Printf("已安装版本: %s", info.ID())
 	return nil
 }
 
-// updateTarget 更新目标程序（不重启，由守护程序负责重启）
-func (u *Updater) updateTarget(targetPath string) error {
-	log.Println("准备更新目标程序...")
+// checkCandidate 检查下载的新版本：必须是当前平台的可执行文件，Go 构建信息符合 BuildPolicy
+func (u *Updater) checkCandidate(path string, info *UpdateInfo) (*BuildStamp, error) {
+	if err := validateExecutable(path); err != nil {
+		return nil, fmt.Errorf("新版本不是 %s 平台的可执行文件: %v", platformKey(), err)
+	}
+	stamp, err := u.config.BuildPolicy.Check(path, info.Version)
+	if err != nil {
+		return nil, fmt.Errorf("新版本不符合构建策略: %v", err)
+	}
+	if stamp != nil && stamp.Commit() != "" {
+		log.Printf("新版本构建信息: %s（%s），提交 %s", stamp.Package, stamp.GoVersion, stamp.Commit())
+	}
+	return stamp, nil
+}
 
-	execDir := filepath.Dir(targetPath)
-	execName := filepath.Base(targetPath)
-	newExecPath := filepath.Join(execDir, execName+".new")
-	oldExecPath := filepath.Join(execDir, execName+".old")
+// fetchChecksum 读取 checksums.txt 并查找指定文件的校验和，文件不存在时返回 nil
+func (u *Updater) fetchChecksum(ref, name string) (*Checksum, error) {
+	data, err := u.config.Source.FetchMetadata(u.ctx, ref)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	return findChecksum(data, name)
+}
 
-	// 检查新版本文件是否存在
-	if _, err := os.Stat(newExecPath); os.IsNotExist(err) {
-		return fmt.Errorf("新版本文件不存在: %s", newExecPath)
+// verifySignature 从更新源读取签名文件并校验。signatureURL 为空时依次尝试 artifactURL + .minisig / .sig
+func (u *Updater) verifySignature(artifactURL, signatureURL string, verify func(sig []byte) (*PublicKey, error)) error {
+	candidates := []string{signatureURL}
+	if signatureURL == "" {
+		candidates = candidates[:0]
+		for _, suffix := range signatureSuffixes {
+			candidates = append(candidates, artifactURL+suffix)
+		}
 	}
 
-	// 在 Windows 上，我们需要使用批处理脚本来替换文件
-	if runtime.GOOS == "windows" {
-		return u.updateWindows(targetPath, newExecPath, oldExecPath)
+	for _, url := range candidates {
+		sig, err := u.config.Source.FetchMetadata(u.ctx, url)
+		if err != nil {
+			return fmt.Errorf("下载签名失败: %v", err)
+		}
+		if sig == nil {
+			continue
+		}
+		key, err := verify(sig)
+		if err != nil {
+			return err
+		}
+		log.Printf("签名验证通过 (key id: %s)", key.ID())
+		return nil
 	}
+	return fmt.Errorf("没有找到签名文件（%s）", strings.Join(candidates, "、"))
+}
+
+// UpdateStatus 更新器状态快照
+type UpdateStatus struct {
+	Installed InstalledRecord   `json:"installed"`
+	Channel   string            `json:"channel"`        // 订阅的发布通道
+	Bucket    float64           `json:"rollout_bucket"` // 本机的分阶段发布分组（0-100）
+	Pending   bool              `json:"pending"`
+	Download  *DownloadProgress `json:"download,omitempty"`           // 正在进行的下载
+	Probation string            `json:"probation,omitempty"`          // 正在试运行的版本
+	Hold      *UpdateHold       `json:"hold,omitempty"`               // 更新已暂停
+	Pinned    string            `json:"version_constraint,omitempty"` // 版本约束
+	Blacklist []string          `json:"blacklist,omitempty"`
+	LastError *UpdateFailure    `json:"last_error,omitempty"` // 最近一次更新失败的原因
+
+	Transaction *UpdateTransaction `json:"transaction,omitempty"` // 最近一次更新事务
+
+	Strategy    ApplyStrategy `json:"apply_strategy"`
+	ApplyWindow string        `json:"apply_window,omitempty"`
+	NextApply   *time.Time    `json:"next_apply,omitempty"` // 已就绪的新版本计划应用的时间，on-next-exit 时为空
+
+	RequireApproval  bool       `json:"require_approval"`
+	AwaitingApproval string     `json:"awaiting_approval,omitempty"` // 已就绪、等待批准的版本
+	ApprovalExpires  *time.Time `json:"approval_expires_at,omitempty"`
+	ApprovalExpired  string     `json:"approval_expired,omitempty"` // 等待批准超时的版本，出现更新的版本前不再下载
+}
 
-	// 在 Unix 系统上，可以直接替换
-	return u.updateUnix(targetPath, newExecPath, oldExecPath)
+// UpdateFailure 更新失败记录
+type UpdateFailure struct {
+	Version string    `json:"version"`
+	Reason  string    `json:"reason"`
+	Time    time.Time `json:"time"`
 }
 
-// updateWindows Windows 系统更新（不重启程序）
-func (u *Updater) updateWindows(targetPath, newExecPath, oldExecPath string) error {
-	// 在 Windows 上，如果目标程序正在运行，无法直接替换
-	// 我们创建一个批处理脚本，在目标程序退出后执行替换
-	scriptPath := filepath.Join(filepath.Dir(targetPath), "update_server.bat")
-	scriptContent := fmt.Sprintf(`@echo off
-:loop
-timeout /t 1 /nobreak >nul
-tasklist /FI "IMAGENAME eq %s" 2>NUL | find /I /N "%s">NUL
-if "%%ERRORLEVEL%%"=="0" goto loop
-move /Y "%s" "%s" 2>NUL
-move /Y "%s" "%s" 2>NUL
-del "%%~f0"
-`, filepath.Base(targetPath), filepath.Base(targetPath), targetPath, oldExecPath, newExecPath, targetPath)
+// Status 返回更新器状态快照
+func (u *Updater) Status() UpdateStatus {
+	u.updateMutex.Lock()
+	defer u.updateMutex.Unlock()
 
-	if err := os.WriteFile(scriptPath, []byte(scriptContent), 0644); err != nil {
-		return fmt.Errorf("创建更新脚本失败: %v", err)
+	status := UpdateStatus{
+		Installed: u.state.Installed,
+		Channel:   u.config.Channel,
+		Bucket:    u.bucket,
+		Pending:   u.pendingUpdate,
+		Download:  u.download,
+		Blacklist: append([]string(nil), u.state.Blacklist...),
+		LastError: u.lastFailure,
+		Hold:      u.state.Hold,
+		Pinned:    u.config.Constraint.String(),
+		Strategy:  u.config.ApplyStrategy,
+	}
+	if status.Strategy == "" {
+		status.Strategy = ApplyImmediate
+	}
+	if u.config.ApplyWindow != nil {
+		status.ApplyWindow = u.config.ApplyWindow.String()
+	}
+	if u.pendingUpdate {
+		if at, ok := u.restartAt(time.Now()); ok {
+			status.NextApply = &at
+		}
+	}
+	if u.probation != nil {
+		status.Probation = u.probation.Version
 	}
+	status.RequireApproval = u.config.RequireApproval
+	status.ApprovalExpired = u.state.Expired
+	if tx := u.state.Transaction; tx != nil && tx.Phase == TxReady {
+		status.AwaitingApproval = tx.Version
+		status.ApprovalExpires = tx.ExpiresAt
+	}
+	if tx := u.state.Transaction; tx != nil {
+		copied := *tx
+		status.Transaction = &copied
+	}
+	return status
+}
 
-	// 启动更新脚本（后台运行）
-	var cmd *exec.Cmd
-	if runtime.GOOS == "windows" {
-		cmd = exec.Command("cmd", "/C", "start", "/min", "", scriptPath)
+// installedRecord 返回已安装版本记录
+func (u *Updater) installedRecord() InstalledRecord {
+	u.updateMutex.Lock()
+	defer u.updateMutex.Unlock()
+	return u.state.Installed
+}
+
+// RecordInstalled 记录通过其他途径（如首次下载）安装的版本
+func (u *Updater) RecordInstalled(record InstalledRecord) {
+	u.updateMutex.Lock()
+	defer u.updateMutex.Unlock()
+	if record.InstalledAt.IsZero() {
+		record.InstalledAt = time.Now()
+	}
+	u.state.Installed = record
+	if err := u.state.save(u.config.StatePath); err != nil {
+		log.Printf("保存已安装版本失败: %v", err)
+	}
+}
+
+// Hold 返回更新暂停记录，没有暂停时返回 nil
+func (u *Updater) Hold() *UpdateHold {
+	u.updateMutex.Lock()
+	defer u.updateMutex.Unlock()
+	return u.state.Hold
+}
+
+// SetHold 暂停（hold 为 true）或恢复更新，状态保存在状态文件中，守护程序重启后仍然有效
+func (u *Updater) SetHold(hold bool, reason string) (*UpdateHold, error) {
+	u.updateMutex.Lock()
+	defer u.updateMutex.Unlock()
+
+	previous := u.state.Hold
+	if hold {
+		// 已暂停时保留暂停时间，只更新原因
+		next := &UpdateHold{Reason: strings.TrimSpace(reason), Since: time.Now()}
+		if previous != nil {
+			next.Since = previous.Since
+			if next.Reason == "" {
+				next.Reason = previous.Reason
+			}
+		}
+		u.state.Hold = next
 	} else {
-		cmd = exec.Command("cmd", "/C", scriptPath)
+		u.state.Hold = nil
 	}
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("启动更新脚本失败: %v", err)
+	if err := u.state.save(u.config.StatePath); err != nil {
+		u.state.Hold = previous
+		return previous, err
 	}
+	if hold {
+		log.Printf("更新已暂停（%s）", u.state.Hold)
+	} else if previous != nil {
+		log.Println("已恢复更新")
+	}
+	return u.state.Hold, nil
+}
 
-	log.Println("更新脚本已启动，将在目标程序退出后自动替换文件")
-	// 注意：不在这里设置 pendingUpdate = false
-	// 让 monitorServer 在重启时检查文件是否已替换
-	return nil
+// isBlacklisted 版本是否在黑名单中
+func (u *Updater) isBlacklisted(version string) bool {
+	u.updateMutex.Lock()
+	defer u.updateMutex.Unlock()
+	return u.state.isBlacklisted(version)
 }
 
-// updateUnix Unix 系统更新（不重启程序）
-func (u *Updater) updateUnix(targetPath, newExecPath, oldExecPath string) error {
-	// 重命名当前可执行文件
-	if err := os.Rename(targetPath, oldExecPath); err != nil {
-		return fmt.Errorf("重命名当前可执行文件失败: %v", err)
+// isExpired 版本是否曾等待批准超时
+func (u *Updater) isExpired(version string) bool {
+	u.updateMutex.Lock()
+	defer u.updateMutex.Unlock()
+	return u.state.Expired != "" && sameVersion(u.state.Expired, version)
+}
+
+// InProbation 是否有更新正在等待试运行验证
+func (u *Updater) InProbation() bool {
+	u.updateMutex.Lock()
+	defer u.updateMutex.Unlock()
+	return u.probation != nil
+}
+
+// beginProbation 新版本进程启动时调用，返回需要试运行验证的更新
+func (u *Updater) beginProbation() *installedUpdate {
+	u.updateMutex.Lock()
+	defer u.updateMutex.Unlock()
+	if u.probation == nil || u.probation.started {
+		return nil
+	}
+	u.probation.started = true
+	if err := u.transition(TxProbation, ""); err != nil {
+		log.Printf("%v", err)
+	}
+	return u.probation
+}
+
+// isProbation 指定更新是否仍处于试运行中
+func (u *Updater) isProbation(p *installedUpdate) bool {
+	u.updateMutex.Lock()
+	defer u.updateMutex.Unlock()
+	return p != nil && u.probation == p
+}
+
+// commitProbation 新版本通过试运行，删除旧版本备份
+func (u *Updater) commitProbation(p *installedUpdate) {
+	u.updateMutex.Lock()
+	if u.probation != p {
+		u.updateMutex.Unlock()
+		return
+	}
+	u.probation = nil
+	err := u.transition(TxCommitted, "")
+	u.updateMutex.Unlock()
+	if err != nil {
+		log.Printf("%v", err)
 	}
 
-	// 移动新版本到目标位置
-	if err := os.Rename(newExecPath, targetPath); err != nil {
-		// 如果失败，尝试恢复
-		os.Rename(oldExecPath, targetPath)
-		return fmt.Errorf("移动新版本失败: %v", err)
+	log.Printf("版本 %s 已通过试运行", p.Version)
+	if err := os.Remove(p.BackupPath); err != nil && !os.IsNotExist(err) {
+		log.Printf("删除旧版本备份失败: %v", err)
+	}
+	dir := filepath.Dir(u.config.TargetPath)
+	for _, name := range u.config.Companions {
+		os.Remove(filepath.Join(dir, name+".old"))
 	}
+	syncDir(dir)
+}
 
-	// 设置可执行权限
-	if err := os.Chmod(targetPath, 0755); err != nil {
-		return fmt.Errorf("设置可执行权限失败: %v", err)
+// rollbackProbation 恢复旧版本并将失败版本加入黑名单，调用时目标程序必须已停止
+func (u *Updater) rollbackProbation(p *installedUpdate, reason string) error {
+	u.updateMutex.Lock()
+	if u.probation != p {
+		u.updateMutex.Unlock()
+		return nil
 	}
+	u.probation = nil
+	u.state.addBlacklist(p.Version)
+	u.state.Installed = p.Previous
+	// 恢复文件前先记录正在回滚，中断后启动时继续回滚，而不是把 .old 当作残留文件删除
+	if tx := u.state.Transaction; tx.active() {
+		tx.RollingBack = true
+		tx.Reason = reason
+	}
+	err := u.state.save(u.config.StatePath)
+	u.updateMutex.Unlock()
 
-	// 删除旧版本文件
-	go func() {
-		time.Sleep(5 * time.Second)
-		os.Remove(oldExecPath)
-	}()
+	log.Printf("版本 %s 试运行失败（%s），回滚到旧版本", p.Version, reason)
+	if err != nil {
+		log.Printf("保存黑名单失败: %v", err)
+	}
+
+	if _, err := os.Stat(p.BackupPath); err != nil {
+		u.setPhase(TxRolledBack, fmt.Sprintf("%s；旧版本备份不存在，无法恢复", reason))
+		return fmt.Errorf("旧版本备份不存在，无法回滚: %v", err)
+	}
+	if err := os.Rename(p.BackupPath, u.config.TargetPath); err != nil {
+		return fmt.Errorf("恢复旧版本失败: %v", err)
+	}
+	dir := filepath.Dir(u.config.TargetPath)
+	for _, name := range u.config.Companions {
+		old := filepath.Join(dir, name+".old")
+		if _, err := os.Stat(old); err == nil {
+			if err := os.Rename(old, filepath.Join(dir, name)); err != nil {
+				log.Printf("恢复附带文件 %s 失败: %v", name, err)
+			}
+		}
+	}
+	if err := syncDir(dir); err != nil {
+		log.Printf("写入目录失败: %v", err)
+	}
+	u.setPhase(TxRolledBack, reason)
 
-	log.Println("目标程序已更新，等待守护程序重启")
-	u.setPendingUpdate(false) // 标记更新完成，等待重启
+	log.Printf("已恢复旧版本，版本 %s 已加入黑名单", p.Version)
 	return nil
 }
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// versionsDirName 版本库目录名（与目标程序位于同一目录）
+const versionsDirName = "versions"
+
+// VersionRecord 版本库中一个版本的元数据，保存在 versions/<sha256>.json
+type VersionRecord struct {
+	Version     string    `json:"version,omitempty"`
+	Revision    string    `json:"revision,omitempty"`
+	Checksum    string    `json:"checksum"` // sha256:<hex>，文件内容保存在 versions/<hex>
+	Size        int64     `json:"size"`
+	InstalledAt time.Time `json:"installed_at"` // 最近一次安装时间
+	Source      string    `json:"source,omitempty"`
+	Commit      string    `json:"commit,omitempty"`
+	Channel     string    `json:"channel,omitempty"`
+	Current     bool      `json:"current,omitempty"` // 是否为当前安装的版本（列出时计算，不保存）
+}
+
+// String 返回版本描述
+func (r *VersionRecord) String() string {
+	return r.installed().String()
+}
+
+// installed 转换为已安装版本记录
+func (r *VersionRecord) installed() InstalledRecord {
+	return InstalledRecord{
+		Version:  r.Version,
+		Revision: r.Revision,
+		Source:   r.Source,
+		Commit:   r.Commit,
+		Channel:  r.Channel,
+		Checksum: r.Checksum,
+	}
+}
+
+// VersionStore 按内容寻址保存最近安装的目标程序版本，用于回滚或切换到任意保留的版本
+type VersionStore struct {
+	Dir     string
+	Keep    int   // 最多保留的版本数量
+	MaxSize int64 // 版本库总大小上限（字节），0 表示不限制
+}
+
+// Add 将文件加入版本库，内容相同的文件只保存一份，元数据更新为 record
+func (s *VersionStore) Add(path string, record InstalledRecord) (*VersionRecord, error) {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建版本库目录失败: %v", err)
+	}
+
+	sum, size, err := fileSHA256(path)
+	if err != nil {
+		return nil, err
+	}
+	objPath := filepath.Join(s.Dir, sum)
+	if _, err := os.Stat(objPath); err != nil {
+		if err := copyFileSynced(path, objPath); err != nil {
+			return nil, fmt.Errorf("保存版本文件失败: %v", err)
+		}
+	}
+
+	rec := &VersionRecord{
+		Version:     record.Version,
+		Revision:    record.Revision,
+		Checksum:    "sha256:" + sum,
+		Size:        size,
+		InstalledAt: record.InstalledAt,
+		Source:      record.Source,
+		Commit:      record.Commit,
+		Channel:     record.Channel,
+	}
+	if rec.InstalledAt.IsZero() {
+		rec.InstalledAt = time.Now()
+	}
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(objPath+".json", data, 0644); err != nil {
+		return nil, fmt.Errorf("保存版本元数据失败: %v", err)
+	}
+	return rec, nil
+}
+
+// List 返回版本库中的全部版本，最近安装的在前；current 为当前安装版本的校验和
+func (s *VersionStore) List(current string) ([]*VersionRecord, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取版本库失败: %v", err)
+	}
+
+	var records []*VersionRecord
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.Dir, name))
+		if err != nil {
+			continue
+		}
+		rec := &VersionRecord{}
+		if err := json.Unmarshal(data, rec); err != nil {
+			log.Printf("版本库元数据 %s 无效，忽略: %v", name, err)
+			continue
+		}
+		// 内容文件缺失的元数据无法使用
+		if _, err := os.Stat(filepath.Join(s.Dir, strings.TrimSuffix(name, ".json"))); err != nil {
+			continue
+		}
+		rec.Current = current != "" && rec.Checksum == current
+		records = append(records, rec)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].InstalledAt.After(records[j].InstalledAt)
+	})
+	return records, nil
+}
+
+// Find 按版本号或校验和（可以是至少 8 位的前缀）查找版本，多个记录匹配同一版本号时返回最近安装的
+func (s *VersionStore) Find(ref, current string) (*VersionRecord, error) {
+	records, err := s.List(current)
+	if err != nil {
+		return nil, err
+	}
+	ref = strings.TrimSpace(ref)
+	for _, rec := range records {
+		if rec.Version != "" && sameVersion(rec.Version, ref) {
+			return rec, nil
+		}
+	}
+	hexRef := strings.ToLower(strings.TrimPrefix(ref, "sha256:"))
+	if len(hexRef) >= 8 {
+		for _, rec := range records {
+			if strings.HasPrefix(strings.TrimPrefix(rec.Checksum, "sha256:"), hexRef) {
+				return rec, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("版本库中没有版本 %s", ref)
+}
+
+// Stage 将版本复制到 dst 并校验内容
+func (s *VersionStore) Stage(rec *VersionRecord, dst string) error {
+	sum := strings.TrimPrefix(rec.Checksum, "sha256:")
+	if err := copyFileSynced(filepath.Join(s.Dir, sum), dst); err != nil {
+		return fmt.Errorf("复制版本文件失败: %v", err)
+	}
+	checksum, err := ParseChecksum(rec.Checksum)
+	if err == nil {
+		err = checksum.VerifyFile(dst)
+	}
+	if err != nil {
+		os.Remove(dst)
+		return fmt.Errorf("版本库中的文件已损坏: %v", err)
+	}
+	return nil
+}
+
+// GC 按数量和总大小清理最早安装的版本，keep 中的校验和（当前版本、试运行的旧版本）不会被删除
+func (s *VersionStore) GC(keep ...string) {
+	records, err := s.List("")
+	if err != nil {
+		log.Printf("清理版本库失败: %v", err)
+		return
+	}
+	protected := make(map[string]bool, len(keep))
+	for _, c := range keep {
+		if c != "" {
+			protected[c] = true
+		}
+	}
+
+	var total int64
+	count := 0
+	for _, rec := range records {
+		if protected[rec.Checksum] || (count < s.Keep && (s.MaxSize <= 0 || total+rec.Size <= s.MaxSize)) {
+			total += rec.Size
+			count++
+			continue
+		}
+		sum := strings.TrimPrefix(rec.Checksum, "sha256:")
+		if err := os.Remove(filepath.Join(s.Dir, sum)); err != nil && !os.IsNotExist(err) {
+			log.Printf("删除版本 %s 失败: %v", rec, err)
+			continue
+		}
+		os.Remove(filepath.Join(s.Dir, sum+".json"))
+		log.Printf("已从版本库删除版本 %s（%s）", rec, rec.Checksum)
+	}
+	syncDir(s.Dir)
+}
+
+// fileSHA256 计算文件的 sha256 和大小
+func fileSHA256(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, fmt.Errorf("读取文件失败: %v", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// copyFileSynced 复制文件并刷新到磁盘：先写入临时文件，完成后重命名
+func copyFileSynced(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmpPath := dst + ".tmp"
+	out, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, dst); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return syncDir(filepath.Dir(dst))
+}
+
+// storeVersion 将文件保存到版本库，返回带有校验和的版本记录；保存失败不影响安装
+func (u *Updater) storeVersion(path string, record InstalledRecord) InstalledRecord {
+	if u.config.Versions == nil {
+		return record
+	}
+	rec, err := u.config.Versions.Add(path, record)
+	if err != nil {
+		log.Printf("保存版本 %s 到版本库失败: %v", record, err)
+		return record
+	}
+	record.Checksum = rec.Checksum
+	return record
+}
+
+// gcVersions 清理版本库，保留当前版本、等待替换的新版本和试运行中可能回滚到的旧版本
+func (u *Updater) gcVersions() {
+	if u.config.Versions == nil {
+		return
+	}
+	u.updateMutex.Lock()
+	keep := []string{u.state.Installed.Checksum}
+	if u.probation != nil {
+		keep = append(keep, u.probation.Previous.Checksum)
+	}
+	if tx := u.state.Transaction; tx.active() {
+		keep = append(keep, tx.Installed.Checksum)
+	}
+	u.updateMutex.Unlock()
+	u.config.Versions.GC(keep...)
+}
+
+// recordCurrentVersion 启动时将当前的目标程序加入版本库（启用版本库之前安装的版本也可以回滚）
+func (u *Updater) recordCurrentVersion() {
+	store := u.config.Versions
+	if store == nil {
+		return
+	}
+	if _, err := os.Stat(u.config.TargetPath); err != nil {
+		return
+	}
+	installed := u.installedRecord()
+	if installed.Checksum != "" {
+		if _, err := os.Stat(filepath.Join(store.Dir, strings.TrimPrefix(installed.Checksum, "sha256:"))); err == nil {
+			return
+		}
+	}
+
+	if installed.InstalledAt.IsZero() {
+		installed.InstalledAt = time.Now()
+	}
+	record := u.storeVersion(u.config.TargetPath, installed)
+	if record.Checksum == "" {
+		return
+	}
+	u.updateMutex.Lock()
+	u.state.Installed.Checksum = record.Checksum
+	err := u.state.save(u.config.StatePath)
+	u.updateMutex.Unlock()
+	if err != nil {
+		log.Printf("保存已安装版本失败: %v", err)
+	}
+	u.gcVersions()
+}
+
+// Versions 返回版本库中的版本，最近安装的在前
+func (u *Updater) Versions() ([]*VersionRecord, error) {
+	if u.config.Versions == nil {
+		return nil, fmt.Errorf("没有启用版本库（versions.keep 为 0）")
+	}
+	return u.config.Versions.List(u.installedRecord().Checksum)
+}
+
+// SwitchVersion 从版本库安装指定版本（回滚或前进），与自动更新一样经过事务和试运行，由守护程序重启目标程序后生效
+// 切换到更低的版本时当前版本加入黑名单，避免自动更新重新安装；指定的版本从黑名单中移除
+func (u *Updater) SwitchVersion(ref string) (*VersionRecord, error) {
+	store := u.config.Versions
+	if store == nil {
+		return nil, fmt.Errorf("没有启用版本库（versions.keep 为 0）")
+	}
+	if !u.installMutex.TryLock() {
+		return nil, fmt.Errorf("正在安装其他版本，请稍后重试")
+	}
+	defer u.installMutex.Unlock()
+	if u.InProbation() || u.HasPendingUpdate() {
+		return nil, fmt.Errorf("上一次更新尚未完成（等待替换或正在试运行），请稍后重试")
+	}
+	if ready := u.readyVersion(); ready != "" {
+		return nil, fmt.Errorf("版本 %s 正在等待批准，请先批准或拒绝", ready)
+	}
+
+	installed := u.installedRecord()
+	rec, err := store.Find(ref, installed.Checksum)
+	if err != nil {
+		return nil, err
+	}
+	if rec.Current {
+		return nil, fmt.Errorf("版本 %s 已是当前安装的版本", rec)
+	}
+
+	log.Printf("从版本库切换到版本 %s（当前版本 %s）", rec, installed)
+	record := rec.installed()
+	record.InstalledAt = time.Now()
+	u.beginTransaction(&UpdateInfo{Version: rec.Version, Revision: rec.Revision})
+	if err := store.Stage(rec, u.config.TargetPath+".new"); err != nil {
+		u.discardStaged(err.Error())
+		return nil, err
+	}
+	if err := validateExecutable(u.config.TargetPath + ".new"); err != nil {
+		u.discardStaged(err.Error())
+		return nil, fmt.Errorf("版本 %s 不是 %s 平台的可执行文件: %v", rec, platformKey(), err)
+	}
+
+	if err := u.stageUpdate(record, false); err != nil {
+		return nil, err
+	}
+
+	u.updateMutex.Lock()
+	u.state.removeBlacklist(rec.Version)
+	if versionGreater(installed.Version, rec.Version) {
+		u.state.addBlacklist(installed.Version)
+		log.Printf("版本 %s 已加入黑名单，自动更新不会重新安装", installed.Version)
+	}
+	err = u.state.save(u.config.StatePath)
+	u.updateMutex.Unlock()
+	if err != nil {
+		log.Printf("保存黑名单失败: %v", err)
+	}
+
+	return rec, nil
+}
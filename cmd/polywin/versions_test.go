@@ -0,0 +1,196 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// addTestVersion 将内容为 content 的文件以 version 加入版本库
+func addTestVersion(t *testing.T, store *VersionStore, version, content string, installedAt time.Time) *VersionRecord {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "server")
+	writeTestFiles(t, filepath.Dir(path), map[string]string{"server": content})
+	rec, err := store.Add(path, InstalledRecord{Version: version, InstalledAt: installedAt})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	return rec
+}
+
+// listVersions 返回版本库中的版本号，最近安装的在前
+func listVersions(t *testing.T, store *VersionStore) []string {
+	t.Helper()
+	records, err := store.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []string
+	for _, rec := range records {
+		versions = append(versions, rec.Version)
+	}
+	return versions
+}
+
+func TestVersionStore(t *testing.T) {
+	store := &VersionStore{Dir: filepath.Join(t.TempDir(), versionsDirName), Keep: 10}
+	now := time.Now()
+	v1 := addTestVersion(t, store, "1.0.0", "v1", now.Add(-2*time.Hour))
+	v2 := addTestVersion(t, store, "1.1.0", "v2", now.Add(-time.Hour))
+
+	if got := strings.Join(listVersions(t, store), " "); got != "1.1.0 1.0.0" {
+		t.Fatalf("List = %s", got)
+	}
+
+	// 内容相同只保存一份，元数据更新为最近一次安装
+	again := addTestVersion(t, store, "1.0.0", "v1", now)
+	if again.Checksum != v1.Checksum {
+		t.Fatalf("相同内容的校验和不同: %s, %s", again.Checksum, v1.Checksum)
+	}
+	if got := strings.Join(listVersions(t, store), " "); got != "1.0.0 1.1.0" {
+		t.Errorf("重新安装后 List = %s", got)
+	}
+	entries, _ := os.ReadDir(store.Dir)
+	if len(entries) != 4 {
+		t.Errorf("版本库中有 %d 个文件，期望 2 个版本各一个内容文件和元数据", len(entries))
+	}
+
+	records, _ := store.List(v2.Checksum)
+	for _, rec := range records {
+		if rec.Current != (rec.Checksum == v2.Checksum) {
+			t.Errorf("版本 %s 的 Current = %v", rec.Version, rec.Current)
+		}
+	}
+
+	hexSum := strings.TrimPrefix(v2.Checksum, "sha256:")
+	for _, ref := range []string{"1.1.0", "v1.1.0", v2.Checksum, hexSum[:8]} {
+		if rec, err := store.Find(ref, ""); err != nil || rec.Checksum != v2.Checksum {
+			t.Errorf("Find(%q) = %v, %v", ref, rec, err)
+		}
+	}
+	for _, ref := range []string{"2.0.0", hexSum[:7]} {
+		if _, err := store.Find(ref, ""); err == nil {
+			t.Errorf("Find(%q) 应返回错误", ref)
+		}
+	}
+
+	dst := filepath.Join(t.TempDir(), "server.new")
+	if err := store.Stage(v2, dst); err != nil {
+		t.Fatalf("Stage: %v", err)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "v2" {
+		t.Errorf("Stage 复制的内容 = %q", data)
+	}
+
+	// 内容文件损坏时拒绝使用
+	os.WriteFile(filepath.Join(store.Dir, hexSum), []byte("corrupted"), 0755)
+	if err := store.Stage(v2, dst); err == nil || !strings.Contains(err.Error(), "已损坏") {
+		t.Errorf("Stage 损坏的文件 = %v", err)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Error("校验失败时应删除复制的文件")
+	}
+
+	// 内容文件缺失的版本不再列出
+	os.Remove(filepath.Join(store.Dir, hexSum))
+	if got := strings.Join(listVersions(t, store), " "); got != "1.0.0" {
+		t.Errorf("内容文件缺失后 List = %s", got)
+	}
+}
+
+func TestVersionStoreGC(t *testing.T) {
+	tests := []struct {
+		name    string
+		keep    int
+		maxSize int64
+		protect []string // 不删除的版本
+		want    string
+	}{
+		{"按数量保留", 2, 0, nil, "1.3.0 1.2.0"},
+		{"保护的版本不计入清理", 2, 0, []string{"1.0.0"}, "1.3.0 1.2.0 1.0.0"},
+		{"按总大小保留", 10, 25, nil, "1.3.0 1.2.0"},
+		{"都不超出", 10, 0, nil, "1.3.0 1.2.0 1.1.0 1.0.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &VersionStore{Dir: filepath.Join(t.TempDir(), versionsDirName), Keep: tt.keep, MaxSize: tt.maxSize}
+			checksums := map[string]string{}
+			now := time.Now()
+			for i, v := range []string{"1.0.0", "1.1.0", "1.2.0", "1.3.0"} {
+				// 每个版本 10 字节
+				rec := addTestVersion(t, store, v, strings.Repeat(string(rune('a'+i)), 10), now.Add(time.Duration(i)*time.Minute))
+				checksums[v] = rec.Checksum
+			}
+			var keep []string
+			for _, v := range tt.protect {
+				keep = append(keep, checksums[v])
+			}
+			store.GC(keep...)
+
+			if got := strings.Join(listVersions(t, store), " "); got != tt.want {
+				t.Errorf("清理后 List = %s，期望 %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSwitchVersion(t *testing.T) {
+	dir := t.TempDir()
+	store := &VersionStore{Dir: filepath.Join(dir, versionsDirName), Keep: 5}
+
+	// 版本库中的旧版本和当前版本内容不同但都是可执行文件
+	copyTestTarget(t, filepath.Join(dir, "server"))
+	old := filepath.Join(t.TempDir(), "server")
+	copyTestTarget(t, old)
+	f, err := os.OpenFile(old, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("1.0.0")
+	f.Close()
+	v1, err := store.Add(old, InstalledRecord{Version: "1.0.0", InstalledAt: time.Now().Add(-time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saveTestState(t, dir, &UpdaterState{Installed: InstalledRecord{Version: "2.0.0"}, MachineID: "test", Blacklist: []string{"1.0.0"}})
+	u := newTestUpdater(t, dir, &UpdaterConfig{Versions: store})
+	u.Reconcile()
+
+	// 启动时当前版本加入版本库
+	versions, err := u.Versions()
+	if err != nil || len(versions) != 2 || !versions[0].Current || versions[0].Version != "2.0.0" {
+		t.Fatalf("Versions = %v, %v", versions, err)
+	}
+
+	for _, ref := range []string{"2.0.0", "3.0.0"} {
+		if _, err := u.SwitchVersion(ref); err == nil {
+			t.Errorf("SwitchVersion(%q) 应返回错误", ref)
+		}
+	}
+
+	rec, err := u.SwitchVersion("v1.0.0")
+	if err != nil {
+		t.Fatalf("SwitchVersion: %v", err)
+	}
+	if rec.Checksum != v1.Checksum || !u.HasPendingUpdate() {
+		t.Fatalf("切换到 %v，等待应用: %v", rec, u.HasPendingUpdate())
+	}
+	if sum, _, _ := fileSHA256(filepath.Join(dir, "server.new")); "sha256:"+sum != v1.Checksum {
+		t.Error("server.new 不是版本库中的旧版本")
+	}
+	state := loadTestState(t, dir)
+	if state.Transaction.Phase != TxVerified || state.Transaction.Version != "1.0.0" {
+		t.Errorf("事务 = %+v", state.Transaction)
+	}
+	// 回滚到更低的版本：当前版本加入黑名单，目标版本移出黑名单
+	if !state.isBlacklisted("2.0.0") || state.isBlacklisted("1.0.0") {
+		t.Errorf("黑名单 = %v", state.Blacklist)
+	}
+
+	if _, err := u.SwitchVersion("2.0.0"); err == nil || !strings.Contains(err.Error(), "尚未完成") {
+		t.Errorf("上一次切换尚未应用时 SwitchVersion = %v", err)
+	}
+}